@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// accessCheckInterval is how often the watcher checks it can still reach each board, 0 to only check when events fail.
+var accessCheckInterval time.Duration
+
+// alertURL is where alerts are posted, like a Slack or Mattermost incoming webhook, empty to only log them.
+var alertURL string
+
+// alertClient posts alerts. It doesn't use http.DefaultClient, which trel needs set up for Trello.
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// lostAccess is why the watcher can't act on a board, by board ID, with "" for every board when the token is rejected.
+// While access is lost, events are skipped and scheduled jobs leave the board alone, instead of failing over and over.
+var lostAccess = struct {
+	sync.Mutex
+	reasons map[string]string
+}{reasons: map[string]string{}}
+
+// AccessLost reports why the watcher can't act on a board, if it can't.
+func AccessLost(boardID string) (string, bool) {
+	lostAccess.Lock()
+	defer lostAccess.Unlock()
+	if reason, ok := lostAccess.reasons[""]; ok {
+		return reason, true
+	}
+	reason, ok := lostAccess.reasons[boardID]
+	return reason, ok
+}
+
+// LoseAccess records that the watcher can't act on a board, or on any board for "", and alerts the first time.
+func LoseAccess(boardID, reason string) {
+	lostAccess.Lock()
+	old, ok := lostAccess.reasons[boardID]
+	lostAccess.reasons[boardID] = reason
+	lostAccess.Unlock()
+	if ok && old == reason {
+		return
+	}
+	usage.Record("access-lost")
+	Alert("Stopped acting on %s: %s", accessName(boardID), reason)
+}
+
+// RestoreAccess records that the watcher can act on a board again, or on every board for "", and alerts if it couldn't.
+func RestoreAccess(boardID string) {
+	lostAccess.Lock()
+	_, ok := lostAccess.reasons[boardID]
+	delete(lostAccess.reasons, boardID)
+	lostAccess.Unlock()
+	if ok {
+		Alert("Access to %s is back, resuming", accessName(boardID))
+	}
+}
+
+func accessName(boardID string) string {
+	if boardID == "" {
+		return "every board"
+	}
+	if b, ok := FindBoard(boardID); ok {
+		return b.Name
+	}
+	return "board " + boardID
+}
+
+// CheckAccess asks Trello whether the token is still good and the board is still open and reachable,
+// and records access as lost or restored. It only returns an error if Trello couldn't be asked.
+func CheckAccess(boardID string) error {
+	err := apiDo(http.MethodGet, "members/me", url.Values{"fields": {"id"}}, nil)
+	if herr, ok := err.(trel.HTTPRequestError); ok && herr.StatusCode == http.StatusUnauthorized {
+		LoseAccess("", "Trello rejected the token, it may have been revoked or expired")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	RestoreAccess("")
+
+	var b struct {
+		Closed bool `json:"closed"`
+	}
+	err = apiDo(http.MethodGet, "boards/"+boardID, url.Values{"fields": {"closed"}}, &b)
+	if herr, ok := err.(trel.HTTPRequestError); ok {
+		switch herr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			LoseAccess(boardID, "the token can't reach the board, it may have been deleted or the watcher removed from it")
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if b.Closed {
+		LoseAccess(boardID, "the board is closed, reopen it to resume")
+		return nil
+	}
+	RestoreAccess(boardID)
+	return nil
+}
+
+// RunAccessChecks checks every board can still be reached every accessCheckInterval,
+// which also notices access coming back, since nothing else is done on a board while it is lost.
+func RunAccessChecks() {
+	for range Schedule(accessCheckInterval) {
+		for _, b := range boards {
+			if err := CheckAccess(b.ID); err != nil {
+				logger.Printf("Unable to check access to %s: %s\n", b.Name, err)
+			}
+		}
+	}
+}
+
+// PauseOnLostAccess holds every Event on a board the watcher has lost access to, to handle once access is back,
+// and checks access whenever an Event fails, since a revoked token or closed board fails every one.
+func PauseOnLostAccess(next EventHandler) EventHandler {
+	return func(e Event) error {
+		if _, lost := AccessLost(board.ID); lost {
+			// The check is cheap next to a handler, and notices access coming back without waiting for RunAccessChecks.
+			if err := CheckAccess(board.ID); err != nil {
+				logger.Printf("Unable to check access to %s: %s\n", board.Name, err)
+			}
+			if reason, lost := AccessLost(board.ID); lost {
+				logger.Printf("Holding %s: %s\n", e.ActionType, reason)
+				heldEvents.Hold(board.ID, e)
+				return nil
+			}
+		}
+		heldEvents.Release(board.ID, next)
+
+		err := next(e)
+		if err != nil {
+			if cerr := CheckAccess(board.ID); cerr != nil {
+				logger.Printf("Unable to check access to %s: %s\n", board.Name, cerr)
+			}
+		}
+		return err
+	}
+}
+
+// Alert logs something that needs a person to fix it, and posts it to the alertURL if there is one.
+func Alert(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	logger.Printf("ALERT: %s\n", msg)
+	if alertURL == "" {
+		return
+	}
+	if err := PostMessage(alertURL, msg); err != nil {
+		logger.Printf("Unable to post the alert: %s\n", err)
+	}
+}
+
+// PostMessage posts a message to a Slack or Mattermost style incoming webhook.
+func PostMessage(to, msg string) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{msg})
+	if err != nil {
+		return err
+	}
+	resp, err := alertClient.Post(to, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// Every change the watcher makes to the board goes through these functions,
+// so it is recorded on the affected card's timeline.
+
+// MoveCard moves a card to the given list.
+func MoveCard(c *trel.Card, l trel.List) error {
+	if err := c.Move(l.ID); err != nil {
+		return err
+	}
+	cardMoved(c, l)
+	return nil
+}
+
+// MoveCardToBottom moves a card to the bottom of the given list.
+// MoveCard leaves a card at the position it had, which can put it anywhere on its new list.
+func MoveCardToBottom(c *trel.Card, l trel.List) error {
+	if c.IDList == l.ID {
+		return nil
+	}
+	if err := MoveCardTo(c.ID, l.ID, "bottom"); err != nil {
+		return err
+	}
+	c.IDList = l.ID
+	cardMoved(c, l)
+	return nil
+}
+
+func cardMoved(c *trel.Card, l trel.List) {
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "moveCard", Detail: "moved to " + l.Name})
+	cycles.Moved(c.ID, c.Name, l.ID, Now())
+	if l.ID == board.Done.ID {
+		stats.Add(statTasksCompleted)
+	}
+}
+
+// NewCard creates a card at the bottom of the given list.
+func NewCard(l trel.List, name, desc string) (trel.Card, error) {
+	c, err := l.NewCard(name, desc, "bottom")
+	if err != nil {
+		return c, err
+	}
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "createCard", Detail: "created on " + l.Name})
+	stats.Add(statCardsCreated)
+	cycles.Moved(c.ID, c.Name, l.ID, Now())
+	return c, nil
+}
+
+// AssignCard adds a member to a card.
+func AssignCard(c trel.Card, memberID string) error {
+	if err := AddCardMember(c.ID, memberID); err != nil {
+		return err
+	}
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "assignCard", Detail: "assigned to " + memberID})
+	return nil
+}
+
+// UnassignCard removes a member from a card.
+func UnassignCard(cardID, memberID string) error {
+	if err := RemoveCardMember(cardID, memberID); err != nil {
+		return err
+	}
+	timeline.Add(cardID, TimelineEntry{Source: "watcher", Type: "unassignCard", Detail: "unassigned " + memberID})
+	return nil
+}
+
+// AddCheckItem adds an item to the first checklist on a project card,
+// making an "Inbox" checklist if the card has none.
+func AddCheckItem(project *trel.Card, name string) error {
+	cls, err := CardChecklistInfo(project.ID)
+	if err != nil {
+		return err
+	}
+	var clID string
+	if len(cls) > 0 {
+		clID = cls[0].ID
+	} else if clID, err = NewChecklist(project.ID, "Inbox"); err != nil {
+		return err
+	}
+	if err := NewCheckItem(clID, name, false, nil); err != nil {
+		return err
+	}
+	timeline.Add(project.ID, TimelineEntry{Source: "watcher", Type: "addCheckItem", Detail: name})
+	return nil
+}
+
+// LabelCard adds a label to a card.
+func LabelCard(cardID, labelID, name string) error {
+	if err := AddCardLabel(cardID, labelID); err != nil {
+		return err
+	}
+	timeline.Add(cardID, TimelineEntry{Source: "watcher", Type: "labelCard", Detail: "labeled " + name})
+	return nil
+}
+
+// UnlabelCard takes a label off a card.
+func UnlabelCard(cardID, labelID, name string) error {
+	if err := RemoveCardLabel(cardID, labelID); err != nil {
+		return err
+	}
+	timeline.Add(cardID, TimelineEntry{Source: "watcher", Type: "unlabelCard", Detail: "unlabeled " + name})
+	return nil
+}
+
+// RenameCard renames a card.
+func RenameCard(c *trel.Card, name string) error {
+	old := c.Name
+	if err := c.Rename(name); err != nil {
+		return err
+	}
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "renameCard", Detail: fmt.Sprintf("renamed from %q", old)})
+	return nil
+}
+
+// RenameTaskCheckItem renames a checklist item.
+func RenameTaskCheckItem(ci *trel.CheckItem, name string) error {
+	if err := RenameCheckItem(ci.Checklist.IDCard, ci.ID, name); err != nil {
+		return err
+	}
+	timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "renameCheckItem", Detail: fmt.Sprintf("%q renamed to %q", ci.Name, name)})
+	return nil
+}
+
+// RemoveCard deletes a card.
+func RemoveCard(c *trel.Card) error {
+	if err := DeleteCard(c.ID); err != nil {
+		return err
+	}
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "deleteCard", Detail: c.Name})
+	return nil
+}
+
+// Comment adds a comment to a card.
+func Comment(cardID, text string) error {
+	if err := CommentCard(cardID, text); err != nil {
+		return err
+	}
+	timeline.Add(cardID, TimelineEntry{Source: "watcher", Type: "commentCard", Detail: text})
+	return nil
+}
+
+// ArchiveCard archives a card.
+func ArchiveCard(c *trel.Card) error {
+	if err := CloseCard(c.ID); err != nil {
+		return err
+	}
+	timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "archiveCard", Detail: c.Name})
+	return nil
+}
+
+// RemoveCheckItem deletes a checklist item from its checklist.
+func RemoveCheckItem(ci *trel.CheckItem) error {
+	if err := DeleteCheckItem(ci.IDChecklist, ci.ID); err != nil {
+		return err
+	}
+	timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "deleteCheckItem", Detail: ci.Name})
+	return nil
+}
+
+// CompleteCheckItem marks a checklist item complete.
+func CompleteCheckItem(ci *trel.CheckItem) error {
+	if err := ci.Complete(); err != nil {
+		return err
+	}
+	timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "completeCheckItem", Detail: ci.Name})
+	stats.Add(statTasksCompleted)
+	return nil
+}
+
+// IncompleteCheckItem marks a checklist item incomplete.
+func IncompleteCheckItem(ci *trel.CheckItem) error {
+	if err := ci.Incomplete(); err != nil {
+		return err
+	}
+	timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "incompleteCheckItem", Detail: ci.Name})
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pause is set while automation is paused from the admin API.
+var pause struct {
+	sync.Mutex
+	since  time.Time
+	reason string
+}
+
+// Paused reports whether automation is paused, so events and scheduled jobs leave the board alone.
+func Paused() bool {
+	pause.Lock()
+	defer pause.Unlock()
+	return !pause.since.IsZero()
+}
+
+// PauseStatus is whether automation is paused, since when, and why.
+type PauseStatus struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+func pauseStatus() PauseStatus {
+	pause.Lock()
+	defer pause.Unlock()
+	if pause.since.IsZero() {
+		return PauseStatus{}
+	}
+	since := pause.since
+	return PauseStatus{Paused: true, Since: &since, Reason: pause.reason}
+}
+
+// PauseWhenPaused skips every Event while automation is paused.
+// Skipped events aren't handled after resuming, since they are usually the manual changes the pause was for.
+func PauseWhenPaused(next EventHandler) EventHandler {
+	return func(e Event) error {
+		if Paused() {
+			logger.Printf("Skipping %s: automation is paused\n", e.ActionType)
+			return nil
+		}
+		return next(e)
+	}
+}
+
+// pauseAPI serves POST /admin/pause, with an optional ?reason=, and POST /admin/resume.
+// Webhooks stay registered while paused, so resuming picks up right away.
+func pauseAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pause.Lock()
+	switch r.URL.Path {
+	case "/admin/pause":
+		if pause.since.IsZero() {
+			pause.since = Now()
+		}
+		pause.reason = r.URL.Query().Get("reason")
+		logger.Printf("Automation paused: %q\n", pause.reason)
+	case "/admin/resume":
+		if !pause.since.IsZero() {
+			logger.Printf("Automation resumed after %s\n", time.Since(pause.since))
+		}
+		pause.since, pause.reason = time.Time{}, ""
+	}
+	pause.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pauseStatus()); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// agingInterval is how often To Do cards are labeled by age, 0 to not label them.
+var agingInterval time.Duration
+
+// An AgingBucket is the label a To Do card gets while it is younger than Age.
+// The last bucket has no Age and holds everything older.
+type AgingBucket struct {
+	Label string
+	Color string
+	Age   time.Duration
+}
+
+var agingBuckets = []AgingBucket{
+	{Label: "age: ·", Color: "green", Age: 3 * 24 * time.Hour},
+	{Label: "age: ··", Color: "yellow", Age: 7 * 24 * time.Hour},
+	{Label: "age: ···", Color: "red"},
+}
+
+// agingLabels maps each aging label's ID to its bucket, once they exist on a board.
+// Label IDs are unique across boards, so every board's labels are kept together.
+var agingLabels = map[string]AgingBucket{}
+
+type Label struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// EnsureAgingLabels finds the aging labels on the board, making any that are missing,
+// and returns the board's aging labels by ID.
+func EnsureAgingLabels() (map[string]AgingBucket, error) {
+	var labels []Label
+	if err := apiDo(http.MethodGet, "boards/"+board.ID+"/labels", nil, &labels); err != nil {
+		return nil, err
+	}
+	byName := map[string]string{}
+	for _, l := range labels {
+		byName[l.Name] = l.ID
+	}
+
+	ids := map[string]AgingBucket{}
+	for _, b := range agingBuckets {
+		id, ok := byName[b.Label]
+		if !ok {
+			var l Label
+			params := url.Values{"name": {b.Label}, "color": {b.Color}, "idBoard": {board.ID}}
+			if err := apiDo(http.MethodPost, "labels", params, &l); err != nil {
+				return nil, err
+			}
+			id = l.ID
+		}
+		agingLabels[id] = b
+		ids[id] = b
+	}
+	return ids, nil
+}
+
+// IsAgingLabel reports whether a label is one of the watcher's aging labels.
+func IsAgingLabel(labelID string) bool {
+	_, ok := agingLabels[labelID]
+	return ok
+}
+
+// AgingBucketFor is the bucket a card that has been in To Do for age belongs in.
+func AgingBucketFor(age time.Duration) AgingBucket {
+	for _, b := range agingBuckets {
+		if b.Age == 0 || age < b.Age {
+			return b
+		}
+	}
+	return agingBuckets[len(agingBuckets)-1]
+}
+
+// ToDoSince is when a card was created or last moved between lists.
+func InListSince(cardID string) (time.Time, error) {
+	var actions []struct {
+		Date time.Time `json:"date"`
+	}
+	params := url.Values{"filter": {"createCard,copyCard,moveCardToBoard,updateCard:idList"}, "limit": {"1"}}
+	if err := apiDo(http.MethodGet, "cards/"+cardID+"/actions", params, &actions); err != nil {
+		return time.Time{}, err
+	}
+	if len(actions) == 0 {
+		// Actions this old are gone, so it has been there a long time.
+		return time.Time{}, nil
+	}
+	return actions[0].Date, nil
+}
+
+// UpdateAgingLabels gives every To Do card the label for its age, and takes them off Done cards.
+// Only labels that are wrong are changed, so running it again does nothing.
+func UpdateAgingLabels() error {
+	labels, err := EnsureAgingLabels()
+	if err != nil {
+		return err
+	}
+
+	todo, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return err
+	}
+	for _, c := range todo {
+		since, err := InListSince(c.ID)
+		if err != nil {
+			return err
+		}
+		want := AgingBucketFor(time.Since(since))
+
+		has := false
+		for _, id := range c.IDLabels {
+			b, ok := labels[id]
+			if !ok {
+				continue
+			}
+			if b.Label == want.Label {
+				has = true
+			} else if err := UnlabelCard(c.ID, id, b.Label); err != nil {
+				return err
+			}
+		}
+		if has {
+			continue
+		}
+		for id, b := range labels {
+			if b.Label == want.Label {
+				if err := LabelCard(c.ID, id, b.Label); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	done, err := ListCardInfo(board.Done.ID)
+	if err != nil {
+		return err
+	}
+	for _, c := range done {
+		for _, id := range c.IDLabels {
+			if b, ok := labels[id]; ok {
+				if err := UnlabelCard(c.ID, id, b.Label); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RunAgingLabels updates the aging labels every agingInterval.
+func RunAgingLabels() {
+	for range Schedule(agingInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(func() error {
+			if err := UpdateAgingLabels(); err != nil {
+				return fmt.Errorf("unable to update aging labels: %s", err)
+			}
+			usage.Record("aging-labels")
+			return nil
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// trel doesn't cover every part of the Trello API the watcher needs,
+// so these helpers make requests directly, in the same way trel does.
+
+// trelloClient sends apiDo's requests, through the transport set up by useTrelloTransport.
+var trelloClient = &http.Client{}
+
+// useTrelloTransport sends every Trello request through rt, and returns a func that puts the old transports back.
+// apiDo uses trelloClient, but trel v0.0.2 always sends with http.DefaultClient and can't be given a client,
+// so http.DefaultClient has to get the same transport until trel can.
+func useTrelloTransport(rt http.RoundTripper) func() {
+	oldClient, oldDefault := trelloClient.Transport, http.DefaultClient.Transport
+	trelloClient.Transport, http.DefaultClient.Transport = rt, rt
+	return func() { trelloClient.Transport, http.DefaultClient.Transport = oldClient, oldDefault }
+}
+
+// apiDo makes a request against the Trello API using trelClient's credentials.
+// If out is not nil, the response body is parsed into it, and it must be a pointer.
+func apiDo(method, path string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("key", trelClient.APIKey)
+	params.Set("token", trelClient.Token)
+	apiurl := trel.API_PREFIX + path + "?" + params.Encode()
+
+	req, err := http.NewRequest(method, apiurl, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := trelloClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return trel.HTTPRequestError{StatusCode: resp.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+type TokenPermission struct {
+	IDModel   string `json:"idModel"` // "*" for every model of the type.
+	ModelType string `json:"modelType"`
+	Read      bool   `json:"read"`
+	Write     bool   `json:"write"`
+}
+
+// CheckBoardPermissions ensures the token can write to the board,
+// so a read-only token is caught at startup instead of on the first card move.
+func CheckBoardPermissions(boardID string) error {
+	var token struct {
+		Permissions []TokenPermission `json:"permissions"`
+	}
+	err := apiDo(http.MethodGet, "tokens/"+trelClient.Token, url.Values{"fields": {"permissions"}}, &token)
+	if err != nil {
+		return fmt.Errorf("unable to read token permissions: %s", err)
+	}
+
+	for _, p := range token.Permissions {
+		if p.ModelType != "Board" || (p.IDModel != "*" && p.IDModel != boardID) {
+			continue
+		}
+		if p.Write {
+			return nil
+		}
+	}
+	return fmt.Errorf("the token does not have write access to board %s, generate a token with the \"write\" scope", boardID)
+}
+
+// UpdateCardDescription replaces a card's description.
+func UpdateCardDescription(cardID, desc string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID, url.Values{"desc": {desc}}, nil)
+}
+
+// CardInfo holds the card fields trel.Card doesn't have.
+type CardInfo struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	IDMembers        []string   `json:"idMembers"`
+	IDLabels         []string   `json:"idLabels"`
+	DateLastActivity time.Time  `json:"dateLastActivity"`
+	Due              *time.Time `json:"due"`
+	DueComplete      bool       `json:"dueComplete"`
+	Pos              float64    `json:"pos"`
+}
+
+// ListCardInfo fetches the CardInfo for every open card on a list.
+func ListCardInfo(listID string) ([]CardInfo, error) {
+	var cards []CardInfo
+	params := url.Values{"fields": {"name,idMembers,idLabels,dateLastActivity,due,dueComplete,pos"}}
+	err := apiDo(http.MethodGet, "lists/"+listID+"/cards", params, &cards)
+	return cards, err
+}
+
+// MoveCardTo moves a card to a position on a list, like "bottom".
+func MoveCardTo(cardID, listID, pos string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID, url.Values{"idList": {listID}, "pos": {pos}}, nil)
+}
+
+// AddCardLabel adds a label to a card.
+func AddCardLabel(cardID, labelID string) error {
+	return apiDo(http.MethodPost, "cards/"+cardID+"/idLabels", url.Values{"value": {labelID}}, nil)
+}
+
+// RemoveCardLabel takes a label off a card.
+func RemoveCardLabel(cardID, labelID string) error {
+	return apiDo(http.MethodDelete, "cards/"+cardID+"/idLabels/"+labelID, nil, nil)
+}
+
+// NewChecklist adds a checklist to a card and returns the new checklist's ID.
+func NewChecklist(cardID, name string) (string, error) {
+	var cl struct {
+		ID string `json:"id"`
+	}
+	err := apiDo(http.MethodPost, "cards/"+cardID+"/checklists", url.Values{"name": {name}}, &cl)
+	return cl.ID, err
+}
+
+// NewCheckItem adds an item to the bottom of a checklist, with an optional due date.
+func NewCheckItem(checklistID, name string, checked bool, due *time.Time) error {
+	params := url.Values{"name": {name}, "pos": {"bottom"}, "checked": {fmt.Sprint(checked)}}
+	if due != nil {
+		params.Set("due", due.Format(time.RFC3339))
+	}
+	return apiDo(http.MethodPost, "checklists/"+checklistID+"/checkItems", params, nil)
+}
+
+// ChecklistInfo is a checklist with the checklist item fields trel.CheckItem doesn't have.
+type ChecklistInfo struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	CheckItems []CheckItemInfo `json:"checkItems"`
+}
+
+type CheckItemInfo struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Due      *time.Time `json:"due"`
+	IDMember string     `json:"idMember"`
+	Pos      float64    `json:"pos"`
+}
+
+// CardChecklistInfo fetches a card's checklists, including checklist item due dates and members.
+func CardChecklistInfo(cardID string) ([]ChecklistInfo, error) {
+	var cls []ChecklistInfo
+	params := url.Values{"checkItem_fields": {"name,state,due,idMember,pos"}}
+	err := apiDo(http.MethodGet, "cards/"+cardID+"/checklists", params, &cls)
+	return cls, err
+}
+
+// CardURL fetches the link to a card.
+func CardURL(cardID string) (string, error) {
+	var card struct {
+		URL string `json:"url"`
+	}
+	err := apiDo(http.MethodGet, "cards/"+cardID, url.Values{"fields": {"url"}}, &card)
+	return card.URL, err
+}
+
+// RenameCheckItem renames a checklist item on a card.
+func RenameCheckItem(cardID, checkItemID, name string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID+"/checkItem/"+checkItemID, url.Values{"name": {name}}, nil)
+}
+
+// SetCheckItemState marks a checklist item on a card "complete" or "incomplete".
+func SetCheckItemState(cardID, checkItemID, state string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID+"/checkItem/"+checkItemID, url.Values{"state": {state}}, nil)
+}
+
+// DeleteCheckItem removes an item from a checklist.
+func DeleteCheckItem(checklistID, checkItemID string) error {
+	return apiDo(http.MethodDelete, "checklists/"+checklistID+"/checkItems/"+checkItemID, nil, nil)
+}
+
+// CommentCard adds a comment to a card.
+func CommentCard(cardID, text string) error {
+	return apiDo(http.MethodPost, "cards/"+cardID+"/actions/comments", url.Values{"text": {text}}, nil)
+}
+
+// CloseCard archives a card.
+func CloseCard(cardID string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID, url.Values{"closed": {"true"}}, nil)
+}
+
+// DeleteCard deletes a card for good.
+func DeleteCard(cardID string) error {
+	return apiDo(http.MethodDelete, "cards/"+cardID, nil, nil)
+}
+
+// DeleteChecklist removes a checklist and all of its items.
+func DeleteChecklist(checklistID string) error {
+	return apiDo(http.MethodDelete, "checklists/"+checklistID, nil, nil)
+}
+
+// NewList adds a list to a board, at "top", "bottom", or a position number.
+func NewList(boardID, name, pos string) (trel.List, error) {
+	var l trel.List
+	err := apiDo(http.MethodPost, "lists", url.Values{"name": {name}, "idBoard": {boardID}, "pos": {pos}}, &l)
+	return l, err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// specRegex matches attachment names that are reference documents for a project.
+var specRegex = regexp.MustCompile(`(?i)\b(spec|plan)\b`)
+
+type AttachmentChange struct {
+	Action struct {
+		ID   string `json:"id"`
+		Type string `json:"type"` // "addAttachmentToCard"
+		Data struct {
+			Card struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"card"`
+			Attachment struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"attachment"`
+		} `json:"data"`
+	} `json:"action"`
+}
+
+// Handle links spec and plan attachments on a project card from each of its task cards.
+func (ac AttachmentChange) Handle() error {
+	att := ac.Action.Data.Attachment
+	if !specRegex.MatchString(att.Name) || att.URL == "" {
+		return nil
+	}
+	usage.Record("spec-links")
+	logger.Printf("Spec %q added to card %s\n", att.Name, ac.Action.Data.Card.ID)
+
+	card, err := trelClient.Card(ac.Action.Data.Card.ID)
+	if err != nil {
+		return err
+	}
+	tasks, err := ProjectTaskCards(card)
+	if err != nil {
+		return err
+	}
+
+	link := att.Name + ": " + att.URL
+	for _, task := range tasks {
+		// Don't add the same link twice.
+		if strings.Contains(task.Description, att.URL) {
+			continue
+		}
+		desc := link
+		if task.Description != "" {
+			desc = task.Description + "\n\n" + link
+		}
+		if err := UpdateCardDescription(task.ID, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProjectTaskCards finds the cards on the To Do and Done lists for a project card's checklist items.
+func ProjectTaskCards(project trel.Card) (trel.Cards, error) {
+	checklists, err := project.Checklists()
+	if err != nil {
+		return nil, err
+	}
+	todoCards, err := board.ToDo.Cards()
+	if err != nil {
+		return nil, err
+	}
+	doneCards, err := AllCards(board.DoneLists()...)
+	if err != nil {
+		return nil, err
+	}
+	cards := append(todoCards, doneCards...)
+
+	var tasks trel.Cards
+	for _, cl := range checklists {
+		for _, ci := range cl.CheckItems {
+			if c, err := FindTaskCard(cards, ci.ID, project.Name, ci.Name); err == nil {
+				tasks = append(tasks, *c)
+			}
+		}
+	}
+	return tasks, nil
+}
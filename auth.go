@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminToken protects every route but Trello's callbacks and the health checks, empty to leave them open.
+var adminToken string
+
+// publicPatterns are the routes that stay open with an adminToken:
+// Trello's callbacks, which index serves, and the health checks probes make.
+var publicPatterns = map[string]bool{"/": true, "/healthz": true, "/readyz": true}
+
+// RequireAdmin wraps a mux so its routes, other than publicPatterns, need the adminToken,
+// as a bearer token, or as the password of basic auth with any user name, which browsers can send.
+func RequireAdmin(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); adminToken == "" || publicPatterns[pattern] {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		given := ""
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		} else if _, password, ok := r.BasicAuth(); ok {
+			given = password
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="trello-watcher"`)
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
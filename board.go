@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// listRoles are the lists the watcher needs, named as they are on a default board.
+var listRoles = []string{"Projects", "Active", "To Do", "Done", "Storage"}
+
+// watchedListNames are the lists, by role or name, that get list webhooks on every board.
+var watchedListNames []string
+
+// listNames maps a role to the name or ID of the list that fills it, when it isn't the role's own name.
+var listNames = map[string]string{}
+
+// SetListNames parses a comma separated list of role=list pairs, like "To Do=Zu erledigen,Done=Erledigt".
+func SetListNames(spec string) error {
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		role := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return fmt.Errorf("bad list name %q, use role=list", pair)
+		}
+		known := false
+		for _, r := range listRoles {
+			if r == role {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown list role %q, it must be one of %q", role, listRoles)
+		}
+		listNames[role] = strings.TrimSpace(kv[1])
+	}
+	return nil
+}
+
+// listName is the name or ID of the list that fills a role.
+func listName(role string) string {
+	if name, ok := listNames[role]; ok {
+		return name
+	}
+	return role
+}
+
+// doneArchiveName is the optional list Done is rolled into, empty when there isn't one.
+var doneArchiveName string
+
+type Board struct {
+	ID       string
+	Name     string
+	Projects trel.List
+	Active   trel.List
+	ToDo     trel.List
+	Done     trel.List
+	Storage  trel.List
+	// DoneArchive is optional, and has an empty ID when it isn't used.
+	DoneArchive trel.List
+	// Inbox is optional, and has an empty ID when it isn't used.
+	Inbox    trel.List
+	Webhooks trel.Webhooks
+	// WatchedLists are the lists that get list level webhooks.
+	// Any other list is left unwatched.
+	WatchedLists []trel.List
+}
+
+// Watches reports whether a list gets a list webhook on the board.
+func (b *Board) Watches(listID string) bool {
+	for _, l := range b.WatchedLists {
+		if l.ID == listID {
+			return true
+		}
+	}
+	return false
+}
+
+// UnwatchedWarnings says which of the features that are on need a list that isn't in -webhook-lists,
+// since they only see the changes made on watched lists.
+func (b *Board) UnwatchedWarnings() []string {
+	var warnings []string
+	need := func(on bool, l trel.List, feature, misses string) {
+		if on && !b.Watches(l.ID) {
+			warnings = append(warnings, fmt.Sprintf("%s misses %s on %s, since it isn't in -webhook-lists", feature, misses, l.Name))
+		}
+	}
+	need(cyclesFile != "", b.ToDo, "-cycles-file", "cards arriving from lists without webhooks")
+	for _, l := range []trel.List{b.ToDo, b.Done} {
+		need(true, l, "Renaming task cards", "renames")
+		need(onCardRemoved != "", l, "-on-card-removed", "removed task cards")
+	}
+	need(syncDue, b.ToDo, "-sync-due", "due date changes")
+	return warnings
+}
+
+// Lists returns pointers to each of the board's required lists.
+func (b *Board) Lists() []*trel.List {
+	return []*trel.List{&b.Projects, &b.Active, &b.ToDo, &b.Done, &b.Storage}
+}
+
+// DoneLists returns every list whose cards count as done.
+func (b *Board) DoneLists() []trel.List {
+	if b.DoneArchive.ID == "" {
+		return []trel.List{b.Done}
+	}
+	return []trel.List{b.Done, b.DoneArchive}
+}
+
+// IsDone reports whether a list, by name, is one of the DoneLists.
+func (b *Board) IsDone(name string) bool {
+	for _, l := range b.DoneLists() {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedLists returns the required lists that are archived.
+func (b *Board) ClosedLists() []trel.List {
+	var closed []trel.List
+	for _, l := range b.Lists() {
+		if l.Closed {
+			closed = append(closed, *l)
+		}
+	}
+	return closed
+}
+
+// RefreshLists updates the archived state and name of each required list.
+func (b *Board) RefreshLists() {
+	for _, l := range b.Lists() {
+		fresh, err := trelClient.List(l.ID)
+		if err != nil {
+			logger.Printf("Unable to refresh the %s list: %s\n", l.Name, err)
+			continue
+		}
+		l.Closed = fresh.Closed
+		b.RenameList(l.ID, fresh.Name)
+	}
+}
+
+// RenameList updates the name of the board list with the ID, wherever the board has it,
+// reporting whether it had it under another name.
+// Every list is compared by name, so a list renamed on Trello has to be renamed here too.
+func (b *Board) RenameList(id, name string) bool {
+	if id == "" || name == "" {
+		return false
+	}
+	lists := append(b.Lists(), &b.DoneArchive, &b.Inbox)
+	for i := range b.WatchedLists {
+		lists = append(lists, &b.WatchedLists[i])
+	}
+	renamed := false
+	for _, l := range lists {
+		if l.ID == id && l.Name != name {
+			if !renamed {
+				logger.Printf("The %s list was renamed to %s\n", l.Name, name)
+			}
+			l.Name = name
+			renamed = true
+		}
+	}
+	if renamed {
+		usage.Record("list-rename")
+	}
+	return renamed
+}
+
+// HandleListRename keeps the board's lists up to date when one of them is renamed on Trello.
+func (lc ListChange) HandleListRename() error {
+	board.RenameList(lc.Action.Data.List.ID, lc.Action.Data.List.Name)
+	return nil
+}
+
+// resolveList finds the list for a role by name, or by the ID it was last found with,
+// so a list that was renamed on Trello still fills its role.
+func resolveList(lists trel.Lists, boardID, role, name string) (trel.List, error) {
+	l, err := findOpenList(lists, name)
+	if err != nil {
+		id := state.RememberedList(boardID, role)
+		if id == "" {
+			return trel.List{}, err
+		}
+		if l, err = findOpenList(lists, id); err != nil {
+			return trel.List{}, err
+		}
+		logger.Printf("No list is named %q, using %q, the list that was %s before\n", name, l.Name, role)
+	}
+	state.RememberList(boardID, role, l.ID)
+	return l, nil
+}
+
+// ResolveBoard finds each required list on the trello board by name,
+// or by the ID it had when a list by that name was last found.
+// watchedNames are the lists, by role, name, or ID, that should get list webhooks.
+func ResolveBoard(tb trel.Board, watchedNames []string) (Board, error) {
+	lists, err := tb.Lists()
+	if err != nil {
+		return Board{}, fmt.Errorf("failed to retrieve board lists: %s", err)
+	}
+
+	lm := map[string]trel.List{}
+	for _, role := range listRoles {
+		l, err := resolveList(lists, tb.ID, role, listName(role))
+		if err != nil {
+			return Board{}, fmt.Errorf("the board needs a list named %q for %s", listName(role), role)
+		}
+		lm[role] = l
+	}
+
+	var archive trel.List
+	if doneArchiveName != "" {
+		if archive, err = resolveList(lists, tb.ID, "Done archive", doneArchiveName); err != nil {
+			return Board{}, fmt.Errorf("the board needs a list named %q to archive Done into", doneArchiveName)
+		}
+	}
+
+	var inbox trel.List
+	if inboxName != "" {
+		if inbox, err = resolveList(lists, tb.ID, "Inbox", inboxName); err != nil {
+			return Board{}, fmt.Errorf("the board needs a list named %q to triage new cards from", inboxName)
+		}
+	}
+
+	var watched []trel.List
+	for _, name := range watchedNames {
+		// The Inbox is always watched, below.
+		if name == inboxName {
+			continue
+		}
+		// A watched list can be given by its role, or by its name or ID on the board.
+		l, ok := lm[name]
+		for _, r := range listRoles {
+			if lm[r].Name == name || lm[r].ID == name {
+				l, ok = lm[r], true
+			}
+		}
+		if !ok {
+			return Board{}, fmt.Errorf("unable to watch %q, it must be one of %q", name, listRoles)
+		}
+		// A list can be named more than once, by its role and its name.
+		seen := false
+		for _, w := range watched {
+			seen = seen || w.ID == l.ID
+		}
+		if !seen {
+			watched = append(watched, l)
+		}
+	}
+	if inbox.ID != "" {
+		watched = append(watched, inbox)
+	}
+
+	return Board{
+		ID:       tb.ID,
+		Name:     tb.Name,
+		Projects: lm["Projects"],
+		Active:   lm["Active"],
+		ToDo:     lm["To Do"],
+		Done:     lm["Done"],
+		Storage:  lm["Storage"],
+
+		DoneArchive: archive,
+		Inbox:       inbox,
+
+		WatchedLists: watched,
+	}, nil
+}
+
+// findOpenList prefers an open list over an archived one with the same name,
+// so a list that was archived and recreated resolves to the new list.
+// A list can also be found by its ID.
+func findOpenList(lists trel.Lists, name string) (trel.List, error) {
+	l, err := lists.Find(name)
+	if err != nil {
+		for _, other := range lists {
+			if other.ID == name {
+				return other, nil
+			}
+		}
+		return trel.List{}, err
+	}
+	for _, other := range lists {
+		if other.Name == name && !other.Closed {
+			return other, nil
+		}
+	}
+	return *l, nil
+}
+
+// Reresolve looks up the board lists by name again, picking up lists that were renamed,
+// and ensures webhooks exist for any watched list that has a new ID.
+func (b *Board) Reresolve() error {
+	tb, err := trelClient.Board(b.ID)
+	if err != nil {
+		return err
+	}
+	var watchedNames []string
+	for _, l := range b.WatchedLists {
+		// The Inbox is always watched, and a list that fills a role is watched by role,
+		// so neither depends on the list keeping its name.
+		if l.ID == b.Inbox.ID {
+			continue
+		}
+		name := l.Name
+		for i, rl := range b.Lists() {
+			if rl.ID == l.ID {
+				name = listRoles[i]
+			}
+		}
+		watchedNames = append(watchedNames, name)
+	}
+	fresh, err := ResolveBoard(tb, watchedNames)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	freshLists := fresh.Lists()
+	for i, l := range b.Lists() {
+		if l.ID != freshLists[i].ID {
+			logger.Printf("The %s list changed from %s to %s\n", l.Name, l.ID, freshLists[i].ID)
+			changed = true
+		}
+	}
+	fresh.Webhooks = b.Webhooks
+	*b = fresh
+	if !changed {
+		return nil
+	}
+	usage.Record("list-reresolve")
+	return EnsureListWebhooks()
+}
+
+// createMissingLists makes the board's lists that don't exist on startup, instead of refusing to start.
+var createMissingLists bool
+
+// CreateMissingLists makes every list the board is missing, each in its place in listRoles order.
+func CreateMissingLists(boardID string) error {
+	for _, role := range listRoles {
+		if err := CreateRoleList(boardID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRoleList makes the list for a role if the board has no open list for it,
+// between the lists for the roles before and after it, so the board reads in the usual order.
+func CreateRoleList(boardID, role string) error {
+	var lists []struct {
+		ID   string  `json:"id"`
+		Name string  `json:"name"`
+		Pos  float64 `json:"pos"`
+	}
+	err := apiDo(http.MethodGet, "boards/"+boardID+"/lists", url.Values{"filter": {"open"}, "fields": {"name,pos"}}, &lists)
+	if err != nil {
+		return err
+	}
+	pos := map[string]float64{}
+	for _, l := range lists {
+		for _, r := range listRoles {
+			if name := listName(r); l.Name == name || l.ID == name {
+				if _, ok := pos[r]; !ok {
+					pos[r] = l.Pos
+				}
+			}
+		}
+	}
+	if _, ok := pos[role]; ok {
+		return nil
+	}
+
+	// Go after the closest earlier role's list, and before the closest later one's.
+	i := indexOf(listRoles, role)
+	var before, after float64
+	hasBefore, hasAfter := false, false
+	for j := i - 1; j >= 0 && !hasBefore; j-- {
+		before, hasBefore = pos[listRoles[j]]
+	}
+	for j := i + 1; j < len(listRoles) && !hasAfter; j++ {
+		after, hasAfter = pos[listRoles[j]]
+	}
+	where := "bottom"
+	switch {
+	case hasBefore && hasAfter:
+		where = strconv.FormatFloat((before+after)/2, 'f', -1, 64)
+	case hasAfter:
+		where = "top"
+	}
+
+	if _, err := NewList(boardID, listName(role), where); err != nil {
+		return fmt.Errorf("unable to make a list named %q for %s: %s", listName(role), role, err)
+	}
+	logger.Printf("Made a list named %q for %s\n", listName(role), role)
+	return nil
+}
+
+func indexOf(s []string, v string) int {
+	for i := range s {
+		if s[i] == v {
+			return i
+		}
+	}
+	return -1
+}
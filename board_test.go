@@ -0,0 +1,58 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestUnwatchedWarnings checks that the features that are on warn about the lists they need that aren't watched.
+func TestUnwatchedWarnings(t *testing.T) {
+	_, boardID := watchFake(t)
+	oldCycles, oldRemoved, oldDue := cyclesFile, onCardRemoved, syncDue
+	t.Cleanup(func() { cyclesFile, onCardRemoved, syncDue = oldCycles, oldRemoved, oldDue })
+
+	tests := []struct {
+		watched       string
+		cyclesFile    string
+		onCardRemoved string
+		syncDue       bool
+		want          []string
+	}{
+		{"Active,To Do,Done", "cycles.json", "recreate", true, nil},
+		{"Active,Done", "", "", false, []string{"Renaming task cards misses renames on To Do"}},
+		{"Active,Done", "cycles.json", "", true, []string{
+			"-cycles-file misses cards arriving from lists without webhooks on To Do",
+			"Renaming task cards misses renames on To Do",
+			"-sync-due misses due date changes on To Do",
+		}},
+		{"Active", "", "complete", false, []string{
+			"Renaming task cards misses renames on To Do",
+			"-on-card-removed misses removed task cards on To Do",
+			"Renaming task cards misses renames on Done",
+			"-on-card-removed misses removed task cards on Done",
+		}},
+	}
+	for _, tt := range tests {
+		cyclesFile, onCardRemoved, syncDue = tt.cyclesFile, tt.onCardRemoved, tt.syncDue
+		tb, err := trelClient.Board(boardID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ResolveBoard(tb, strings.Split(tt.watched, ","))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := b.UnwatchedWarnings()
+		if len(got) != len(tt.want) {
+			t.Errorf("watching %s, got warnings %q, want %q", tt.watched, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], tt.want[i]) {
+				t.Errorf("watching %s, warning %d = %q, want it to start %q", tt.watched, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
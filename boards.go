@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// boards are every board being watched, in the order they were given.
+// The board global is whichever of them is being worked on, see WithBoard.
+// Only their IDs and names are fixed after startup, so everything else about them is
+// read and changed through WithBoard or ForEachBoard, which hold boardMu.
+var boards []*Board
+
+// boardMu is held while the board global is set to one of the boards,
+// so startup, scheduled jobs, webhooks, and API requests never change a board at the same time.
+var boardMu sync.Mutex
+
+// boardPath finds the board in a webhook callback path like /boards/{board}/list/{list}.
+var boardPath = regexp.MustCompile("^/boards/([^/]+)/")
+
+// FindBoard finds a watched board by ID, or the first board if id is empty.
+func FindBoard(id string) (*Board, bool) {
+	if id == "" && len(boards) > 0 {
+		return boards[0], true
+	}
+	for _, b := range boards {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// WithBoard sets the board global to the watched board with the ID, empty for the first one, while f runs.
+// Only one board is worked on at a time, so everything built around the board global works for every board.
+func WithBoard(id string, f func() error) error {
+	b, ok := FindBoard(id)
+	if !ok {
+		return BoardNotFoundError(id)
+	}
+	boardMu.Lock()
+	defer boardMu.Unlock()
+	board = *b
+	defer func() { *b = board }()
+	return f()
+}
+
+// ForEachBoard runs f with each watched board in turn, see WithBoard.
+// Boards the watcher has lost access to are skipped.
+func ForEachBoard(f func() error) {
+	for _, b := range boards {
+		if _, lost := AccessLost(b.ID); lost {
+			continue
+		}
+		if err := WithBoard(b.ID, f); err != nil {
+			logger.Printf("%s: %s\n", b.Name, err)
+		}
+	}
+}
+
+type BoardNotFoundError string
+
+func (id BoardNotFoundError) Error() string {
+	return "not watching board " + string(id)
+}
+
+// boardHandler runs an http handler with the board named by the "board" query parameter,
+// or the first board when there isn't one.
+func boardHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := WithBoard(r.URL.Query().Get("board"), func() error {
+			h(w, r)
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	}
+}
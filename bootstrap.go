@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BootstrapCommand makes a new board with the lists the watcher needs, imports projects into it,
+// and sets up its webhooks when -host is given, then prints the -board to run the watcher with.
+//
+//	trello-watcher [flags] bootstrap [-name board] [file...]
+//
+// Files are Markdown, todo.txt, or CSV projects, see ImportCommand and ParseCSV.
+func BootstrapCommand(args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	name := fs.String("name", "Projects", "name of the new board")
+	fs.Parse(args)
+
+	var projects []TodoList
+	for _, path := range fs.Args() {
+		tls, err := readProjects(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		projects = append(projects, tls...)
+	}
+
+	var created struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	err := apiDo(http.MethodPost, "boards", url.Values{"name": {*name}, "defaultLists": {"false"}}, &created)
+	if err != nil {
+		return fmt.Errorf("unable to make the board: %s", err)
+	}
+	if err := CreateMissingLists(created.ID); err != nil {
+		return err
+	}
+
+	tb, err := trelClient.Board(created.ID)
+	if err != nil {
+		return err
+	}
+	b, err := ResolveBoard(tb, watchedListNames)
+	if err != nil {
+		return err
+	}
+	boards = append(boards, &b)
+
+	err = WithBoard(b.ID, func() error {
+		for _, tl := range projects {
+			if err := ImportTodoList(tl); err != nil {
+				return err
+			}
+		}
+		if host != "" && !polling() {
+			SetupInitialWebhooks()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Made board %q at %s\nRun the watcher with -board %s\n", *name, created.URL, created.ID)
+	return nil
+}
+
+// readProjects reads the projects in a Markdown, todo.txt, or CSV file, by its extension.
+func readProjects(path string) ([]TodoList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tl TodoList
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ParseCSV(f)
+	case ".md", ".markdown":
+		tl, err = ParseMarkdown(f)
+	default:
+		tl, err = ParseTodoTxt(f)
+	}
+	if tl.Name == "" {
+		tl.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return []TodoList{tl}, err
+}
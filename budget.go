@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// budgetInterval is how often Active project budgets are totalled, 0 to not total them.
+var budgetInterval time.Duration
+
+// budgetLine is a "budget: 20h" line in a project card description, in hours or days like "3d".
+var budgetLine = regexp.MustCompile(`(?im)^\s*budget:\s*(\S+)\s*$`)
+
+// spentLine is the line the watcher keeps the running total on, under the budget line.
+var spentLine = regexp.MustCompile(`(?im)^\s*spent:.*$`)
+
+// overBudget marks a spent line whose total is over the budget.
+const overBudget = "(over budget)"
+
+// ProjectBudget reads the budget from a project card description, if it has one.
+func ProjectBudget(desc string) (time.Duration, bool) {
+	m := budgetLine.FindStringSubmatch(desc)
+	if m == nil {
+		return 0, false
+	}
+	budget, err := ParseDays(m[1])
+	if err != nil || budget <= 0 {
+		return 0, false
+	}
+	return budget, true
+}
+
+// hours is a duration in hours for people, like "12.5h".
+func hours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', -1, 64) + "h"
+}
+
+// WithSpent puts the spent line for a total against a budget into a project card description,
+// replacing the one already there, or adding it under the budget line.
+func WithSpent(desc string, spent, budget time.Duration) string {
+	line := fmt.Sprintf("spent: %s of %s", hours(spent.Truncate(6*time.Minute)), hours(budget))
+	if spent > budget {
+		line += " " + overBudget
+	}
+	if spentLine.MatchString(desc) {
+		return spentLine.ReplaceAllLiteralString(desc, line)
+	}
+	loc := budgetLine.FindStringIndex(desc)
+	return desc[:loc[1]] + "\n" + line + desc[loc[1]:]
+}
+
+// UpdateBudgets keeps a running total of the time each Active project's task cards have spent in To Do,
+// from the -cycles-file, on the spent line of each project card with a budget line,
+// and comments on the project card when it goes over budget.
+func UpdateBudgets() error {
+	projects, err := board.Active.Cards()
+	if err != nil {
+		return err
+	}
+	// Tasks are put under their project card's ID, by the checklist item they are known to be for.
+	byItem := map[string]string{}
+	for _, p := range projects {
+		if _, ok := ProjectBudget(p.Description); !ok {
+			continue
+		}
+		cls, err := p.Checklists()
+		if err != nil {
+			return err
+		}
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				byItem[ci.ID] = p.ID
+			}
+		}
+	}
+	if len(byItem) == 0 {
+		return nil
+	}
+	spent := map[string]time.Duration{}
+	for _, t := range cycles.TaskCycles(Now(), byItem) {
+		if t.Project != "" && t.InToDo != nil {
+			spent[t.Project] += *t.InToDo
+		}
+	}
+
+	for _, p := range projects {
+		budget, ok := ProjectBudget(p.Description)
+		if !ok {
+			continue
+		}
+		desc := WithSpent(p.Description, spent[p.ID], budget)
+		if desc == p.Description {
+			continue
+		}
+		if err := UpdateCardDescription(p.ID, desc); err != nil {
+			return err
+		}
+		// The spent line only gets the mark when the total goes over, so the warning is made once.
+		if strings.Contains(desc, overBudget) && !strings.Contains(p.Description, overBudget) {
+			msg := fmt.Sprintf("%s is over its %s budget, its tasks have spent %s in %s.", ProjectName(p.Name), hours(budget), hours(spent[p.ID].Truncate(6*time.Minute)), board.ToDo.Name)
+			if err := Comment(p.ID, msg); err != nil {
+				return err
+			}
+			logger.Printf("%s is over its %s budget\n", p.Name, hours(budget))
+			usage.Record("budget-exceeded")
+		}
+	}
+	return nil
+}
+
+// RunBudgets totals Active project budgets every budgetInterval.
+func RunBudgets() {
+	for range Schedule(budgetInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(func() error {
+			if err := UpdateBudgets(); err != nil {
+				return fmt.Errorf("unable to update project budgets: %s", err)
+			}
+			return nil
+		})
+	}
+}
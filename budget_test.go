@@ -0,0 +1,75 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithSpent(t *testing.T) {
+	tests := []struct {
+		desc  string
+		spent time.Duration
+		want  string
+	}{
+		{"Ship it.\nbudget: 20h", 90 * time.Minute, "Ship it.\nbudget: 20h\nspent: 1.5h of 20h"},
+		{"budget: 20h\nspent: 1.5h of 20h\nmore", 21 * time.Hour, "budget: 20h\nspent: 21h of 20h (over budget)\nmore"},
+		{"budget: 20h\nspent: 21h of 20h (over budget)", 25*time.Hour + time.Minute, "budget: 20h\nspent: 25h of 20h (over budget)"},
+	}
+	for _, tt := range tests {
+		if got := WithSpent(tt.desc, tt.spent, 20*time.Hour); got != tt.want {
+			t.Errorf("WithSpent(%q, %s) = %q, want %q", tt.desc, tt.spent, got, tt.want)
+		}
+	}
+}
+
+// TestUpdateBudgets checks that an Active project's spent line totals its tasks' time in To Do,
+// and that it's commented on once when it goes over budget.
+func TestUpdateBudgets(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	project.Desc = "budget: 3h"
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	write := fake.AddCard(board.ToDo.ID, "write")
+	ship := fake.AddCard(board.ToDo.ID, "ship")
+	state.Link(cl.CheckItems[0].ID, write.ID)
+	state.Link(cl.CheckItems[1].ID, ship.ID)
+	cycles.Moved(write.ID, write.Name, board.ToDo.ID, Now().Add(-2*time.Hour))
+	cycles.Moved(ship.ID, ship.Name, board.ToDo.ID, Now().Add(-30*time.Minute))
+
+	comments := func() int {
+		n := 0
+		for _, a := range fake.Actions {
+			if a.Type == "commentCard" && a.card == project.ID {
+				n++
+			}
+		}
+		return n
+	}
+	if err := UpdateBudgets(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "budget: 3h\nspent: 2.5h of 3h"; project.Desc != want {
+		t.Errorf("description = %q, want %q", project.Desc, want)
+	}
+	if comments() != 0 {
+		t.Errorf("commented while under budget")
+	}
+
+	// Both tasks have been in To Do two hours now.
+	cycles = &Cycles{Cards: map[string]*CardCycle{}}
+	cycles.Moved(write.ID, write.Name, board.ToDo.ID, Now().Add(-2*time.Hour))
+	cycles.Moved(ship.ID, ship.Name, board.ToDo.ID, Now().Add(-2*time.Hour))
+	for i := 0; i < 2; i++ {
+		if err := UpdateBudgets(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "budget: 3h\nspent: 4h of 3h (over budget)"; project.Desc != want {
+		t.Errorf("description = %q, want %q", project.Desc, want)
+	}
+	if got := comments(); got != 1 {
+		t.Errorf("commented %d times over budget, want 1", got)
+	}
+}
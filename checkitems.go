@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// onCheckItemRemoved is what happens to the task cards of checklist items removed from an Active project card:
+// "delete" or "store" them, or "" to leave them.
+var onCheckItemRemoved string
+
+// HandleCheckItemsAdded makes or brings back the task cards for checklist items added to an Active project card,
+// so they show up on To Do without waiting for the project to be activated again.
+func (cic CheckItemChange) HandleCheckItemsAdded() error {
+	plan, err := cic.PlanCheckItemsAdded()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = cic.Action.ID
+	plan.UpdateProgress(cic.Action.Data.Card.ID, cic.Action.Data.Card.Name)
+	return RunPlan(plan)
+}
+
+// PlanCheckItemsAdded works out which task cards are missing after a checklist or checklist item was added.
+// It plans the project's activation again, which only makes or moves the cards that are missing.
+func (cic CheckItemChange) PlanCheckItemsAdded() (Plan, error) {
+	card, err := trelClient.Card(cic.Action.Data.Card.ID)
+	if err != nil {
+		return Plan{}, err
+	}
+	if card.IDList != board.Active.ID {
+		return Plan{Operation: fmt.Sprintf("adding to inactive %q", card.Name)}, nil
+	}
+	plan, err := PlanActivation(card)
+	plan.Operation = fmt.Sprintf("adding to %q", card.Name)
+	plan.Feature = "checklist-added"
+	return plan, err
+}
+
+// HandleCheckItemsRemoved deletes or stores the task cards of checklist items removed from an Active project card,
+// as -on-checkitem-removed says.
+func (cic CheckItemChange) HandleCheckItemsRemoved() error {
+	plan, err := cic.PlanCheckItemsRemoved()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = cic.Action.ID
+	plan.UpdateProgress(cic.Action.Data.Card.ID, cic.Action.Data.Card.Name)
+	return RunPlan(plan)
+}
+
+// PlanCheckItemsRemoved works out which task cards are left over after a checklist item or checklist was removed.
+// A removed checklist's items aren't sent, so its cards are those linked to items no Active project card has anymore.
+func (cic CheckItemChange) PlanCheckItemsRemoved() (Plan, error) {
+	plan := Plan{Operation: fmt.Sprintf("removing from %q", cic.Action.Data.Card.Name), Feature: "checklist-removed"}
+	if onCheckItemRemoved == "" {
+		// The card is left where it is, but no longer the item's, so it can be matched by name again.
+		if cic.Action.Type == "deleteCheckItem" {
+			state.Unlink(cic.Action.Data.CheckItem.ID)
+		}
+		return plan, nil
+	}
+	lists := append(board.DoneLists(), board.ToDo)
+	cards, err := AllCards(lists...)
+	if err != nil {
+		return plan, err
+	}
+
+	var removed []*trel.Card
+	if cic.Action.Type == "deleteCheckItem" {
+		ciID := cic.Action.Data.CheckItem.ID
+		c, err := FindTaskCard(cards, ciID, cic.Action.Data.Card.Name, cic.Action.Data.CheckItem.Name)
+		if _, ok := err.(trel.NotFoundError); ok {
+			return plan, nil
+		} else if err != nil {
+			return plan, err
+		}
+		state.Unlink(ciID)
+		removed = append(removed, c)
+	} else {
+		present, err := activeCheckItems()
+		if err != nil {
+			return plan, err
+		}
+		for i := range cards {
+			if ciID, ok := state.TaskCheckItem(cards[i].ID); ok && !present[ciID] {
+				state.Unlink(ciID)
+				removed = append(removed, &cards[i])
+			}
+		}
+	}
+
+	for _, c := range removed {
+		var from trel.List
+		for _, l := range lists {
+			if l.ID == c.IDList {
+				from = l
+			}
+		}
+		switch onCheckItemRemoved {
+		case "delete":
+			plan.RemoveCard(c, from)
+		case "store":
+			plan.Move(c, from, board.Storage)
+		}
+	}
+	return plan, nil
+}
+
+// activeCheckItems is the IDs of every checklist item on the Active project cards.
+func activeCheckItems() (map[string]bool, error) {
+	projects, err := board.Active.Cards()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, p := range projects {
+		cls, err := p.Checklists()
+		if err != nil {
+			return nil, err
+		}
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				ids[ci.ID] = true
+			}
+		}
+	}
+	return ids, nil
+}
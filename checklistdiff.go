@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// PlanChecklistEdit works out the changes that turn a project card's checklists into the edited TodoList.
+// Items are matched by name. Unmatched items at the same position in the same checklist are treated as renames,
+// and renames are carried over to the item's To Do, Done, or Storage card.
+func PlanChecklistEdit(card *trel.Card, edited TodoList) (Plan, error) {
+	plan := Plan{Operation: "editing the checklists of " + card.Name}
+
+	current, err := CardChecklistInfo(card.ID)
+	if err != nil {
+		return plan, err
+	}
+	taskCards, err := AllCards(append(board.DoneLists(), board.ToDo, board.Storage)...)
+	if err != nil {
+		return plan, err
+	}
+	active := card.IDList == board.Active.ID
+
+	existing := map[string]ChecklistInfo{}
+	for _, cl := range current {
+		existing[cl.Name] = cl
+	}
+
+	for _, tc := range edited.Checklists {
+		cl, ok := existing[tc.Name]
+		if !ok {
+			planNewChecklist(&plan, card, tc, active)
+			continue
+		}
+		delete(existing, tc.Name)
+		planChecklistItems(&plan, card, cl, tc, taskCards, active)
+	}
+
+	// Whatever is left was removed from the text.
+	for _, cl := range existing {
+		checklistID := cl.ID
+		plan.Changes = append(plan.Changes, Change{
+			Op: "removeChecklist", Card: cl.Name,
+			apply: func() error { return DeleteChecklist(checklistID) },
+		})
+	}
+
+	return plan, nil
+}
+
+func planNewChecklist(plan *Plan, card *trel.Card, tc TodoChecklist, active bool) {
+	plan.Changes = append(plan.Changes, Change{
+		Op: "addChecklist", Card: tc.Name,
+		apply: func() error {
+			id, err := NewChecklist(card.ID, tc.Name)
+			if err != nil {
+				return err
+			}
+			for _, item := range tc.Items {
+				if err := NewCheckItem(id, item.Name, item.Complete, item.Due); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	if active {
+		for _, item := range tc.Items {
+			planTaskCard(plan, card, item)
+		}
+	}
+}
+
+func planChecklistItems(plan *Plan, card *trel.Card, cl ChecklistInfo, tc TodoChecklist, taskCards trel.Cards, active bool) {
+	cardID := card.ID
+	matchedOld := map[int]bool{}
+	matchedNew := map[int]bool{}
+	for i, ci := range cl.CheckItems {
+		for j, item := range tc.Items {
+			if !matchedNew[j] && ci.Name == item.Name {
+				matchedOld[i], matchedNew[j] = true, true
+				planCheckItemState(plan, cardID, ci, item)
+				break
+			}
+		}
+	}
+
+	for i, ci := range cl.CheckItems {
+		if matchedOld[i] {
+			continue
+		}
+		ci := ci
+		// An unmatched item in the same spot is a rename.
+		if i < len(tc.Items) && !matchedNew[i] {
+			matchedNew[i] = true
+			item := tc.Items[i]
+			plan.Changes = append(plan.Changes, Change{
+				Op: "renameCheckItem", Card: ci.Name, From: ci.Name, To: item.Name,
+				apply: func() error { return RenameCheckItem(cardID, ci.ID, item.Name) },
+			})
+			if c, err := FindTaskCard(taskCards, ci.ID, card.Name, ci.Name); err == nil {
+				plan.RenameCard(c, RenamedTaskCardName(card.Name, c.Name, item.Name))
+			}
+			planCheckItemState(plan, cardID, ci, item)
+			continue
+		}
+		checklistID := cl.ID
+		plan.Changes = append(plan.Changes, Change{
+			Op: "removeCheckItem", Card: ci.Name, From: cl.Name,
+			apply: func() error { return DeleteCheckItem(checklistID, ci.ID) },
+		})
+	}
+
+	for j, item := range tc.Items {
+		if matchedNew[j] {
+			continue
+		}
+		item := item
+		checklistID := cl.ID
+		plan.Changes = append(plan.Changes, Change{
+			Op: "addCheckItem", Card: item.Name, To: cl.Name,
+			apply: func() error { return NewCheckItem(checklistID, item.Name, item.Complete, item.Due) },
+		})
+		if active {
+			planTaskCard(plan, card, item)
+		}
+	}
+}
+
+func planCheckItemState(plan *Plan, cardID string, ci CheckItemInfo, item TodoItem) {
+	state := "incomplete"
+	if item.Complete {
+		state = "complete"
+	}
+	if ci.State == state {
+		return
+	}
+	checkItemID := ci.ID
+	plan.Changes = append(plan.Changes, Change{
+		Op: state + "CheckItem", Card: item.Name,
+		apply: func() error { return SetCheckItemState(cardID, checkItemID, state) },
+	})
+}
+
+// planTaskCard creates the To Do or Done card for a new item on an active project.
+func planTaskCard(plan *Plan, project *trel.Card, item TodoItem) {
+	if IsCheckItemOnly(item.Name) {
+		return
+	}
+	list := board.ToDo
+	if item.Complete {
+		list = board.Done
+	}
+	plan.CreateFor(TaskCardName(project.Name, item.Name), list, "", "", project.ID)
+}
+
+// projectsAPI serves POST /api/projects/{name}/checklist,
+// which applies an edited Markdown version of a project's checklists (as written by export-project).
+// With ?dry-run=true the planned changes are returned without being applied.
+func projectsAPI(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/projects/"), "/")
+	if r.Method != http.MethodPost || !strings.HasSuffix(path, "/checklist") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimSuffix(path, "/checklist")
+
+	card, err := FindProjectCard(name)
+	if _, ok := err.(trel.NotFoundError); ok {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	edited, err := ParseMarkdown(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := PlanChecklistEdit(card, edited)
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("dry-run") != "true" {
+		usage.Record("checklist-edit")
+		if err := CheckGuardrail(plan); err != nil {
+			http.Error(w, err.Error(), http.StatusAccepted)
+			return
+		}
+		if err := ApplyPlan(plan); err != nil {
+			logger.Println(err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		logger.Println(err)
+	}
+}
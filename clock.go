@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// location is the timezone days and weeks are counted in, which may not be the server's.
+var location = time.Local
+
+// weekStart is the day weeks start on.
+var weekStart = time.Sunday
+
+// SetClock sets location and weekStart from an IANA timezone name, empty for the server's,
+// and a weekday name.
+func SetClock(timezone, start string) error {
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q: %s", timezone, err)
+		}
+		location = loc
+	}
+
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), start) {
+			weekStart = d
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown week start %q, use a day name like \"monday\"", start)
+}
+
+// Now is the current time in location.
+func Now() time.Time {
+	return time.Now().In(location)
+}
+
+// StartOfDay is midnight at the start of t's day in location.
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
+
+// StartOfWeek is midnight at the start of t's week in location.
+func StartOfWeek(t time.Time) time.Time {
+	day := StartOfDay(t)
+	back := (int(day.Weekday()) - int(weekStart) + 7) % 7
+	return day.AddDate(0, 0, -back)
+}
+
+// Schedule ticks every interval, like time.Tick.
+// Intervals of whole weeks tick at the start of the week, and intervals of whole days tick at midnight,
+// so a weekly job runs when the week turns over in location rather than a week after the server started.
+func Schedule(interval time.Duration) <-chan time.Time {
+	const day, week = 24 * time.Hour, 7 * 24 * time.Hour
+	if interval <= 0 || interval%day != 0 {
+		return time.Tick(interval)
+	}
+
+	days := int(interval / day)
+	next := StartOfDay(Now()).AddDate(0, 0, 1)
+	if interval%week == 0 {
+		next = StartOfWeek(Now()).AddDate(0, 0, 7)
+	}
+	return tickFrom(next, days)
+}
+
+// DailyAt ticks every day at a time of day in location, like "21:30".
+func DailyAt(clock string) (<-chan time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return nil, fmt.Errorf("bad time of day %q, use a 24 hour time like \"21:30\"", clock)
+	}
+	day := StartOfDay(Now())
+	next := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, location)
+	if !next.After(Now()) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return tickFrom(next, 1), nil
+}
+
+// WeeklyAt ticks every week on a day at a time of day in location, like "monday 09:00".
+func WeeklyAt(when string) (<-chan time.Time, error) {
+	fields := strings.Fields(when)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("bad weekly time %q, use a day and a 24 hour time like \"monday 09:00\"", when)
+	}
+	weekday := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), fields[0]) {
+			weekday = int(d)
+		}
+	}
+	t, err := time.Parse("15:04", fields[1])
+	if weekday < 0 || err != nil {
+		return nil, fmt.Errorf("bad weekly time %q, use a day and a 24 hour time like \"monday 09:00\"", when)
+	}
+	day := StartOfDay(Now())
+	day = day.AddDate(0, 0, (weekday-int(day.Weekday())+7)%7)
+	next := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, location)
+	if !next.After(Now()) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return tickFrom(next, 7), nil
+}
+
+// tickFrom ticks at next, and every number of days after, keeping to the same time of day across DST changes.
+func tickFrom(next time.Time, days int) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	go func() {
+		for {
+			time.Sleep(time.Until(next))
+			select {
+			case c <- Now():
+			default:
+				// Drop the tick if the last one is still being handled, like time.Tick.
+			}
+			next = next.AddDate(0, 0, days)
+		}
+	}()
+	return c
+}
+
+// ParseDays parses a Go duration, or a whole number of days like "30d", which Go durations don't have.
+func ParseDays(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
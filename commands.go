@@ -0,0 +1,480 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// ImportCommand creates a Projects card from a todo.txt or Markdown file.
+//
+//	trello-watcher [flags] import [-name project] [-format markdown|todotxt] file
+func ImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	name := fs.String("name", "", "project card name (defaults to the Markdown title or the file name)")
+	format := fs.String("format", "", "markdown or todotxt (defaults to guessing from the file extension)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("import needs exactly one file")
+	}
+	path := fs.Arg(0)
+
+	if *format == "" {
+		*format = "todotxt"
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown":
+			*format = "markdown"
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var tl TodoList
+	switch *format {
+	case "markdown":
+		tl, err = ParseMarkdown(f)
+	case "todotxt":
+		tl, err = ParseTodoTxt(f)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *name != "" {
+		tl.Name = *name
+	}
+	if tl.Name == "" {
+		tl.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return ImportTodoList(tl)
+}
+
+// ImportTodoList creates a Projects card with a TodoList's checklists.
+func ImportTodoList(tl TodoList) error {
+	usage.Record("import")
+	card, err := NewCard(board.Projects, tl.Name, "")
+	if err != nil {
+		return err
+	}
+	for _, cl := range tl.Checklists {
+		id, err := NewChecklist(card.ID, cl.Name)
+		if err != nil {
+			return err
+		}
+		for _, item := range cl.Items {
+			if err := NewCheckItem(id, item.Name, item.Complete, item.Due); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("Created project %q with %d checklists\n", tl.Name, len(tl.Checklists))
+	return nil
+}
+
+// ExportProjectCommand writes an Active or Projects card's checklists as Markdown or todo.txt.
+//
+//	trello-watcher [flags] export-project [-format markdown|todotxt] [-o file] name
+func ExportProjectCommand(args []string) error {
+	fs := flag.NewFlagSet("export-project", flag.ExitOnError)
+	format := fs.String("format", "markdown", "markdown or todotxt")
+	out := fs.String("o", "", "file to write to (defaults to stdout)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("export-project needs exactly one project name")
+	}
+
+	card, err := FindProjectCard(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tl, err := ProjectTodoList(card)
+	if err != nil {
+		return err
+	}
+	usage.Record("export-project")
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "markdown":
+		return WriteMarkdown(w, tl)
+	case "todotxt":
+		return WriteTodoTxt(w, tl)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// ExportCompletedCommand writes the task cards completed between two days, inclusive, as CSV,
+// with how long each spent in To Do. Only cards completed since -cycles-file was kept are known.
+//
+//	trello-watcher [flags] export-completed [-from 2006-01-02] [-to 2006-01-02] [-o file]
+func ExportCompletedCommand(args []string) error {
+	fs := flag.NewFlagSet("export-completed", flag.ExitOnError)
+	from := fs.String("from", "", "first day to export, like 2006-01-02, empty for the earliest")
+	to := fs.String("to", "", "last day to export, like 2006-01-02, empty for today")
+	out := fs.String("o", "", "file to write to (defaults to stdout)")
+	fs.Parse(args)
+
+	var start, end time.Time
+	if *from != "" {
+		day, err := time.ParseInLocation("2006-01-02", *from, location)
+		if err != nil {
+			return fmt.Errorf("bad -from %q, use a day like 2006-01-02", *from)
+		}
+		start = day
+	}
+	end = Now()
+	if *to != "" {
+		day, err := time.ParseInLocation("2006-01-02", *to, location)
+		if err != nil {
+			return fmt.Errorf("bad -to %q, use a day like 2006-01-02", *to)
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+
+	cs, err := BoardCycleStats()
+	if err != nil {
+		return err
+	}
+	var tasks []TaskCycle
+	for _, t := range cs.Tasks {
+		if t.Completed != nil && !t.Completed.Before(start) && t.Completed.Before(end) {
+			tasks = append(tasks, t)
+		}
+	}
+	usage.Record("export-completed")
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return WriteCompletedCSV(w, tasks)
+}
+
+// FindProjectCard finds a project card by name, looking in Active before Projects.
+func FindProjectCard(name string) (*trel.Card, error) {
+	for _, l := range []trel.List{board.Active, board.Projects} {
+		cards, err := l.Cards()
+		if err != nil {
+			return nil, err
+		}
+		// A project is found by its name with or without its -project-progress count.
+		for i := range cards {
+			if cards[i].Name == name || ProjectName(cards[i].Name) == name {
+				return &cards[i], nil
+			}
+		}
+	}
+	return nil, trel.NotFoundError{Type: "Card", Identifier: name}
+}
+
+// ProjectTodoList reads a project card's checklists into a TodoList.
+func ProjectTodoList(card *trel.Card) (TodoList, error) {
+	tl := TodoList{Name: ProjectName(card.Name)}
+	cls, err := CardChecklistInfo(card.ID)
+	if err != nil {
+		return tl, err
+	}
+	if tl.URL, err = CardURL(card.ID); err != nil {
+		return tl, err
+	}
+	for _, cl := range cls {
+		sort.SliceStable(cl.CheckItems, func(i, j int) bool { return cl.CheckItems[i].Pos < cl.CheckItems[j].Pos })
+		tc := TodoChecklist{Name: cl.Name}
+		for _, ci := range cl.CheckItems {
+			tc.Items = append(tc.Items, TodoItem{Name: ci.Name, Complete: ci.State == "complete", Due: ci.Due})
+		}
+		tl.Checklists = append(tl.Checklists, tc)
+	}
+	return tl, nil
+}
+
+// CardCommand changes a single card the same way the watcher would.
+//
+//	trello-watcher [flags] card move name list
+//	trello-watcher [flags] card create name
+//	trello-watcher [flags] card complete name
+func CardCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: card move|create|complete name [list]")
+	}
+	name := args[1]
+
+	switch args[0] {
+	case "move":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: card move name list")
+		}
+		to, err := FindBoardList(args[2])
+		if err != nil {
+			return err
+		}
+		cards, err := AllCards(append(board.DoneLists(), board.Projects, board.Active, board.ToDo, board.Storage)...)
+		if err != nil {
+			return err
+		}
+		card, err := FindCard(cards, name)
+		if err != nil {
+			return err
+		}
+		return MoveCard(card, to)
+
+	case "create":
+		_, err := NewCard(board.ToDo, name, "")
+		return err
+
+	case "complete":
+		ci, err := FindListCheckItem(board.Active, name)
+		if err != nil {
+			return err
+		}
+		if err := CompleteCheckItem(ci); err != nil {
+			return err
+		}
+		// Move the card just as the checklist item webhook would.
+		var cic CheckItemChange
+		cic.Action.Type = "updateCheckItemStateOnCard"
+		cic.Action.Data.Card.ID = ci.Checklist.IDCard
+		cic.Action.Data.Card.Name = ci.Checklist.Card.Name
+		cic.Action.Data.Checklist.ID = ci.Checklist.ID
+		cic.Action.Data.Checklist.Name = ci.Checklist.Name
+		cic.Action.Data.CheckItem.ID = ci.ID
+		cic.Action.Data.CheckItem.Name = ci.Name
+		cic.Action.Data.CheckItem.State = "complete"
+		return cic.Handle()
+	}
+	return fmt.Errorf("unknown card command %q", args[0])
+}
+
+// ProjectCommand activates, stores, or shows the progress of a project.
+//
+//	trello-watcher [flags] project activate name
+//	trello-watcher [flags] project store name
+//	trello-watcher [flags] project status name
+func ProjectCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: project activate|store|status name")
+	}
+	card, err := FindProjectCard(args[1])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "activate":
+		return ActivateProject(card)
+
+	case "store":
+		return StoreProject(card)
+
+	case "status":
+		return printProjectStatus(card)
+	}
+	return fmt.Errorf("unknown project command %q", args[0])
+}
+
+// ActivateProject moves a project card to Active and sets it up, the way the watcher does when it's moved there.
+func ActivateProject(card *trel.Card) error {
+	if err := MoveCard(card, board.Active); err != nil {
+		return err
+	}
+	return SetupActiveProjectCard(*card)
+}
+
+// StoreProject moves a project card back to Projects and stores its tasks.
+func StoreProject(card *trel.Card) error {
+	if err := MoveCard(card, board.Projects); err != nil {
+		return err
+	}
+	return StoreInactiveProjectCard(*card)
+}
+
+func printProjectStatus(card *trel.Card) error {
+	checklists, err := card.Checklists()
+	if err != nil {
+		return err
+	}
+	cards, err := AllCards(append(board.DoneLists(), board.ToDo, board.Storage)...)
+	if err != nil {
+		return err
+	}
+	listNames := map[string]string{}
+	for _, l := range append(board.DoneLists(), board.ToDo, board.Storage) {
+		listNames[l.ID] = l.Name
+	}
+
+	for _, cl := range checklists {
+		complete := 0
+		for _, ci := range cl.CheckItems {
+			if ci.State == "complete" {
+				complete++
+			}
+		}
+		fmt.Printf("%s [%d/%d]\n", cl.Name, complete, len(cl.CheckItems))
+		for _, ci := range cl.CheckItems {
+			check := " "
+			if ci.State == "complete" {
+				check = "x"
+			}
+			where := "no card"
+			if c, err := FindTaskCard(cards, ci.ID, card.Name, ci.Name); err == nil {
+				where = listNames[c.IDList]
+			}
+			fmt.Printf("  [%s] %s (%s)\n", check, ci.Name, where)
+		}
+	}
+	return nil
+}
+
+// FindBoardList finds one of the watcher's lists by name.
+func FindBoardList(name string) (trel.List, error) {
+	for _, l := range append(board.DoneLists(), board.Projects, board.Active, board.ToDo, board.Storage) {
+		if l.Name == name {
+			return l, nil
+		}
+	}
+	return trel.List{}, trel.NotFoundError{Type: "List", Identifier: name}
+}
+
+// SetupCommand makes sure every board's watched lists and Active cards have active webhooks, without running the server.
+// With -interactive, it walks through writing a config file instead.
+//
+//	trello-watcher [flags] setup [-interactive]
+func SetupCommand(args []string) error {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	interactive := fs.Bool("interactive", false, "walk through picking a board and write a config file")
+	fs.Parse(args)
+	if *interactive {
+		path := configFile
+		if path == "" {
+			path = "./trello-watcher.toml"
+		}
+		return SetupWizard(os.Stdin, os.Stdout, path)
+	}
+
+	if polling() {
+		fmt.Println("Nothing to set up, -poll doesn't use webhooks")
+		return nil
+	}
+	ForEachBoard(func() error {
+		before := len(board.Webhooks)
+		SetupInitialWebhooks()
+		fmt.Printf("%s: %d webhooks created, %d already existed\n", board.Name, len(board.Webhooks)-before, before)
+		return nil
+	})
+	return nil
+}
+
+// StatusCommand prints each board's lists, and whether each watched list and Active card has an active webhook.
+//
+//	trello-watcher [flags] status
+func StatusCommand(args []string) error {
+	ForEachBoard(func() error {
+		fmt.Printf("%s (%s)\n", board.Name, board.ID)
+		for _, l := range board.Lists() {
+			closed := ""
+			if l.Closed {
+				closed = ", archived"
+			}
+			fmt.Printf("  list %s (%s%s)\n", l.Name, l.ID, closed)
+		}
+
+		health, err := BoardWebhookHealth()
+		if err != nil {
+			return err
+		}
+		for _, h := range health {
+			fmt.Printf("  %s %s: %s\n", h.Kind, h.Name, h.Status)
+		}
+
+		cs, err := BoardCycleStats()
+		if err != nil {
+			return err
+		}
+		for _, p := range cs.Projects {
+			name := p.Project
+			if name == "" {
+				name = "(no project)"
+			}
+			fmt.Printf("  project %s: %d of %d tasks done", name, p.Done, p.Tasks)
+			if p.AvgInToDo != nil {
+				fmt.Printf(", %s average in To Do", leadName(p.AvgInToDo.Round(time.Minute)))
+			}
+			if p.AvgCycleTime != nil {
+				fmt.Printf(", cycle time %s average, %s median", leadName(p.AvgCycleTime.Round(time.Minute)), leadName(p.MedianCycleTime.Round(time.Minute)))
+			}
+			fmt.Println()
+		}
+		return nil
+	})
+	return nil
+}
+
+// TeardownCommand deletes every webhook on the token that the watcher made, or that calls back to -host
+// or one of the old hosts given, so webhooks left behind by moving hosts can be cleaned up.
+//
+//	trello-watcher [flags] teardown [-hosts old.example.com,...] [-deactivate] [-list]
+func TeardownCommand(args []string) error {
+	fs := flag.NewFlagSet("teardown", flag.ExitOnError)
+	oldHosts := fs.String("hosts", "", "comma separated hosts the watcher used to run on, whose webhooks are removed too")
+	deactivate := fs.Bool("deactivate", false, "deactivate the webhooks instead of deleting them")
+	list := fs.Bool("list", false, "only list the webhooks that would be removed")
+	fs.Parse(args)
+
+	hosts := []string{host}
+	for _, h := range strings.Split(*oldHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	webhooks, err := trelClient.Webhooks()
+	if err != nil {
+		return err
+	}
+	var ours []trel.Webhook
+	for _, wh := range webhooks {
+		if IsWatcherWebhook(wh, hosts) {
+			ours = append(ours, wh)
+			fmt.Printf("%s -> %s (active: %t)\n", wh.Description, wh.CallbackURL, wh.Active)
+		}
+	}
+	if *list {
+		fmt.Printf("%d of the token's %d webhooks are the watcher's\n", len(ours), len(webhooks))
+		return nil
+	}
+
+	cleanupOnExit = "delete"
+	if *deactivate {
+		cleanupOnExit = "deactivate"
+	}
+	_, cleaned := CleanupWebhooks(ours, hosts)
+	fmt.Printf("%d of the token's %d webhooks cleaned up\n", cleaned, len(webhooks))
+	return nil
+}
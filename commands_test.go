@@ -0,0 +1,105 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCardCommandComplete checks that completing the last item from the command line moves the project card,
+// and stores its task cards, like the webhook would.
+func TestCardCommandComplete(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	cl.CheckItems[1].State = "complete"
+	fake.AddCard(board.ToDo.ID, "write")
+	onProjectComplete = "Projects"
+	t.Cleanup(func() { onProjectComplete = "" })
+
+	if err := CardCommand([]string{"complete", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	if cl.CheckItems[0].State != "complete" {
+		t.Errorf("%q is %s, want complete", cl.CheckItems[0].Name, cl.CheckItems[0].State)
+	}
+	if got, want := fake.cardsOn(board.Projects.ID), []string{"Launch"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Projects = %q, want %q", got, want)
+	}
+	if got, want := fake.cardsOn(board.Storage.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Storage = %q, want %q", got, want)
+	}
+}
+
+// TestCardCommandCompleteProgress checks that completing an item from the command line finds its -project-prefix card,
+// and updates the project's progress.
+func TestCardCommandCompleteProgress(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	fake.AddCard(board.ToDo.ID, "Launch: write")
+	fake.AddCard(board.ToDo.ID, "Launch: ship")
+	projectPrefix, projectProgress = true, true
+	t.Cleanup(func() { projectPrefix, projectProgress = false, false })
+
+	if err := CardCommand([]string{"complete", "Launch: write"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.Done.ID), []string{"Launch: write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+	if got, want := fake.cardsOn(board.Active.ID), []string{"Launch [1/2]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Active = %q, want %q", got, want)
+	}
+}
+
+// captureStdout returns what run prints.
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	err = run()
+	os.Stdout = old
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestProjectCommandStatus checks that the status command finds each item's task card the way the watcher does,
+// including -project-prefix cards.
+func TestProjectCommandStatus(t *testing.T) {
+	tests := []struct {
+		prefix bool
+		card   string
+	}{
+		{false, "write"},
+		{true, "Launch: write"},
+	}
+	t.Cleanup(func() { projectPrefix = false })
+	for _, tt := range tests {
+		fake, boardID := watchFake(t)
+		project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+		fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+		fake.AddCard(board.ToDo.ID, tt.card)
+		projectPrefix = tt.prefix
+
+		out := captureStdout(t, func() error { return ProjectCommand([]string{"status", "Launch"}) })
+		if want := "  [ ] write (To Do)\n  [ ] ship (no card)\n"; !strings.Contains(out, want) {
+			t.Errorf("with -project-prefix=%v, printed\n%s\nwant\n%s", tt.prefix, out, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// onProjectComplete is where an Active project card goes once every checklist item on it is complete:
+// "Projects", another list on the board by name, or "archive". Empty to leave it in Active.
+var onProjectComplete string
+
+// PlanProjectComplete adds storing an Active project card's task cards, and moving the card to -on-project-complete,
+// to the plan, if every checklist item on it is complete once the item with checkItemID is.
+func PlanProjectComplete(plan *Plan, project trel.Card, checkItemID string) error {
+	if onProjectComplete == "" || project.IDList != board.Active.ID {
+		return nil
+	}
+	checklists, err := project.Checklists()
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, cl := range checklists {
+		for _, ci := range cl.CheckItems {
+			if ci.State != "complete" && ci.ID != checkItemID {
+				return nil
+			}
+			total++
+		}
+	}
+	// A project without any items was never started, so it isn't finished either.
+	if total == 0 {
+		return nil
+	}
+
+	stored, err := PlanStoreInactiveProject(project)
+	if err != nil {
+		return err
+	}
+	plan.Changes = append(plan.Changes, stored.Changes...)
+	if onProjectComplete == "archive" {
+		plan.Archive(&project, board.Active)
+	} else {
+		to, err := FindOpenBoardList(onProjectComplete)
+		if err != nil {
+			return fmt.Errorf("unable to move finished project %q: %s", project.Name, err)
+		}
+		plan.Move(&project, board.Active, to)
+	}
+	if err := PlanPromotion(plan, project.ID); err != nil {
+		return err
+	}
+	plan.Feature = "project-complete"
+	logger.Printf("Every checklist item on %q is complete, moving it to %s\n", project.Name, onProjectComplete)
+	return nil
+}
+
+// FindOpenBoardList finds an open list on the board by name, including lists the watcher doesn't otherwise use.
+func FindOpenBoardList(name string) (trel.List, error) {
+	if l, err := FindBoardList(name); err == nil {
+		return l, nil
+	}
+	tb, err := trelClient.Board(board.ID)
+	if err != nil {
+		return trel.List{}, err
+	}
+	lists, err := tb.Lists()
+	if err != nil {
+		return trel.List{}, err
+	}
+	return findOpenList(lists, name)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// flagEnv are the flags that can also be set by an environment variable.
+// The environment overrides a config file, and a flag overrides both.
+var flagEnv = map[string]string{
+	"board":         "TRELLO_BOARD_ID",
+	"key":           "TRELLO_KEY",
+	"token":         "TRELLO_TOKEN",
+	"webhook-lists": "TRELLO_WEBHOOK_LISTS",
+	"admin-token":   "WATCHER_ADMIN_TOKEN",
+}
+
+// ParseConfig reads a flat TOML config file, where each key is a flag name, like
+//
+//	board = "abc123"
+//	strict = true
+//	webhook-lists = ["Active", "To Do", "Done"]
+//
+// Arrays are joined with commas. Tables aren't supported, since flags don't nest.
+func ParseConfig(r io.Reader) (map[string]string, error) {
+	config := map[string]string{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:eq]), `"`)
+		value, err := parseConfigValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		config[key] = value
+	}
+	return config, s.Err()
+}
+
+// parseConfigValue reads a TOML string, number, boolean, or array of those.
+func parseConfigValue(v string) (string, error) {
+	if strings.HasPrefix(v, "[") {
+		end := strings.LastIndex(v, "]")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed array %s", v)
+		}
+		var values []string
+		for _, item := range splitConfigArray(v[1:end]) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, ","), nil
+	}
+
+	switch {
+	case strings.HasPrefix(v, `"`):
+		for i := 1; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++
+			} else if v[i] == '"' {
+				return strconv.Unquote(v[:i+1])
+			}
+		}
+		return "", fmt.Errorf("unclosed string %s", v)
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed string %s", v)
+		}
+		return v[1 : end+1], nil
+	}
+
+	// Bare values, like numbers and booleans, end at a comment.
+	if i := strings.Index(v, "#"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	if v == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return v, nil
+}
+
+// splitConfigArray splits array items on the commas that aren't inside quotes.
+func splitConfigArray(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// ApplyConfig sets flags from a config file, except for flags that were given explicitly
+// or whose environment variable is set.
+func ApplyConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	config, err := ParseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, name := range sortedKeys(config) {
+		if name == "config" {
+			return fmt.Errorf("%s: a config file can't name another config file", path)
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q, settings are named like flags", path, name)
+		}
+		if given[name] || flagEnv[name] != "" && os.Getenv(flagEnv[name]) != "" {
+			continue
+		}
+		if err := flag.Set(name, config[name]); err != nil {
+			return fmt.Errorf("%s: bad value for %s: %s", path, name, err)
+		}
+	}
+	return nil
+}
+
+// configFile is the config file given with -config, if any.
+var configFile string
+
+// WriteConfig writes settings, named like flags, as a config file ApplyConfig can read, in the order given.
+func WriteConfig(w io.Writer, settings map[string]string, order []string) error {
+	for _, name := range order {
+		v, ok := settings[name]
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", name, strconv.Quote(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cyclesFile is where the times cards entered and left To Do and Done are kept, so they survive restarts.
+var cyclesFile string
+
+var cycles = &Cycles{Cards: map[string]*CardCycle{}}
+
+// A ListStint is a stretch of time a card spent on To Do or Done.
+type ListStint struct {
+	List  string     `json:"list"` // "todo" or "done"
+	Enter time.Time  `json:"enter"`
+	Leave *time.Time `json:"leave,omitempty"` // nil while the card is still there.
+}
+
+// CardCycle is a card's time on To Do and Done.
+type CardCycle struct {
+	Board  string      `json:"board"`
+	Name   string      `json:"name"`
+	Stints []ListStint `json:"stints"`
+}
+
+// Cycles keeps each card's time on To Do and Done, by card ID.
+type Cycles struct {
+	mu    sync.Mutex
+	Cards map[string]*CardCycle `json:"cards"`
+}
+
+// LoadCycles reads the cycles from cyclesFile, if it exists.
+func LoadCycles() error {
+	b, err := ioutil.ReadFile(cyclesFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	cycles.mu.Lock()
+	defer cycles.mu.Unlock()
+	return json.Unmarshal(b, cycles)
+}
+
+// cycleList is which of the tracked lists a list is, "todo" or "done", or "" for one that isn't tracked.
+// Done and the Done archive count as one, so rolling Done into the archive doesn't start a new stint.
+func cycleList(listID string) string {
+	if listID == board.ToDo.ID {
+		return "todo"
+	}
+	for _, l := range board.DoneLists() {
+		if l.ID == listID {
+			return "done"
+		}
+	}
+	return ""
+}
+
+// Moved records that a card on the board arrived on a list at a time,
+// ending its stint on To Do or Done and starting a new one if the list is either.
+func (cs *Cycles) Moved(cardID, name, listID string, at time.Time) {
+	if cardID == "" {
+		return
+	}
+	list := cycleList(listID)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c, ok := cs.Cards[cardID]
+	if !ok {
+		if list == "" {
+			return
+		}
+		c = &CardCycle{Board: board.ID}
+		cs.Cards[cardID] = c
+	}
+	c.Name = name
+	// An action from before the card's last move, like one caught up on late, is already out of date.
+	if n := len(c.Stints); n > 0 && at.Before(c.Stints[n-1].Enter) {
+		return
+	}
+	if n := len(c.Stints); n > 0 && c.Stints[n-1].Leave == nil {
+		if c.Stints[n-1].List == list {
+			return
+		}
+		c.Stints[n-1].Leave = &at
+	}
+	if list != "" {
+		c.Stints = append(c.Stints, ListStint{List: list, Enter: at})
+	}
+	cs.save()
+}
+
+// Removed records that a card was archived or deleted at a time, which ends its time on To Do.
+// A done card stays done.
+func (cs *Cycles) Removed(cardID string, at time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.Cards[cardID]
+	if !ok {
+		return
+	}
+	if n := len(c.Stints); n > 0 && c.Stints[n-1].Leave == nil && c.Stints[n-1].List == "todo" {
+		c.Stints[n-1].Leave = &at
+		cs.save()
+	}
+}
+
+// save writes the cycles to cyclesFile. The caller must hold cs.mu.
+func (cs *Cycles) save() {
+	if cyclesFile == "" {
+		return
+	}
+	b, err := json.MarshalIndent(cs, "", "  ")
+	if err == nil {
+		err = writeFileReplacing(cyclesFile, b)
+	}
+	if err != nil {
+		logger.Printf("Unable to save cycles to %s: %s\n", cyclesFile, err)
+	}
+}
+
+// TaskCycle is how long a task card has spent on To Do, and if it is done, how long it took.
+type TaskCycle struct {
+	Card    string `json:"card"`
+	Name    string `json:"name"`
+	Project string `json:"project,omitempty"`
+	Done    bool   `json:"done"`
+	// InToDo is the time the card has spent on To Do, counting every time it was there,
+	// nil if it was never seen arriving there, like a card made before cycles were kept.
+	InToDo *time.Duration `json:"inToDo,omitempty"`
+	// CycleTime is from when the card first entered To Do to when it last entered Done, 0 until it is done.
+	CycleTime time.Duration `json:"cycleTime,omitempty"`
+	// Completed is when the card last entered Done, nil until it is done.
+	Completed *time.Time `json:"completed,omitempty"`
+}
+
+// ProjectCycle is the cycle times of a project's task cards.
+type ProjectCycle struct {
+	Project string `json:"project"`
+	Tasks   int    `json:"tasks"`
+	Done    int    `json:"done"`
+	// AvgInToDo is the average time the project's cards have spent on To Do, nil if none were seen there.
+	AvgInToDo *time.Duration `json:"avgInToDo,omitempty"`
+	// AvgCycleTime and MedianCycleTime are over the project's done cards with a cycle time, nil if there are none.
+	AvgCycleTime    *time.Duration `json:"avgCycleTime,omitempty"`
+	MedianCycleTime *time.Duration `json:"medianCycleTime,omitempty"`
+}
+
+// PeriodCount is how many task cards were completed in a day or week, keyed by its first day, like "2006-01-02".
+type PeriodCount struct {
+	Period    string `json:"period"`
+	Completed int    `json:"completed"`
+}
+
+// ProjectProgress is how many of an Active project's checklist items are complete.
+type ProjectProgress struct {
+	Project  string `json:"project"`
+	Complete int    `json:"complete"`
+	Total    int    `json:"total"`
+}
+
+type CycleStats struct {
+	Tasks    []TaskCycle    `json:"tasks"`
+	Projects []ProjectCycle `json:"projects"`
+	// CompletedDaily and CompletedWeekly are the task cards completed each day and week, oldest first.
+	CompletedDaily  []PeriodCount `json:"completedDaily"`
+	CompletedWeekly []PeriodCount `json:"completedWeekly"`
+	// AvgCycleTime is over every completed task card with a cycle time, nil if there are none.
+	AvgCycleTime   *time.Duration    `json:"avgCycleTime,omitempty"`
+	ActiveProjects int               `json:"activeProjects"`
+	Progress       []ProjectProgress `json:"progress"`
+}
+
+// TaskCycles works out the board's task card cycle times at now.
+// Cards are put under their project by the checklist item they are known to be for.
+func (cs *Cycles) TaskCycles(now time.Time, projects map[string]string) []TaskCycle {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var tasks []TaskCycle
+	for id, c := range cs.Cards {
+		if c.Board != board.ID || len(c.Stints) == 0 {
+			continue
+		}
+		t := TaskCycle{Card: id, Name: c.Name}
+		if ciID, ok := state.TaskCheckItem(id); ok {
+			t.Project = projects[ciID]
+		}
+		var started time.Time
+		var inToDo time.Duration
+		for _, s := range c.Stints {
+			if s.List != "todo" {
+				continue
+			}
+			if started.IsZero() {
+				started = s.Enter
+			}
+			leave := now
+			if s.Leave != nil {
+				leave = *s.Leave
+			}
+			inToDo += leave.Sub(s.Enter)
+		}
+		if !started.IsZero() {
+			t.InToDo = &inToDo
+		}
+		last := c.Stints[len(c.Stints)-1]
+		if last.List == "done" && last.Leave == nil {
+			t.Done = true
+			t.Completed = &last.Enter
+			if !started.IsZero() {
+				t.CycleTime = last.Enter.Sub(started)
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Project != tasks[j].Project {
+			return tasks[i].Project < tasks[j].Project
+		}
+		return tasks[i].Name < tasks[j].Name
+	})
+	return tasks
+}
+
+// ProjectCycles totals task cycle times by project, in the order of tasks.
+func ProjectCycles(tasks []TaskCycle) []ProjectCycle {
+	var projects []ProjectCycle
+	var inToDo, cycleTimes [][]time.Duration
+	for _, t := range tasks {
+		if n := len(projects); n == 0 || projects[n-1].Project != t.Project {
+			projects = append(projects, ProjectCycle{Project: t.Project})
+			inToDo, cycleTimes = append(inToDo, nil), append(cycleTimes, nil)
+		}
+		i := len(projects) - 1
+		projects[i].Tasks++
+		if t.InToDo != nil {
+			inToDo[i] = append(inToDo[i], *t.InToDo)
+		}
+		if t.Done {
+			projects[i].Done++
+			if t.CycleTime > 0 {
+				cycleTimes[i] = append(cycleTimes[i], t.CycleTime)
+			}
+		}
+	}
+	for i := range projects {
+		projects[i].AvgInToDo = averageDuration(inToDo[i])
+		projects[i].AvgCycleTime = averageDuration(cycleTimes[i])
+		projects[i].MedianCycleTime = medianDuration(cycleTimes[i])
+	}
+	return projects
+}
+
+// averageDuration is the mean of durations, nil for none, so an average of nothing isn't taken for 0.
+func averageDuration(ds []time.Duration) *time.Duration {
+	if len(ds) == 0 {
+		return nil
+	}
+	var total time.Duration
+	for _, d := range ds {
+		total += d
+	}
+	avg := total / time.Duration(len(ds))
+	return &avg
+}
+
+// medianDuration is the median of durations, nil for none.
+func medianDuration(ds []time.Duration) *time.Duration {
+	if len(ds) == 0 {
+		return nil
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	median := ds[len(ds)/2]
+	if n := len(ds); n%2 == 0 {
+		median = (ds[n/2-1] + ds[n/2]) / 2
+	}
+	return &median
+}
+
+// WriteCompletedCSV writes completed tasks as CSV, oldest first, with a header row.
+// The hours in To Do are left empty for a card that was never seen arriving there, rather than given as 0.
+func WriteCompletedCSV(w io.Writer, tasks []TaskCycle) error {
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Completed.Before(*tasks[j].Completed) })
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "project", "completed", "hours_in_todo"})
+	for _, t := range tasks {
+		hours := ""
+		if t.InToDo != nil {
+			hours = strconv.FormatFloat(t.InToDo.Hours(), 'f', 1, 64)
+		}
+		cw.Write([]string{t.Name, t.Project, t.Completed.In(location).Format(time.RFC3339), hours})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CompletedCounts counts completed tasks by the day, or with week the week, they were completed in.
+func CompletedCounts(tasks []TaskCycle, week bool) []PeriodCount {
+	counts := map[string]int{}
+	for _, t := range tasks {
+		if t.Completed == nil {
+			continue
+		}
+		start := StartOfDay(*t.Completed)
+		if week {
+			start = StartOfWeek(*t.Completed)
+		}
+		counts[start.Format("2006-01-02")]++
+	}
+	var periods []PeriodCount
+	for period, n := range counts {
+		periods = append(periods, PeriodCount{Period: period, Completed: n})
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Period < periods[j].Period })
+	return periods
+}
+
+// ActiveProgress counts the complete checklist items on each Active project card, top to bottom.
+func ActiveProgress() ([]ProjectProgress, error) {
+	cards, err := board.Active.Cards()
+	if err != nil {
+		return nil, err
+	}
+	var progress []ProjectProgress
+	for _, c := range cards {
+		cls, err := c.Checklists()
+		if err != nil {
+			return nil, err
+		}
+		p := ProjectProgress{Project: ProjectName(c.Name)}
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				if ci.State == "complete" {
+					p.Complete++
+				}
+				p.Total++
+			}
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+// BoardCycleStats works out the board's cycle times by task and by project,
+// how many tasks were completed each day and week, and how far along each Active project is.
+func BoardCycleStats() (CycleStats, error) {
+	projects, err := boardCheckItemProjects()
+	if err != nil {
+		return CycleStats{}, err
+	}
+	progress, err := ActiveProgress()
+	if err != nil {
+		return CycleStats{}, err
+	}
+	tasks := cycles.TaskCycles(Now(), projects)
+	var cycleTimes []time.Duration
+	for _, t := range tasks {
+		if t.CycleTime > 0 {
+			cycleTimes = append(cycleTimes, t.CycleTime)
+		}
+	}
+	return CycleStats{
+		Tasks:           tasks,
+		Projects:        ProjectCycles(tasks),
+		CompletedDaily:  CompletedCounts(tasks, false),
+		CompletedWeekly: CompletedCounts(tasks, true),
+		AvgCycleTime:    averageDuration(cycleTimes),
+		ActiveProjects:  len(progress),
+		Progress:        progress,
+	}, nil
+}
+
+// RecordCycles records a card arriving on a list, or leaving the board, when a webhook says so.
+// It goes by when the action was made, rather than when it was received, so polled and caught up actions keep their times.
+func (lc ListChange) RecordCycles() {
+	card := lc.Action.Data.Card
+	at := lc.Action.Date
+	if at.IsZero() {
+		at = Now()
+	}
+	switch lc.Action.Type {
+	case "createCard", "copyCard", "moveCardToBoard":
+		cycles.Moved(card.ID, card.Name, lc.Action.Data.List.ID, at)
+	case "updateCard":
+		if lc.Action.Data.ListAfter.ID != "" {
+			cycles.Moved(card.ID, card.Name, lc.Action.Data.ListAfter.ID, at)
+		} else if lc.Action.Data.Old.Closed != nil && card.Closed {
+			cycles.Removed(card.ID, at)
+		}
+	case "deleteCard":
+		cycles.Removed(card.ID, at)
+	}
+}
+
+// statsAPI serves GET /api/stats, the board's cycle times and completed task counts, and its Active projects' progress.
+func statsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	cs, err := BoardCycleStats()
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cs); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRecordCycles checks that cycle times go by when the actions were made, not when they were handled.
+func TestRecordCycles(t *testing.T) {
+	watchFake(t)
+	entered := time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC)
+	done := entered.Add(50 * time.Hour)
+
+	var lc ListChange
+	lc.Action.Type = "updateCard"
+	lc.Action.Date = entered
+	lc.Action.Data.Card.ID, lc.Action.Data.Card.Name = "c1", "write"
+	lc.Action.Data.ListBefore.ID, lc.Action.Data.ListAfter.ID = board.Storage.ID, board.ToDo.ID
+	lc.RecordCycles()
+
+	lc.Action.Date = done
+	lc.Action.Data.ListBefore.ID, lc.Action.Data.ListAfter.ID = board.ToDo.ID, board.Done.ID
+	lc.RecordCycles()
+
+	// Handled late, the first move changes nothing.
+	lc.Action.Date = entered
+	lc.Action.Data.ListBefore.ID, lc.Action.Data.ListAfter.ID = board.Storage.ID, board.ToDo.ID
+	lc.RecordCycles()
+
+	tasks := cycles.TaskCycles(done.Add(time.Hour), nil)
+	if len(tasks) != 1 {
+		t.Fatalf("got %d task cycles, want 1", len(tasks))
+	}
+	if got := tasks[0]; !got.Done || got.InToDo == nil || *got.InToDo != 50*time.Hour || got.CycleTime != 50*time.Hour || !got.Completed.Equal(done) {
+		t.Errorf("got %+v, want done in 50h on %s", got, done)
+	}
+}
+
+func TestWriteCompletedCSV(t *testing.T) {
+	inToDo := 90 * time.Minute
+	first := time.Date(2026, 9, 1, 9, 0, 0, 0, location)
+	second := first.Add(24 * time.Hour)
+	tasks := []TaskCycle{
+		{Name: "ship, then tell", Project: "Launch", Done: true, Completed: &second},
+		{Name: "write", Project: "Launch", Done: true, InToDo: &inToDo, Completed: &first},
+	}
+	var b strings.Builder
+	if err := WriteCompletedCSV(&b, tasks); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,project,completed,hours_in_todo\n" +
+		"write,Launch," + first.Format(time.RFC3339) + ",1.5\n" +
+		"\"ship, then tell\",Launch," + second.Format(time.RFC3339) + ",\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestProjectCycles checks that averages only count the cards they are known for, and are left out when there are none.
+func TestProjectCycles(t *testing.T) {
+	hour, day := time.Hour, 24*time.Hour
+	tasks := []TaskCycle{
+		{Name: "ship", Project: "Launch", Done: true, InToDo: &hour, CycleTime: 2 * time.Hour},
+		{Name: "write", Project: "Launch", Done: true, CycleTime: 0},
+		{Name: "plan", Project: "Later", InToDo: &day},
+	}
+	projects := ProjectCycles(tasks)
+	if len(projects) != 2 {
+		t.Fatalf("got %d projects, want 2", len(projects))
+	}
+	launch, later := projects[0], projects[1]
+	if launch.AvgInToDo == nil || *launch.AvgInToDo != hour {
+		t.Errorf("Launch's average in To Do is %v, want %s", launch.AvgInToDo, hour)
+	}
+	if launch.AvgCycleTime == nil || *launch.AvgCycleTime != 2*time.Hour {
+		t.Errorf("Launch's average cycle time is %v, want 2h", launch.AvgCycleTime)
+	}
+	if later.AvgCycleTime != nil || later.MedianCycleTime != nil {
+		t.Errorf("Later has no done tasks, but its cycle times are %v and %v", later.AvgCycleTime, later.MedianCycleTime)
+	}
+}
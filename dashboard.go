@@ -0,0 +1,246 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentEventsSize is how many handled events the dashboard shows.
+const recentEventsSize = 50
+
+// RecentEvent is an Event that went through the pipeline, and how it went.
+type RecentEvent struct {
+	Time       time.Time     `json:"time"`
+	Board      string        `json:"board"`
+	ActionType string        `json:"actionType"`
+	ObjType    string        `json:"objType"`
+	ObjID      string        `json:"objID"`
+	CardID     string        `json:"cardID,omitempty"`
+	Took       time.Duration `json:"took"`
+	Error      string        `json:"error,omitempty"`
+}
+
+var recentEvents struct {
+	sync.Mutex
+	events []RecentEvent
+}
+
+// RecordRecentEvents keeps the latest events for the dashboard.
+func RecordRecentEvents(next EventHandler) EventHandler {
+	return func(e Event) error {
+		start := time.Now()
+		err := next(e)
+		re := RecentEvent{Time: Now(), Board: board.ID, ActionType: e.ActionType, ObjType: e.ObjType, ObjID: e.ObjID, CardID: e.CardID, Took: time.Since(start)}
+		if err != nil {
+			re.Error = err.Error()
+		}
+		recentEvents.Lock()
+		recentEvents.events = append(recentEvents.events, re)
+		if len(recentEvents.events) > recentEventsSize {
+			recentEvents.events = recentEvents.events[len(recentEvents.events)-recentEventsSize:]
+		}
+		recentEvents.Unlock()
+		Publish(re)
+		return err
+	}
+}
+
+// WebhookHealth is whether one of the things the watcher needs a webhook on has an active one.
+type WebhookHealth struct {
+	Kind   string // "watched list" or "active project"
+	Name   string
+	Status string // "active webhook", "inactive webhook", or "no webhook"
+	OK     bool
+}
+
+// BoardWebhookHealth checks the webhook on each of the board's watched lists and Active cards.
+func BoardWebhookHealth() ([]WebhookHealth, error) {
+	var health []WebhookHealth
+	check := func(kind, name, id string) {
+		h := WebhookHealth{Kind: kind, Name: name, Status: "no webhook"}
+		if wh, err := board.Webhooks.Find(id); err == nil {
+			h.Status = "inactive webhook"
+			if wh.Active {
+				h.Status, h.OK = "active webhook", true
+			}
+		}
+		health = append(health, h)
+	}
+	for _, l := range board.WatchedLists {
+		check("watched list", l.Name, l.ID)
+	}
+	cards, err := board.Active.Cards()
+	if err != nil {
+		return health, err
+	}
+	for _, c := range cards {
+		check("active project", c.Name, c.ID)
+	}
+	return health, nil
+}
+
+type dashboardProject struct {
+	Name       string
+	Checklists []dashboardChecklist
+}
+
+type dashboardChecklist struct {
+	Name     string
+	Complete int
+	Items    []TodoItem
+}
+
+// dashboardPage is everything the dashboard shows for a board.
+type dashboardPage struct {
+	BoardID  string
+	Board    string
+	Boards   []*Board
+	Paused   PauseStatus
+	Projects []dashboardProject
+	ToDo     []string
+	Done     []string
+	Events   []RecentEvent
+	Webhooks []WebhookHealth
+}
+
+// BuildDashboard gathers the board's active projects, To Do and Done, recent events, and webhook health.
+func BuildDashboard() (dashboardPage, error) {
+	page := dashboardPage{BoardID: board.ID, Board: board.Name, Boards: boards, Paused: pauseStatus()}
+
+	active, err := board.Active.Cards()
+	if err != nil {
+		return page, err
+	}
+	for i := range active {
+		tl, err := ProjectTodoList(&active[i])
+		if err != nil {
+			return page, err
+		}
+		p := dashboardProject{Name: tl.Name}
+		for _, cl := range tl.Checklists {
+			dc := dashboardChecklist{Name: cl.Name, Items: cl.Items}
+			for _, item := range cl.Items {
+				if item.Complete {
+					dc.Complete++
+				}
+			}
+			p.Checklists = append(p.Checklists, dc)
+		}
+		page.Projects = append(page.Projects, p)
+	}
+
+	for _, l := range []struct {
+		list  *[]string
+		cards func() ([]CardInfo, error)
+	}{
+		{&page.ToDo, func() ([]CardInfo, error) { return ListCardInfo(board.ToDo.ID) }},
+		{&page.Done, func() ([]CardInfo, error) { return ListCardInfo(board.Done.ID) }},
+	} {
+		cards, err := l.cards()
+		if err != nil {
+			return page, err
+		}
+		for _, c := range cards {
+			*l.list = append(*l.list, c.Name)
+		}
+	}
+
+	recentEvents.Lock()
+	for i := len(recentEvents.events) - 1; i >= 0; i-- {
+		if e := recentEvents.events[i]; e.Board == board.ID {
+			page.Events = append(page.Events, e)
+		}
+	}
+	recentEvents.Unlock()
+
+	page.Webhooks, err = BoardWebhookHealth()
+	return page, err
+}
+
+// dashboardAPI serves the dashboard at /ui.
+func dashboardAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	page, err := BuildDashboard()
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		logger.Println(err)
+	}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Board}} - trello watcher</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #172b4d; }
+section { margin-bottom: 2em; }
+.columns { display: flex; gap: 2em; }
+.columns > div { flex: 1; }
+.bad { color: #c9372c; }
+.done { color: #5e6c84; text-decoration: line-through; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.8em 0.2em 0; text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{.Board}}</h1>
+{{if gt (len .Boards) 1}}<p>{{range .Boards}}<a href="?board={{.ID}}">{{.Name}}</a> {{end}}</p>{{end}}
+{{if .Paused.Paused}}<p class="bad">Automation is paused{{with .Paused.Reason}}: {{.}}{{end}}</p>{{end}}
+
+<section>
+<h2>Active</h2>
+{{range .Projects}}
+<h3>{{.Name}}</h3>
+{{range .Checklists}}
+<p><b>{{.Name}}</b> {{.Complete}}/{{len .Items}}</p>
+<ul>{{range .Items}}<li{{if .Complete}} class="done"{{end}}>{{.Name}}</li>{{end}}</ul>
+{{end}}
+{{else}}<p>No active projects.</p>{{end}}
+</section>
+
+<section class="columns">
+<div><h2>To Do</h2><ul>{{range .ToDo}}<li>{{.}}</li>{{end}}</ul></div>
+<div><h2>Done</h2><ul>{{range .Done}}<li>{{.}}</li>{{end}}</ul></div>
+</section>
+
+<section>
+<h2>Recent events</h2>
+<table id="events">
+{{range .Events}}<tr{{if .Error}} class="bad"{{end}}><td>{{.Time.Format "Jan 2 15:04:05"}}</td><td>{{.ActionType}}</td><td>{{.ObjType}} {{.ObjID}}</td><td>{{.Took}}</td><td>{{.Error}}</td></tr>
+{{else}}<tr><td>No events handled yet.</td></tr>{{end}}
+</table>
+</section>
+
+<section>
+<h2>Webhooks</h2>
+<table>
+{{range .Webhooks}}<tr{{if not .OK}} class="bad"{{end}}><td>{{.Kind}}</td><td>{{.Name}}</td><td>{{.Status}}</td></tr>
+{{end}}
+</table>
+</section>
+<script>
+// Events are added as they are handled.
+var events = document.getElementById("events");
+new EventSource("events?board={{.BoardID}}").onmessage = function (m) {
+	var e = JSON.parse(m.data);
+	var row = events.insertRow(0);
+	if (e.error) row.className = "bad";
+	[new Date(e.time).toLocaleString(), e.actionType, e.objType + " " + e.objID, Math.round(e.took / 1e6) + "ms", e.error || ""].forEach(function (text) {
+		row.insertCell().textContent = text;
+	});
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digestTo are the addresses the weekly digest is emailed to, none to not send one.
+var digestTo []string
+
+// digestFrom is the address the weekly digest is sent from.
+var digestFrom string
+
+// digestSchedule is when the weekly digest is sent, like "monday 09:00".
+var digestSchedule string
+
+// smtpAddr, smtpUser, and smtpPassword are the mail server the digest is sent through, with no user to not log in.
+var smtpAddr, smtpUser, smtpPassword string
+
+// digestStaleAge is how long a To Do card can sit without moving before the digest counts it as stale, without -stale-after.
+const digestStaleAge = 14 * 24 * time.Hour
+
+// Digest is what happened on the board in the week before Time.
+type Digest struct {
+	Board     string
+	Since     time.Time
+	Time      time.Time
+	Activated []string
+	Completed []string
+	// Finished are the names of the checklist items completed, by project.
+	Finished map[string][]string
+	Pending  []string
+	Stale    []string
+	Progress []ProjectProgress
+}
+
+// digestAction is the part of a Trello board action the digest needs.
+type digestAction struct {
+	Type string `json:"type"`
+	Data struct {
+		Card struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"card"`
+		CheckItem struct {
+			Name  string `json:"name"`
+			State string `json:"state"`
+		} `json:"checkItem"`
+		ListBefore struct {
+			ID string `json:"id"`
+		} `json:"listBefore"`
+		ListAfter struct {
+			ID string `json:"id"`
+		} `json:"listAfter"`
+	} `json:"data"`
+}
+
+// BuildDigest works out the projects activated and completed, checklist items finished,
+// and tasks pending and stale on the board in the week before now.
+// A project counts as completed when it left Active with every checklist item complete.
+func BuildDigest(now time.Time) (Digest, error) {
+	d := Digest{Board: board.Name, Since: now.AddDate(0, 0, -7), Time: now, Finished: map[string][]string{}}
+
+	var actions []digestAction
+	params := url.Values{
+		"filter": {"updateCard:idList,updateCheckItemStateOnCard"},
+		"since":  {d.Since.UTC().Format(time.RFC3339)},
+		"limit":  {"1000"},
+	}
+	if err := apiDo(http.MethodGet, "boards/"+board.ID+"/actions", params, &actions); err != nil {
+		return d, err
+	}
+	// Actions come newest first, so they're read backwards to keep the order they happened in.
+	left := map[string]string{}
+	for i := len(actions) - 1; i >= 0; i-- {
+		a := actions[i]
+		switch {
+		case a.Type == "updateCheckItemStateOnCard" && a.Data.CheckItem.State == "complete":
+			project := ProjectName(a.Data.Card.Name)
+			d.Finished[project] = append(d.Finished[project], a.Data.CheckItem.Name)
+		case a.Type == "updateCard" && a.Data.ListAfter.ID == board.Active.ID:
+			d.Activated = append(d.Activated, ProjectName(a.Data.Card.Name))
+		case a.Type == "updateCard" && a.Data.ListBefore.ID == board.Active.ID:
+			left[a.Data.Card.ID] = ProjectName(a.Data.Card.Name)
+		}
+	}
+	for id, name := range left {
+		cls, err := CardChecklistInfo(id)
+		if err != nil {
+			return d, err
+		}
+		complete, total := 0, 0
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				if ci.State == "complete" {
+					complete++
+				}
+				total++
+			}
+		}
+		if total > 0 && complete == total {
+			d.Completed = append(d.Completed, name)
+		}
+	}
+	sort.Strings(d.Completed)
+
+	todo, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return d, err
+	}
+	staleAge := staleAfter
+	if staleAge == 0 {
+		staleAge = digestStaleAge
+	}
+	for _, c := range todo {
+		d.Pending = append(d.Pending, c.Name)
+		since, err := InListSince(c.ID)
+		if err != nil {
+			return d, err
+		}
+		if now.Sub(since) >= staleAge {
+			d.Stale = append(d.Stale, c.Name)
+		}
+	}
+
+	if d.Progress, err = ActiveProgress(); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+func (d Digest) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s to %s\n", d.Board, d.Since.In(location).Format("Mon Jan 2"), d.Time.In(location).Format("Mon Jan 2"))
+
+	list := func(title string, names []string) {
+		fmt.Fprintf(&b, "\n%s: %d\n", title, len(names))
+		for _, name := range names {
+			fmt.Fprintf(&b, "  - %s\n", name)
+		}
+	}
+	list("Projects activated", d.Activated)
+	list("Projects completed", d.Completed)
+
+	var projects []string
+	finished := 0
+	for project, items := range d.Finished {
+		projects = append(projects, project)
+		finished += len(items)
+	}
+	sort.Strings(projects)
+	fmt.Fprintf(&b, "\nChecklist items finished: %d\n", finished)
+	for _, project := range projects {
+		fmt.Fprintf(&b, "  %s\n", project)
+		for _, item := range d.Finished[project] {
+			fmt.Fprintf(&b, "    - %s\n", item)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nActive projects: %d\n", len(d.Progress))
+	for _, p := range d.Progress {
+		fmt.Fprintf(&b, "  - %s [%d/%d]\n", p.Project, p.Complete, p.Total)
+	}
+	list("Tasks pending in To Do", d.Pending)
+	list("Stale tasks", d.Stale)
+	return b.String()
+}
+
+// SendMail emails a plain text message through the -smtp-addr server.
+func SendMail(to []string, subject, body string) error {
+	var auth smtp.Auth
+	if smtpUser != "" {
+		host, _, err := net.SplitHostPort(smtpAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", smtpUser, smtpPassword, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		digestFrom, strings.Join(to, ", "), subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(smtpAddr, auth, digestFrom, to, []byte(msg))
+}
+
+// SendDigest emails the board's weekly digest to -digest-to.
+func SendDigest() error {
+	d, err := BuildDigest(Now())
+	if err != nil {
+		return fmt.Errorf("unable to build the weekly digest: %s", err)
+	}
+	if err := SendMail(digestTo, "Weekly digest for "+board.Name, d.String()); err != nil {
+		return fmt.Errorf("unable to send the weekly digest: %s", err)
+	}
+	logger.Printf("Sent the weekly digest for %s to %s\n", board.Name, strings.Join(digestTo, ", "))
+	usage.Record("weekly-digest")
+	return nil
+}
+
+// RunDigests sends each board's weekly digest on every tick.
+func RunDigests(tick <-chan time.Time) {
+	for range tick {
+		ForEachBoard(SendDigest)
+	}
+}
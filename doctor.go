@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// doctorBoardIDs are the boards doctor checks.
+// Startup stops at the first problem with a board, so doctor resolves the boards itself instead.
+var doctorBoardIDs []string
+
+// DoctorCommand checks the token and each board, and prints every problem found with how to fix it.
+//
+//	trello-watcher [flags] doctor
+func DoctorCommand(args []string) error {
+	problems := 0
+	ok := func(format string, a ...interface{}) {
+		fmt.Printf("ok      "+format+"\n", a...)
+	}
+	problem := func(format string, a ...interface{}) {
+		problems++
+		fmt.Printf("PROBLEM "+format+"\n", a...)
+	}
+
+	if _, err := WatcherMemberID(); err != nil {
+		problem("the key and token don't work: %s, check -key and -token", err)
+		return fmt.Errorf("doctor found %d problems", problems)
+	}
+	ok("the key and token work")
+
+	for _, id := range doctorBoardIDs {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		tb, err := trelClient.Board(id)
+		if err != nil {
+			problem("unable to read board %s: %s, check -board and that the token's member can see it", id, err)
+			continue
+		}
+		fmt.Printf("\n%s (%s)\n", tb.Name, tb.ID)
+
+		if err := CheckBoardPermissions(tb.ID); err != nil {
+			problem("%s", err)
+		} else {
+			ok("the token can change the board")
+		}
+
+		lists, err := tb.Lists()
+		if err != nil {
+			problem("unable to read the lists: %s", err)
+			continue
+		}
+		for _, role := range listRoles {
+			l, err := findOpenList(lists, listName(role))
+			switch {
+			case err != nil:
+				problem("no list named %q for %s, add one or name the one to use with -list-names \"%s=...\"", listName(role), role, role)
+			case l.Closed:
+				problem("the %q list for %s is archived, restore it", l.Name, role)
+			default:
+				ok("%s is the %q list", role, l.Name)
+			}
+		}
+
+		b, err := ResolveBoard(tb, watchedListNames)
+		if err != nil {
+			problem("%s", err)
+			continue
+		}
+		boards = append(boards, &b)
+		err = WithBoard(b.ID, func() error {
+			doctorBoard(ok, problem)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("doctor found %d problems", problems)
+	}
+	fmt.Println("\nNo problems found")
+	return nil
+}
+
+// doctorBoard checks the board for names that confuse matching, and tasks out of step with their checklist items.
+func doctorBoard(ok, report func(string, ...interface{})) {
+	cards, err := AllCards(append(board.DoneLists(), board.ToDo, board.Storage)...)
+	if err != nil {
+		report("unable to read the cards: %s", err)
+		return
+	}
+	seen := map[string]int{}
+	for _, c := range cards {
+		seen[c.Name]++
+	}
+	duplicates := 0
+	for name, count := range seen {
+		if count > 1 {
+			duplicates++
+			report("%d cards are named %q, rename or archive all but one so checklist items match the right card", count, name)
+		}
+	}
+	if duplicates == 0 {
+		ok("task card names are unique")
+	}
+
+	active, err := board.Active.Cards()
+	if err != nil {
+		report("unable to read the Active cards: %s", err)
+		return
+	}
+	for _, card := range active {
+		checklists, err := card.Checklists()
+		if err != nil {
+			report("unable to read the checklists of %q: %s", card.Name, err)
+			continue
+		}
+		items := map[string]int{}
+		for _, cl := range checklists {
+			for _, ci := range cl.CheckItems {
+				items[ci.Name]++
+			}
+		}
+		for name, count := range items {
+			if count > 1 {
+				report("%q has %d checklist items named %q, rename all but one so each has its own card", card.Name, count, name)
+			}
+		}
+
+		plan, err := PlanReconcile(card)
+		if err != nil {
+			report("unable to check %q: %s", card.Name, err)
+			continue
+		}
+		if len(plan.Changes) == 0 {
+			ok("%q is in step with its task cards", card.Name)
+			continue
+		}
+		for _, c := range plan.Changes {
+			report("%q is out of step: %s, the watcher will fix it when it runs, or fix it by hand", card.Name, describeChange(c))
+		}
+	}
+}
+
+// describeChange says what a Change would do, for people.
+func describeChange(c Change) string {
+	switch c.Op {
+	case "move":
+		return fmt.Sprintf("%q should be moved from %s to %s", c.Card, c.From, c.To)
+	case "create":
+		return fmt.Sprintf("%q has no card, one should be made on %s", c.Card, c.To)
+	case "completeCheckItem":
+		return fmt.Sprintf("%q is done but its checklist item isn't complete", c.Card)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %q %s", c.Op, c.Card, c.To))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// dryRun makes the watcher log every change it would make to Trello instead of making it.
+var dryRun bool
+
+// DryRunError is a Trello request that wasn't sent because of -dry-run.
+type DryRunError struct {
+	Method string
+	Path   string
+}
+
+func (e DryRunError) Error() string {
+	return fmt.Sprintf("dry run, didn't %s %s", e.Method, e.Path)
+}
+
+// dryRunTransport only lets Trello requests that read through, and logs the rest.
+// Plans are logged by Shadow before they get this far, so this catches every other change,
+// like labels, comments, and webhooks.
+type dryRunTransport struct {
+	next http.RoundTripper
+}
+
+func (t dryRunTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !dryRun || r.Method == http.MethodGet || r.Method == http.MethodHead || !strings.HasPrefix(r.URL.String(), trel.API_PREFIX) {
+		return t.next.RoundTrip(r)
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/1/")
+	logger.Printf("Dry run: would %s %s\n", r.Method, path)
+	return nil, DryRunError{Method: r.Method, Path: path}
+}
+
+// logDryRunWebhooks logs the webhooks startup would make or activate for the board.
+func logDryRunWebhooks() {
+	ids := map[string]string{}
+	for _, l := range board.WatchedLists {
+		ids[l.ID] = "list " + l.Name
+	}
+	if cards, err := board.Active.Cards(); err == nil {
+		for _, c := range cards {
+			ids[c.ID] = "card " + c.Name
+		}
+	}
+	for id, what := range ids {
+		wh, err := board.Webhooks.Find(id)
+		if err != nil {
+			logger.Printf("Dry run: would create a webhook for %s\n", what)
+		} else if !wh.Active {
+			logger.Printf("Dry run: would activate the webhook for %s\n", what)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// syncDue copies a checklist item's due date to its task card, and a task card's due date back to its item.
+var syncDue bool
+
+// CheckItemDue is the due date of one checklist item on a card, or nil if it has none.
+func CheckItemDue(cardID, checkItemID string) (*time.Time, error) {
+	cls, err := CardChecklistInfo(cardID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cl := range cls {
+		for _, ci := range cl.CheckItems {
+			if ci.ID == checkItemID {
+				return ci.Due, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// CardDue fetches a card's due date, or nil if it has none.
+func CardDue(cardID string) (*time.Time, error) {
+	var card struct {
+		Due *time.Time `json:"due"`
+	}
+	err := apiDo(http.MethodGet, "cards/"+cardID, url.Values{"fields": {"due"}}, &card)
+	return card.Due, err
+}
+
+// dueParam is a due date the way Trello takes it, with "null" to remove it.
+func dueParam(due *time.Time) string {
+	if due == nil {
+		return "null"
+	}
+	return due.UTC().Format(time.RFC3339)
+}
+
+// dueName is a due date for logs and plans.
+func dueName(due *time.Time) string {
+	if due == nil {
+		return "no due date"
+	}
+	return due.Format(dueFormat)
+}
+
+// SameDue reports whether two due dates are the same, counting two missing ones as the same.
+func SameDue(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// SetCardDue sets a card's due date, or removes it if due is nil.
+func SetCardDue(cardID string, due *time.Time) error {
+	return apiDo(http.MethodPut, "cards/"+cardID, url.Values{"due": {dueParam(due)}}, nil)
+}
+
+// SetCheckItemDue sets a checklist item's due date, or removes it if due is nil.
+func SetCheckItemDue(cardID, checkItemID string, due *time.Time) error {
+	return apiDo(http.MethodPut, "cards/"+cardID+"/checkItem/"+checkItemID, url.Values{"due": {dueParam(due)}}, nil)
+}
+
+// CopyDueToCard gives a task card its checklist item's due date, when -sync-due is on.
+// The card is left alone if it has the date already, so the copy doesn't come back as a change to the card.
+func CopyDueToCard(cardID, projectID, checkItemID string) error {
+	if !syncDue || projectID == "" || checkItemID == "" {
+		return nil
+	}
+	due, err := CheckItemDue(projectID, checkItemID)
+	if err != nil {
+		return err
+	}
+	current, err := CardDue(cardID)
+	if err != nil {
+		return err
+	}
+	if SameDue(due, current) {
+		return nil
+	}
+	if err := SetCardDue(cardID, due); err != nil {
+		return err
+	}
+	timeline.Add(cardID, TimelineEntry{Source: "watcher", Type: "setDue", Detail: dueName(due)})
+	return nil
+}
+
+// SyncDue gives a task card its checklist item's due date once the rest of the plan is done.
+// It does nothing without -sync-due.
+func (p *Plan) SyncDue(c *trel.Card, projectID, checkItemID string) {
+	if !syncDue {
+		return
+	}
+	p.Changes = append(p.Changes, Change{
+		Op: "syncDue", Card: c.Name,
+		apply: func() error { return CopyDueToCard(c.ID, projectID, checkItemID) },
+	})
+}
+
+func (p *Plan) SetCardDue(c *trel.Card, due *time.Time) {
+	p.Changes = append(p.Changes, Change{
+		Op: "setCardDue", Card: c.Name, To: dueName(due),
+		apply: func() error {
+			if err := SetCardDue(c.ID, due); err != nil {
+				return err
+			}
+			timeline.Add(c.ID, TimelineEntry{Source: "watcher", Type: "setDue", Detail: dueName(due)})
+			return nil
+		},
+	})
+}
+
+func (p *Plan) SetCheckItemDue(ci *trel.CheckItem, due *time.Time) {
+	p.Changes = append(p.Changes, Change{
+		Op: "setCheckItemDue", Card: ci.Name, To: dueName(due),
+		apply: func() error {
+			if err := SetCheckItemDue(ci.Checklist.IDCard, ci.ID, due); err != nil {
+				return err
+			}
+			timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "setCheckItemDue", Detail: ci.Name + ": " + dueName(due)})
+			return nil
+		},
+	})
+}
+
+// HandleDueChange copies a To Do or Done card's new due date to its checklist item.
+func (lc ListChange) HandleDueChange() error {
+	plan, err := lc.PlanDueChange()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = lc.Action.ID
+	return RunPlan(plan)
+}
+
+// PlanDueChange works out which checklist item's due date needs changing because a task card's due date changed.
+func (lc ListChange) PlanDueChange() (Plan, error) {
+	card := trel.Card{ID: lc.Action.Data.Card.ID, Name: lc.Action.Data.Card.Name}
+	due := lc.Action.Data.Card.Due
+	plan := Plan{Operation: fmt.Sprintf("setting %q due to %s", card.Name, dueName(due)), Feature: "due-sync"}
+	if !syncDue {
+		return plan, nil
+	}
+
+	// Only task cards have checklist items.
+	listName := lc.Action.Data.List.Name
+	if listName != board.ToDo.Name && !board.IsDone(listName) {
+		return plan, nil
+	}
+
+	ci, err := FindTaskCheckItem(board.Active, card)
+	if _, ok := err.(trel.NotFoundError); ok {
+		// The card isn't for an active project's checklist item.
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	state.Link(ci.ID, card.ID)
+	current, err := CheckItemDue(ci.Checklist.IDCard, ci.ID)
+	if err != nil {
+		return plan, err
+	}
+	// An item with the date already is where the card's date was copied from.
+	if !SameDue(due, current) {
+		plan.SetCheckItemDue(ci, due)
+	}
+	return plan, nil
+}
+
+// HandleCheckItemDue copies an Active project's checklist item's new due date to its task card.
+func (cic CheckItemChange) HandleCheckItemDue() error {
+	plan, err := cic.PlanDueChange()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = cic.Action.ID
+	return RunPlan(plan)
+}
+
+// PlanDueChange works out which task card's due date needs changing because a checklist item's due date changed.
+func (cic CheckItemChange) PlanDueChange() (Plan, error) {
+	ciID, name := cic.Action.Data.CheckItem.ID, cic.Action.Data.CheckItem.Name
+	due := cic.Action.Data.CheckItem.Due
+	plan := Plan{Operation: fmt.Sprintf("setting %q due to %s", name, dueName(due)), Feature: "due-sync"}
+	if !syncDue {
+		return plan, nil
+	}
+
+	cards, err := AllCards(append(board.DoneLists(), board.ToDo)...)
+	if err != nil {
+		return plan, err
+	}
+	card, err := FindTaskCard(cards, ciID, cic.Action.Data.Card.Name, name)
+	if _, ok := err.(trel.NotFoundError); ok {
+		// The item has no card, like a -checkitem-only one.
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	state.Link(ciID, card.ID)
+	current, err := CardDue(card.ID)
+	if err != nil {
+		return plan, err
+	}
+	// A card with the date already is where the item's date was copied from.
+	if !SameDue(due, current) {
+		plan.SetCardDue(card, due)
+	}
+	return plan, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"time"
+)
+
+// Event is a single webhook action the watcher has decided to act on.
+type Event struct {
+	ObjType    string // "list" or "card"
+	ObjID      string
+	ActionID   string
+	ActionType string
+	CardID     string // The card the action is about, if any.
+	Task       string // The task the action is about, if any, see TaskKey.
+
+	handle func() error
+}
+
+// An EventHandler processes an Event.
+type EventHandler func(Event) error
+
+// EventMiddleware wraps an EventHandler with some cross-cutting behavior,
+// the same way http middleware wraps an http.Handler.
+type EventMiddleware func(EventHandler) EventHandler
+
+// ChainEvents wraps h in the given middleware.
+// The first middleware is the outermost, so it sees the Event first.
+func ChainEvents(h EventHandler, mws ...EventMiddleware) EventHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// HandleEvent is the innermost EventHandler, and runs the Event's own handler.
+func HandleEvent(e Event) error {
+	return e.handle()
+}
+
+// eventPipeline is what every received webhook action goes through.
+var eventPipeline = ChainEvents(HandleEvent, SkipDuplicates, LogEvents, RecordRecentEvents, PauseWhenPaused, RecordUsage, RecordStats, RecordTimeline, PauseOnLostAccess, PauseOnClosedLists, ResolveOnFailures, SortToDoAfterEvents)
+
+// LogEvents logs every Event along with how long it took and whether it failed.
+func LogEvents(next EventHandler) EventHandler {
+	return func(e Event) error {
+		start := time.Now()
+		err := next(e)
+		if err != nil {
+			logger.Printf("Event %s on %s %s failed after %s: %s\n", e.ActionType, e.ObjType, e.ObjID, time.Since(start), err)
+		} else {
+			logger.Printf("Event %s on %s %s handled in %s\n", e.ActionType, e.ObjType, e.ObjID, time.Since(start))
+		}
+		return err
+	}
+}
+
+// SkipDuplicates skips an Event whose action was already handled, since Trello redelivers webhooks,
+// and sends an action that moves a card between two watched lists to both of their webhooks.
+// Handled actions are kept with the applied changes, so they are skipped after a restart too.
+func SkipDuplicates(next EventHandler) EventHandler {
+	return func(e Event) error {
+		if e.ActionID == "" {
+			return next(e)
+		}
+		key := "action/" + e.ActionID
+		if applied.Done(key) {
+			usage.Record("duplicate-skip")
+			logger.Printf("Skipping %s %s, it was already handled\n", e.ActionType, e.ActionID)
+			return nil
+		}
+		err := next(e)
+		if err == nil && !heldEvents.Holds(board.ID, e) {
+			// Failed actions aren't marked, so a redelivery can try again,
+			// and held ones are marked once they are handled.
+			applied.Mark(key)
+		}
+		return err
+	}
+}
+
+// eventQueue holds the Events skipped on each board while it can't be changed, by board ID,
+// to handle once it can. It is only used under boardMu, like the board.
+// Held Events are kept in memory, so they are lost if the watcher restarts first.
+type eventQueue map[string][]Event
+
+// heldEvents are the Events skipped by PauseOnLostAccess and PauseOnClosedLists.
+var heldEvents = eventQueue{}
+
+// Hold queues an Event on a board, unless it already is, since Trello redelivers webhooks.
+func (q eventQueue) Hold(boardID string, e Event) {
+	if !q.Holds(boardID, e) {
+		q[boardID] = append(q[boardID], e)
+	}
+}
+
+// Holds reports whether an Event is queued on a board.
+// Events without an action ID can't be told apart, so they never are.
+func (q eventQueue) Holds(boardID string, e Event) bool {
+	if e.ActionID == "" {
+		return false
+	}
+	for _, held := range q[boardID] {
+		if held.ActionID == e.ActionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Release handles a board's held Events with next, in the order they arrived,
+// and marks the ones handled as applied, since they already went past SkipDuplicates.
+// An Event held again by next stays queued.
+func (q eventQueue) Release(boardID string, next EventHandler) {
+	held := q[boardID]
+	if len(held) == 0 {
+		return
+	}
+	delete(q, boardID)
+	logger.Printf("Handling %d events held on %s\n", len(held), board.Name)
+	for _, e := range held {
+		err := next(e)
+		if err != nil {
+			logger.Printf("Held event %s %s failed: %s\n", e.ActionType, e.ActionID, err)
+			continue
+		}
+		if e.ActionID != "" && !q.Holds(boardID, e) {
+			applied.Mark("action/" + e.ActionID)
+		}
+	}
+}
+
+// PauseOnClosedLists holds every Event while one of the board lists is archived,
+// since every handler depends on the lists being usable, and handles them once the lists are restored.
+func PauseOnClosedLists(next EventHandler) EventHandler {
+	return func(e Event) error {
+		// The cached list state may be stale, so refresh it before deciding.
+		if len(board.ClosedLists()) > 0 {
+			board.RefreshLists()
+			if closed := board.ClosedLists(); len(closed) > 0 {
+				usage.Record("closed-list-pause")
+				for _, l := range closed {
+					logger.Printf("Holding %s: the %s list is archived, restore it to resume automation\n", e.ActionType, l.Name)
+				}
+				heldEvents.Hold(board.ID, e)
+				return nil
+			}
+			logger.Println("All lists are restored, resuming automation")
+		}
+		heldEvents.Release(board.ID, next)
+
+		err := next(e)
+		if err != nil {
+			// A list being archived is a likely reason for the failure, so check.
+			board.RefreshLists()
+			for _, l := range board.ClosedLists() {
+				logger.Printf("WARNING: The %s list is archived, automation is paused until it is restored\n", l.Name)
+			}
+		}
+		return err
+	}
+}
+
+// resolveAfterFailures is how many events in a row can fail before the board lists are looked up again.
+const resolveAfterFailures = 3
+
+// consecutiveFailures is how many events in a row have failed on each board, by board ID.
+// It is only used under boardMu, like the board.
+var consecutiveFailures = map[string]int{}
+
+// ResolveOnFailures re-resolves the board lists after several events fail in a row on the board,
+// since a deleted and recreated list makes every handler fail.
+func ResolveOnFailures(next EventHandler) EventHandler {
+	return func(e Event) error {
+		err := next(e)
+		if err == nil {
+			delete(consecutiveFailures, board.ID)
+			return nil
+		}
+
+		consecutiveFailures[board.ID]++
+		if consecutiveFailures[board.ID] >= resolveAfterFailures {
+			delete(consecutiveFailures, board.ID)
+			logger.Printf("%d events failed in a row on %s, re-resolving board lists\n", resolveAfterFailures, board.Name)
+			if rerr := board.Reresolve(); rerr != nil {
+				logger.Printf("Unable to re-resolve board lists: %s\n", rerr)
+			}
+		}
+		return err
+	}
+}
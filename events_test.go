@@ -0,0 +1,70 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestPauseOnClosedLists checks that events arriving while a list is archived are held, rather than dropped as handled,
+// and are handled once the list is restored.
+func TestPauseOnClosedLists(t *testing.T) {
+	fake, _ := watchFake(t)
+	var handled []string
+	event := func(id string) Event {
+		return Event{ActionID: id, ActionType: "updateCard", handle: func() error {
+			handled = append(handled, id)
+			return nil
+		}}
+	}
+	pipeline := ChainEvents(HandleEvent, SkipDuplicates, PauseOnClosedLists)
+
+	fake.list(board.ToDo.ID).Closed = true
+	board.ToDo.Closed = true
+	for _, id := range []string{"a1", "a2", "a1"} {
+		if err := pipeline(event(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(handled) != 0 {
+		t.Fatalf("handled %q while To Do was archived", handled)
+	}
+	if applied.Done("action/a1") {
+		t.Errorf("a held action was marked as handled")
+	}
+
+	fake.list(board.ToDo.ID).Closed = false
+	if err := pipeline(event("a3")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := handled, []string{"a1", "a2", "a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled %q, want %q", got, want)
+	}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if !applied.Done("action/" + id) {
+			t.Errorf("%s wasn't marked as handled", id)
+		}
+	}
+}
+
+// TestResolveOnFailures checks that failures are counted for each board on its own.
+func TestResolveOnFailures(t *testing.T) {
+	watchFake(t)
+	failing := ChainEvents(HandleEvent, ResolveOnFailures)
+	fail := Event{ActionType: "updateCard", handle: func() error { return errors.New("failed") }}
+
+	first, second := board.ID, "other"
+	for _, id := range []string{first, first, second} {
+		board.ID = id
+		failing(fail)
+	}
+	board.ID = first
+	if got := consecutiveFailures[first]; got != 2 {
+		t.Errorf("%d failures counted on the first board, want 2", got)
+	}
+	if got := consecutiveFailures[second]; got != 1 {
+		t.Errorf("%d failures counted on the second board, want 1", got)
+	}
+}
@@ -0,0 +1,661 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fake answers Trello requests over HTTP, rather than behind an interface, because trel and apiDo
+// both send every request through the transport set by useTrelloTransport, so installing it there covers both.
+// Only the replay command and tests need it, so building with -tags noreplay leaves it out of the binary.
+
+// Install makes the fake answer every Trello request, and returns a func that puts the old transports back.
+func (f *FakeTrello) Install() func() {
+	return useTrelloTransport(f)
+}
+
+// RoundTrip answers a Trello API request from the fake, with a 404 for anything it doesn't have.
+func (f *FakeTrello) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/1/"), "/")
+	params := r.URL.Query()
+	if r.Method != http.MethodGet {
+		f.Calls = append(f.Calls, FakeCall{Method: r.Method, Path: path, Params: params})
+	}
+
+	out, ok := f.route(r.Method, strings.Split(path, "/"), params)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Request:    r,
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		body = []byte("not found")
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// fakeMatch reports whether a path matches a pattern like "cards/*/checklists", and returns what each * matched.
+func fakeMatch(parts []string, pattern string) ([]string, bool) {
+	want := strings.Split(pattern, "/")
+	if len(parts) != len(want) {
+		return nil, false
+	}
+	var ids []string
+	for i, w := range want {
+		if w == "*" {
+			ids = append(ids, parts[i])
+		} else if w != parts[i] {
+			return nil, false
+		}
+	}
+	return ids, true
+}
+
+// route answers a request, returning false if what it asks for doesn't exist.
+func (f *FakeTrello) route(method string, parts []string, params url.Values) (interface{}, bool) {
+	var ids []string
+	is := func(m, pattern string) bool {
+		var ok bool
+		ids, ok = fakeMatch(parts, pattern)
+		return ok && m == method
+	}
+
+	switch {
+	case is(http.MethodGet, "members/me"):
+		return map[string]string{"id": f.MemberID}, true
+	case is(http.MethodGet, "members/*/boards"):
+		return f.Boards, true
+	case is(http.MethodGet, "tokens/*"):
+		return map[string]interface{}{"permissions": []TokenPermission{{IDModel: "*", ModelType: "Board", Read: true, Write: true}}}, true
+
+	// Boards
+	case is(http.MethodPost, "boards"):
+		b := &FakeBoard{ID: f.newID(), Name: params.Get("name")}
+		f.Boards = append(f.Boards, b)
+		return map[string]string{"id": b.ID, "name": b.Name, "url": "https://trello.com/b/" + b.ID}, true
+	case is(http.MethodGet, "boards/*"):
+		b := f.board(ids[0])
+		return b, b != nil
+	case is(http.MethodGet, "boards/*/lists"):
+		if f.board(ids[0]) == nil {
+			return nil, false
+		}
+		var lists []*FakeList
+		for _, l := range f.Lists {
+			if l.IDBoard == ids[0] && (params.Get("filter") != "open" || !l.Closed) {
+				lists = append(lists, l)
+			}
+		}
+		sort.SliceStable(lists, func(i, j int) bool { return lists[i].Pos < lists[j].Pos })
+		return lists, true
+	case is(http.MethodPost, "boards/*/lists"):
+		if f.board(ids[0]) == nil {
+			return nil, false
+		}
+		return f.addList(ids[0], params.Get("name"), params.Get("pos")), true
+	case is(http.MethodPost, "lists"):
+		if f.board(params.Get("idBoard")) == nil {
+			return nil, false
+		}
+		return f.addList(params.Get("idBoard"), params.Get("name"), params.Get("pos")), true
+	case is(http.MethodGet, "boards/*/labels"):
+		var labels []*FakeLabel
+		for _, l := range f.Labels {
+			if l.IDBoard == ids[0] {
+				labels = append(labels, l)
+			}
+		}
+		return labels, true
+	case is(http.MethodPost, "labels"):
+		l := &FakeLabel{ID: f.newID(), Name: params.Get("name"), Color: params.Get("color"), IDBoard: params.Get("idBoard")}
+		f.Labels = append(f.Labels, l)
+		return l, true
+	case is(http.MethodGet, "boards/*/actions"):
+		return f.actions(func(a *FakeAction) bool { return a.board == ids[0] }, params), true
+	case is(http.MethodGet, "boards/*/cards/*"):
+		return f.boardCards(ids[0], ids[1] == "all", params.Get("checklists") == "all"), true
+
+	// Lists
+	case is(http.MethodGet, "lists/*"):
+		l := f.list(ids[0])
+		return l, l != nil
+	case is(http.MethodGet, "lists/*/cards"):
+		if f.list(ids[0]) == nil {
+			return nil, false
+		}
+		return f.listCards(ids[0]), true
+
+	// Cards
+	case is(http.MethodPost, "cards"):
+		if f.list(params.Get("idList")) == nil {
+			return nil, false
+		}
+		return f.cardJSON(f.addCard(params.Get("idList"), params.Get("name"), params.Get("desc"), params.Get("pos"))), true
+	case is(http.MethodGet, "cards/*"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		return f.cardJSON(c), true
+	case is(http.MethodPut, "cards/*"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		f.updateCard(c, params)
+		return f.cardJSON(c), true
+	case is(http.MethodDelete, "cards/*"):
+		for i, c := range f.Cards {
+			if c.ID == ids[0] {
+				l := f.list(c.IDList)
+				f.addAction(c, "deleteCard", "", map[string]interface{}{"list": map[string]string{"id": l.ID, "name": l.Name}})
+				f.Cards = append(f.Cards[:i], f.Cards[i+1:]...)
+				return struct{}{}, true
+			}
+		}
+		return nil, false
+	case is(http.MethodGet, "cards/*/checklists"):
+		if f.card(ids[0]) == nil {
+			return nil, false
+		}
+		return f.cardChecklists(ids[0]), true
+	case is(http.MethodPost, "cards/*/checklists"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		cl := f.addChecklist(c, params.Get("name"))
+		if source := f.checklist(params.Get("idChecklistSource")); source != nil {
+			for _, ci := range source.CheckItems {
+				f.addCheckItem(cl, ci.Name, ci.State == "complete", ci.Due)
+			}
+		}
+		return cl, true
+	case is(http.MethodPut, "cards/*/checkItem/*"):
+		ci, cl := f.checkItem(ids[1])
+		if ci == nil || cl.IDCard != ids[0] {
+			return nil, false
+		}
+		f.updateCheckItem(ci, cl, params)
+		return ci, true
+	case is(http.MethodPost, "cards/*/idLabels"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		c.IDLabels = appendMissing(c.IDLabels, params.Get("value"))
+		return c.IDLabels, true
+	case is(http.MethodDelete, "cards/*/idLabels/*"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		c.IDLabels = without(c.IDLabels, ids[1])
+		return c.IDLabels, true
+	case is(http.MethodDelete, "cards/*/stickers/*"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		for i, st := range c.Stickers {
+			if st.ID == ids[1] {
+				c.Stickers = append(c.Stickers[:i], c.Stickers[i+1:]...)
+				return struct{}{}, true
+			}
+		}
+		return nil, false
+	case is(http.MethodPost, "cards/*/idMembers"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		c.IDMembers = appendMissing(c.IDMembers, params.Get("value"))
+		return c.IDMembers, true
+	case is(http.MethodDelete, "cards/*/idMembers/*"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		c.IDMembers = without(c.IDMembers, ids[1])
+		return c.IDMembers, true
+	case is(http.MethodGet, "cards/*/actions"):
+		return f.actions(func(a *FakeAction) bool { return a.card == ids[0] }, params), true
+	case is(http.MethodPost, "cards/*/actions/comments"):
+		c := f.card(ids[0])
+		if c == nil {
+			return nil, false
+		}
+		return f.addAction(c, "commentCard", "", map[string]interface{}{"text": params.Get("text")}), true
+	case is(http.MethodPut, "actions/*/text"):
+		for _, a := range f.Actions {
+			if a.ID == ids[0] && a.Type == "commentCard" {
+				a.Data["text"] = params.Get("value")
+				return a, true
+			}
+		}
+		return nil, false
+
+	// Checklists
+	case is(http.MethodGet, "checklists/*"):
+		cl := f.checklist(ids[0])
+		return cl, cl != nil
+	case is(http.MethodDelete, "checklists/*"):
+		for i, cl := range f.Checklists {
+			if cl.ID == ids[0] {
+				f.Checklists = append(f.Checklists[:i], f.Checklists[i+1:]...)
+				return struct{}{}, true
+			}
+		}
+		return nil, false
+	case is(http.MethodPost, "checklists/*/checkItems"):
+		cl := f.checklist(ids[0])
+		if cl == nil {
+			return nil, false
+		}
+		ci := f.addCheckItem(cl, params.Get("name"), params.Get("checked") == "true", fakeDue(params.Get("due")))
+		f.addAction(f.card(cl.IDCard), "createCheckItem", "", map[string]interface{}{
+			"checkItem": map[string]string{"id": ci.ID, "name": ci.Name, "state": ci.State},
+			"checklist": map[string]string{"id": cl.ID, "name": cl.Name},
+		})
+		return ci, true
+	case is(http.MethodDelete, "checklists/*/checkItems/*"):
+		cl := f.checklist(ids[0])
+		if cl == nil {
+			return nil, false
+		}
+		for i, ci := range cl.CheckItems {
+			if ci.ID == ids[1] {
+				cl.CheckItems = append(cl.CheckItems[:i], cl.CheckItems[i+1:]...)
+				return struct{}{}, true
+			}
+		}
+		return nil, false
+
+	// Webhooks
+	case is(http.MethodPost, "webhooks"):
+		wh := &FakeWebhook{ID: f.newID(), Description: params.Get("description"), IDModel: params.Get("idModel"), CallbackURL: params.Get("callbackURL"), Active: true}
+		f.Webhooks = append(f.Webhooks, wh)
+		return wh, true
+	case is(http.MethodGet, "tokens/*/webhooks"):
+		return f.Webhooks, true
+	case is(http.MethodGet, "webhooks/*"):
+		wh := f.webhook(ids[0])
+		return wh, wh != nil
+	case is(http.MethodPut, "webhooks/*"):
+		wh := f.webhook(ids[0])
+		if wh == nil {
+			return nil, false
+		}
+		if active, err := strconv.ParseBool(params.Get("active")); err == nil {
+			wh.Active = active
+		}
+		return wh, true
+	case is(http.MethodDelete, "webhooks/*"):
+		for i, wh := range f.Webhooks {
+			if wh.ID == ids[0] {
+				f.Webhooks = append(f.Webhooks[:i], f.Webhooks[i+1:]...)
+				return struct{}{}, true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+func (f *FakeTrello) board(id string) *FakeBoard {
+	for _, b := range f.Boards {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func (f *FakeTrello) list(id string) *FakeList {
+	for _, l := range f.Lists {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+func (f *FakeTrello) card(id string) *FakeCard {
+	for _, c := range f.Cards {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *FakeTrello) checklist(id string) *FakeChecklist {
+	for _, cl := range f.Checklists {
+		if cl.ID == id {
+			return cl
+		}
+	}
+	return nil
+}
+
+func (f *FakeTrello) checkItem(id string) (*FakeCheckItem, *FakeChecklist) {
+	for _, cl := range f.Checklists {
+		for _, ci := range cl.CheckItems {
+			if ci.ID == id {
+				return ci, cl
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (f *FakeTrello) webhook(id string) *FakeWebhook {
+	for _, wh := range f.Webhooks {
+		if wh.ID == id {
+			return wh
+		}
+	}
+	return nil
+}
+
+// fakePos is where something goes among positions, for "top", "bottom", a number, or "" meaning the bottom.
+func fakePos(pos string, positions []float64) float64 {
+	top, bottom := 0.0, 0.0
+	for i, p := range positions {
+		if i == 0 || p < top {
+			top = p
+		}
+		if i == 0 || p > bottom {
+			bottom = p
+		}
+	}
+	if pos == "top" {
+		return top - 1024
+	}
+	if n, err := strconv.ParseFloat(pos, 64); err == nil {
+		return n
+	}
+	return bottom + 1024
+}
+
+func (f *FakeTrello) addList(boardID, name, pos string) *FakeList {
+	var positions []float64
+	for _, l := range f.Lists {
+		if l.IDBoard == boardID {
+			positions = append(positions, l.Pos)
+		}
+	}
+	l := &FakeList{ID: f.newID(), Name: name, IDBoard: boardID, Pos: fakePos(pos, positions)}
+	f.Lists = append(f.Lists, l)
+	return l
+}
+
+func (f *FakeTrello) listCards(listID string) []*FakeCard {
+	var cards []*FakeCard
+	for _, c := range f.Cards {
+		if c.IDList == listID && !c.Closed {
+			cards = append(cards, f.cardJSON(c))
+		}
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Pos < cards[j].Pos })
+	return cards
+}
+
+// fakeBoardCard is a card as boards/*/cards sends it, with its checklists if they were asked for.
+type fakeBoardCard struct {
+	*FakeCard
+	Checklists []*FakeChecklist `json:"checklists,omitempty"`
+}
+
+func (f *FakeTrello) boardCards(boardID string, closed, checklists bool) []fakeBoardCard {
+	var cards []fakeBoardCard
+	for _, c := range f.Cards {
+		if c.IDBoard == boardID && (closed || !c.Closed) {
+			bc := fakeBoardCard{FakeCard: f.cardJSON(c)}
+			if checklists {
+				bc.Checklists = f.cardChecklists(c.ID)
+			}
+			cards = append(cards, bc)
+		}
+	}
+	return cards
+}
+
+func (f *FakeTrello) addCard(listID, name, desc, pos string) *FakeCard {
+	var positions []float64
+	for _, c := range f.Cards {
+		if c.IDList == listID {
+			positions = append(positions, c.Pos)
+		}
+	}
+	l := f.list(listID)
+	c := &FakeCard{
+		ID: f.newID(), Name: name, Desc: desc, IDBoard: l.IDBoard, IDList: listID,
+		DateLastActivity: Now(), Pos: fakePos(pos, positions),
+	}
+	c.URL = "https://trello.com/c/" + c.ID
+	f.Cards = append(f.Cards, c)
+	f.addAction(c, "createCard", "", map[string]interface{}{"list": map[string]string{"id": l.ID, "name": l.Name}})
+	return c
+}
+
+// cardJSON is a copy of a card with its checklist IDs and labels filled in.
+func (f *FakeTrello) cardJSON(c *FakeCard) *FakeCard {
+	out := *c
+	out.IDChecklists = nil
+	for _, cl := range f.Checklists {
+		if cl.IDCard == c.ID {
+			out.IDChecklists = append(out.IDChecklists, cl.ID)
+		}
+	}
+	out.Labels = nil
+	for _, l := range f.Labels {
+		for _, id := range c.IDLabels {
+			if l.ID == id {
+				out.Labels = append(out.Labels, l)
+			}
+		}
+	}
+	return &out
+}
+
+func (f *FakeTrello) updateCard(c *FakeCard, params url.Values) {
+	c.DateLastActivity = Now()
+	if name, ok := params["name"]; ok && name[0] != c.Name {
+		f.addAction(c, "updateCard", "name", map[string]interface{}{"old": map[string]string{"name": c.Name}})
+		c.Name = name[0]
+	}
+	if desc, ok := params["desc"]; ok {
+		c.Desc = desc[0]
+	}
+	if closed, err := strconv.ParseBool(params.Get("closed")); err == nil {
+		c.Closed = closed
+	}
+	if due, ok := params["due"]; ok {
+		old := c.Due
+		c.Due = fakeDue(due[0])
+		if !SameDue(old, c.Due) {
+			l := f.list(c.IDList)
+			a := f.addAction(c, "updateCard", "due", map[string]interface{}{
+				"list": map[string]string{"id": l.ID, "name": l.Name},
+				"old":  map[string]*time.Time{"due": old},
+			})
+			a.Data["card"] = map[string]interface{}{"id": c.ID, "name": c.Name, "due": c.Due}
+		}
+	}
+	if to := params.Get("idList"); to != "" && to != c.IDList && f.list(to) != nil {
+		before, after := f.list(c.IDList), f.list(to)
+		var positions []float64
+		for _, other := range f.Cards {
+			if other.IDList == to {
+				positions = append(positions, other.Pos)
+			}
+		}
+		c.IDList, c.IDBoard, c.Pos = to, after.IDBoard, fakePos(params.Get("pos"), positions)
+		f.addAction(c, "updateCard", "idList", map[string]interface{}{
+			"listBefore": map[string]string{"id": before.ID, "name": before.Name},
+			"listAfter":  map[string]string{"id": after.ID, "name": after.Name},
+			"old":        map[string]string{"idList": before.ID},
+		})
+	} else if pos := params.Get("pos"); pos != "" {
+		var positions []float64
+		for _, other := range f.Cards {
+			if other.IDList == c.IDList && other != c {
+				positions = append(positions, other.Pos)
+			}
+		}
+		c.Pos = fakePos(pos, positions)
+	}
+}
+
+func (f *FakeTrello) cardChecklists(cardID string) []*FakeChecklist {
+	var cls []*FakeChecklist
+	for _, cl := range f.Checklists {
+		if cl.IDCard == cardID {
+			cls = append(cls, cl)
+		}
+	}
+	sort.SliceStable(cls, func(i, j int) bool { return cls[i].Pos < cls[j].Pos })
+	return cls
+}
+
+func (f *FakeTrello) addChecklist(c *FakeCard, name string) *FakeChecklist {
+	var positions []float64
+	for _, cl := range f.cardChecklists(c.ID) {
+		positions = append(positions, cl.Pos)
+	}
+	cl := &FakeChecklist{ID: f.newID(), Name: name, IDBoard: c.IDBoard, IDCard: c.ID, Pos: fakePos("bottom", positions)}
+	f.Checklists = append(f.Checklists, cl)
+	return cl
+}
+
+func (f *FakeTrello) addCheckItem(cl *FakeChecklist, name string, checked bool, due *time.Time) *FakeCheckItem {
+	var positions []float64
+	for _, ci := range cl.CheckItems {
+		positions = append(positions, ci.Pos)
+	}
+	ci := &FakeCheckItem{ID: f.newID(), Name: name, State: "incomplete", IDChecklist: cl.ID, Due: due, Pos: fakePos("bottom", positions)}
+	if checked {
+		ci.State = "complete"
+	}
+	cl.CheckItems = append(cl.CheckItems, ci)
+	return ci
+}
+
+func (f *FakeTrello) updateCheckItem(ci *FakeCheckItem, cl *FakeChecklist, params url.Values) {
+	if name, ok := params["name"]; ok {
+		ci.Name = name[0]
+	}
+	if member, ok := params["idMember"]; ok {
+		ci.IDMember = member[0]
+	}
+	if due, ok := params["due"]; ok {
+		ci.Due = fakeDue(due[0])
+	}
+	if state := params.Get("state"); state != "" && state != ci.State {
+		ci.State = state
+		f.addAction(f.card(cl.IDCard), "updateCheckItemStateOnCard", "", map[string]interface{}{
+			"checkItem": map[string]string{"id": ci.ID, "name": ci.Name, "state": ci.State},
+			"checklist": map[string]string{"id": cl.ID, "name": cl.Name},
+		})
+	}
+}
+
+// fakeDue is a due date param, nil if it's missing or "null".
+func fakeDue(param string) *time.Time {
+	if d, err := time.Parse(time.RFC3339, param); err == nil {
+		return &d
+	}
+	return nil
+}
+
+// addAction records a change to a card as an action by the fake's member.
+func (f *FakeTrello) addAction(c *FakeCard, typ, field string, data map[string]interface{}) *FakeAction {
+	data["card"] = map[string]string{"id": c.ID, "name": c.Name}
+	data["board"] = map[string]string{"id": c.IDBoard}
+	a := &FakeAction{ID: f.newID(), Type: typ, Date: Now(), IDMemberCreator: f.MemberID, Data: data, Field: field, board: c.IDBoard, card: c.ID}
+	f.Actions = append(f.Actions, a)
+	return a
+}
+
+// actions lists the actions that pass keep, the filter, since, and before, newest first like Trello does.
+func (f *FakeTrello) actions(keep func(*FakeAction) bool, params url.Values) []*FakeAction {
+	filters := map[string]bool{}
+	for _, t := range strings.Split(params.Get("filter"), ",") {
+		filters[t] = true
+	}
+	// Since is a time, or the ID of an action whose later actions are wanted.
+	first := 0
+	since, err := time.Parse(time.RFC3339, params.Get("since"))
+	if err != nil {
+		for i, a := range f.Actions {
+			if a.ID == params.Get("since") {
+				first = i + 1
+			}
+		}
+	}
+	// Before is the ID of an action whose earlier actions are wanted.
+	end := len(f.Actions)
+	for i, a := range f.Actions {
+		if a.ID == params.Get("before") {
+			end = i
+		}
+	}
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil {
+		limit = 50
+	}
+
+	var out []*FakeAction
+	for i := end - 1; i >= first && len(out) < limit; i-- {
+		a := f.Actions[i]
+		if !keep(a) || (!since.IsZero() && a.Date.Before(since)) {
+			continue
+		}
+		if params.Get("filter") != "" && !filters["all"] && !filters[a.Type] && !filters[a.Type+":"+a.Field] {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func appendMissing(ids []string, id string) []string {
+	for _, have := range ids {
+		if have == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+func without(ids []string, id string) []string {
+	var out []string
+	for _, have := range ids {
+		if have != id {
+			out = append(out, have)
+		}
+	}
+	return out
+}
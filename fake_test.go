@@ -0,0 +1,116 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// Board adds a board with open lists of the given names, in order, and returns the board's ID.
+func (f *FakeTrello) Board(name string, lists ...string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := &FakeBoard{ID: f.newID(), Name: name}
+	f.Boards = append(f.Boards, b)
+	for _, l := range lists {
+		f.addList(b.ID, l, "bottom")
+	}
+	return b.ID
+}
+
+// ListID finds an open list on a board by name, "" if there isn't one.
+func (f *FakeTrello) ListID(boardID, name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range f.Lists {
+		if l.IDBoard == boardID && l.Name == name && !l.Closed {
+			return l.ID
+		}
+	}
+	return ""
+}
+
+// AddCard adds a card to the bottom of a list and returns it.
+func (f *FakeTrello) AddCard(listID, name string) *FakeCard {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addCard(listID, name, "", "bottom")
+}
+
+// AddChecklist adds a checklist to a card, with incomplete items of the given names, and returns it.
+func (f *FakeTrello) AddChecklist(cardID, name string, items ...string) *FakeChecklist {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cl := f.addChecklist(f.card(cardID), name)
+	for _, item := range items {
+		f.addCheckItem(cl, item, false, nil)
+	}
+	return cl
+}
+
+// Move moves a card to a list the way someone using the board would, recording the action.
+func (f *FakeTrello) Move(cardID, listID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updateCard(f.card(cardID), url.Values{"idList": {listID}})
+}
+
+// Check marks a checklist item complete or incomplete the way someone using the board would, recording the action.
+func (f *FakeTrello) Check(checkItemID, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ci, cl := f.checkItem(checkItemID)
+	f.updateCheckItem(ci, cl, url.Values{"state": {state}})
+}
+
+// cardsOn lists the names of the open cards on a list, in order.
+func (f *FakeTrello) cardsOn(listID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, c := range f.listCards(listID) {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// watchFake makes a fake with a board laid out like the README's, installs it, and watches the board.
+// It returns the fake and the board's ID.
+func watchFake(t *testing.T) (*FakeTrello, string) {
+	t.Helper()
+	fake := NewFakeTrello()
+	boardID := fake.Board("Work", "Projects", "Active", "To Do", "Done", "Storage")
+	t.Cleanup(fake.Install())
+	watchBoards(t, boardID)
+	return fake, boardID
+}
+
+// watchBoards resolves the comma separated boards the way setup does, starting from empty state.
+func watchBoards(t *testing.T, boardIDs string) {
+	t.Helper()
+	state = &State{Webhooks: map[string]OwnedWebhook{}, Tasks: map[string]string{}, LastActions: map[string]string{}, Lists: map[string]string{}, Reminders: map[string]time.Time{}, Nudges: map[string]time.Time{}, Writes: map[string][]time.Time{}}
+	applied = &Applied{Keys: map[string]time.Time{}}
+	heldEvents = eventQueue{}
+	consecutiveFailures = map[string]int{}
+	cycles = &Cycles{Cards: map[string]*CardCycle{}}
+	trelClient = trel.New("", "key", "token")
+
+	boards = nil
+	for _, id := range strings.Split(boardIDs, ",") {
+		tb, err := trelClient.Board(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ResolveBoard(tb, []string{"Active", "Done"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		boards = append(boards, &b)
+	}
+	board = *boards[0]
+}
@@ -1,3 +1,6 @@
 module github.com/ifo/trello-watcher
 
-require github.com/ifo/trel v0.0.2
+require (
+	github.com/ifo/trel v0.0.2
+	golang.org/x/crypto v0.14.0
+)
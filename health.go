@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// healthzAPI answers as long as the process is up and serving.
+func healthzAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReadinessProblems lists what stops the watcher from actually watching:
+// Trello being unreachable, access to a board being lost,
+// or a board that hasn't finished starting up, has archived lists, or is missing webhooks.
+func ReadinessProblems() []string {
+	var problems []string
+	if err := apiDo(http.MethodGet, "members/me", url.Values{"fields": {"id"}}, nil); err != nil {
+		problems = append(problems, fmt.Sprintf("Trello is unreachable: %s", err))
+	}
+	for _, b := range boards {
+		if reason, lost := AccessLost(b.ID); lost {
+			problems = append(problems, fmt.Sprintf("%s: %s", b.Name, reason))
+		}
+	}
+
+	ForEachBoard(func() error {
+		lastStartup.Lock()
+		started := lastStartup.reports[board.ID] != nil
+		lastStartup.Unlock()
+		if !started {
+			problems = append(problems, fmt.Sprintf("%s hasn't finished starting up", board.Name))
+			return nil
+		}
+		for _, l := range board.ClosedLists() {
+			problems = append(problems, fmt.Sprintf("the %s list on %s is archived", l.Name, board.Name))
+		}
+		if polling() {
+			return nil
+		}
+		for _, l := range board.WatchedLists {
+			wh, err := board.Webhooks.Find(l.ID)
+			if err != nil || !wh.Active {
+				problems = append(problems, fmt.Sprintf("the %s list on %s has no active webhook", l.Name, board.Name))
+			}
+		}
+		return nil
+	})
+	return problems
+}
+
+// readyzAPI answers 200 once every board is being watched, or 503 with the problems.
+func readyzAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	problems := ReadinessProblems()
+	status := struct {
+		Ready    bool     `json:"ready"`
+		Problems []string `json:"problems,omitempty"`
+	}{Ready: len(problems) == 0, Problems: problems}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// staleDoneAge is how long a card can sit in Done before it should be stored.
+	staleDoneAge = 14 * 24 * time.Hour
+	// largeStorage is how many cards Storage can hold before it is worth pruning.
+	largeStorage = 500
+)
+
+// hygieneInterval is how often the hygiene report is rebuilt, 0 to only build it on request.
+var hygieneInterval time.Duration
+
+// lastHygiene is the latest hygiene report for each board, by board ID.
+var lastHygiene = struct {
+	sync.Mutex
+	reports map[string]*HygieneReport
+}{reports: map[string]*HygieneReport{}}
+
+type HygieneIssue struct {
+	Kind       string `json:"kind"`
+	Card       string `json:"card,omitempty"`
+	Suggestion string `json:"suggestion"`
+}
+
+// HygieneReport is a lint of the board, scored from 0 to 100.
+type HygieneReport struct {
+	Time   time.Time      `json:"time"`
+	Score  int            `json:"score"`
+	Issues []HygieneIssue `json:"issues"`
+}
+
+// BuildHygieneReport checks the board for things that confuse the watcher or clutter the board.
+func BuildHygieneReport() (HygieneReport, error) {
+	report := HygieneReport{Time: Now()}
+	add := func(kind, card, suggestion string) {
+		report.Issues = append(report.Issues, HygieneIssue{Kind: kind, Card: card, Suggestion: suggestion})
+	}
+
+	todo, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return report, err
+	}
+	done, err := ListCardInfo(board.Done.ID)
+	if err != nil {
+		return report, err
+	}
+	storage, err := ListCardInfo(board.Storage.ID)
+	if err != nil {
+		return report, err
+	}
+	active, err := board.Active.Cards()
+	if err != nil {
+		return report, err
+	}
+
+	// Duplicate names make name matching guess.
+	seen := map[string]int{}
+	for _, cards := range [][]CardInfo{todo, done, storage} {
+		for _, c := range cards {
+			seen[c.Name]++
+		}
+	}
+	for name, count := range seen {
+		if count > 1 {
+			add("duplicate", name, fmt.Sprintf("rename or archive %d of the cards with this name", count-1))
+		}
+	}
+
+	for _, c := range todo {
+		if len(c.IDMembers) == 0 {
+			add("unowned", c.Name, "assign a member to the card")
+		}
+		labeled := false
+		for _, id := range c.IDLabels {
+			// Aging labels say nothing about what the card is.
+			if !IsAgingLabel(id) {
+				labeled = true
+			}
+		}
+		if !labeled {
+			add("unlabeled", c.Name, "label the card")
+		}
+	}
+
+	for _, c := range done {
+		if time.Since(c.DateLastActivity) > staleDoneAge {
+			add("staleDone", c.Name, "store or archive the card")
+		}
+	}
+
+	for _, c := range active {
+		if !HasWebhook(c.ID, board.Webhooks) {
+			add("noWebhook", c.Name, "restart the watcher or move the card out of and back into Active")
+		}
+	}
+
+	if len(storage) > largeStorage {
+		add("largeStorage", "", fmt.Sprintf("Storage has %d cards, archive the ones no longer needed", len(storage)))
+	}
+
+	report.Score = 100 - 2*len(report.Issues)
+	if report.Score < 0 {
+		report.Score = 0
+	}
+	return report, nil
+}
+
+// RunHygieneReports rebuilds each board's hygiene report every hygieneInterval.
+func RunHygieneReports() {
+	for range Schedule(hygieneInterval) {
+		ForEachBoard(UpdateHygieneReport)
+	}
+}
+
+// UpdateHygieneReport rebuilds the board's hygiene report.
+func UpdateHygieneReport() error {
+	report, err := BuildHygieneReport()
+	if err != nil {
+		return fmt.Errorf("unable to build hygiene report: %s", err)
+	}
+	usage.Record("hygiene-report")
+	logger.Printf("Board %s hygiene score: %d with %d issues\n", board.Name, report.Score, len(report.Issues))
+	lastHygiene.Lock()
+	lastHygiene.reports[board.ID] = &report
+	lastHygiene.Unlock()
+	return nil
+}
+
+// hygieneAPI serves the latest hygiene report, building one if there isn't one yet.
+func hygieneAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lastHygiene.Lock()
+	report := lastHygiene.reports[board.ID]
+	lastHygiene.Unlock()
+	if report == nil {
+		fresh, err := BuildHygieneReport()
+		if err != nil {
+			logger.Println(err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		report = &fresh
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Println(err)
+	}
+}
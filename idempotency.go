@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// appliedFile is where the keys of applied changes are kept, so a redelivered webhook isn't acted on twice,
+// even after a restart.
+var appliedFile string
+
+// appliedAge is how long an applied key is kept. Trello stops retrying a webhook long before this.
+const appliedAge = 30 * 24 * time.Hour
+
+var applied = &Applied{Keys: map[string]time.Time{}}
+
+// Applied is the set of idempotency keys of changes that have been made, and when.
+type Applied struct {
+	mu   sync.Mutex
+	Keys map[string]time.Time `json:"keys"`
+}
+
+// LoadApplied reads the applied keys from appliedFile, if it exists, dropping old ones.
+func LoadApplied() error {
+	b, err := ioutil.ReadFile(appliedFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	applied.mu.Lock()
+	defer applied.mu.Unlock()
+	if err := json.Unmarshal(b, applied); err != nil {
+		return err
+	}
+	applied.prune(time.Now())
+	return nil
+}
+
+// prune drops the keys older than appliedAge. It must be called with a.mu held.
+func (a *Applied) prune(now time.Time) {
+	for key, t := range a.Keys {
+		if now.Sub(t) > appliedAge {
+			delete(a.Keys, key)
+		}
+	}
+}
+
+// Done reports whether the change with the key has already been made.
+func (a *Applied) Done(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.Keys[key]
+	return ok
+}
+
+// Mark records that the changes with the keys have been made, drops old keys, and saves the keys once.
+func (a *Applied) Mark(keys ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		a.Keys[key] = now
+	}
+	a.prune(now)
+	if appliedFile == "" {
+		return
+	}
+
+	b, err := json.Marshal(a)
+	if err == nil {
+		err = writeFileReplacing(appliedFile, b)
+	}
+	if err != nil {
+		logger.Printf("Unable to save applied changes to %s: %s\n", appliedFile, err)
+	}
+}
+
+// writeFileReplacing writes a file through a temporary file next to it, which then replaces it,
+// so a crash while writing leaves the old file rather than a partly written one.
+func writeFileReplacing(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
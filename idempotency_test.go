@@ -0,0 +1,100 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestAppliedMark checks that marking a key drops old ones, and saves the keys without leaving temporary files.
+func TestAppliedMark(t *testing.T) {
+	dir := t.TempDir()
+	oldFile, oldApplied := appliedFile, applied
+	t.Cleanup(func() { appliedFile, applied = oldFile, oldApplied })
+	appliedFile = filepath.Join(dir, "applied.json")
+	applied = &Applied{Keys: map[string]time.Time{"old": time.Now().Add(-appliedAge - time.Hour)}}
+
+	applied.Mark("new")
+	if applied.Done("old") {
+		t.Errorf("a key older than %s was kept", appliedAge)
+	}
+
+	applied = &Applied{Keys: map[string]time.Time{}}
+	if err := LoadApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if !applied.Done("new") || applied.Done("old") {
+		t.Errorf("loaded %v, want only the new key", applied.Keys)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files were left in the directory, want 1", len(files))
+	}
+}
+
+// TestPlanKeys checks that changes are keyed by the card or checklist item they are about,
+// so same-named items in one plan are each created, and that a replayed plan makes none of them again.
+func TestPlanKeys(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	fake.AddChecklist(project.ID, "Tasks", "review", "review")
+
+	card, err := trelClient.Card(project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		plan, err := PlanActivation(card)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan.ActionID = "a1"
+		if err := plan.Apply(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"review", "review"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+	if got := len(applied.Keys); got != 2 {
+		t.Errorf("%d keys were marked applied, want 2", got)
+	}
+}
+
+// TestSavesReplaceFiles checks that the state, cycles, and stats are saved by replacing their files,
+// without leaving temporary files behind.
+func TestSavesReplaceFiles(t *testing.T) {
+	watchFake(t)
+	oldState, oldCycles, oldStats := stateFile, cyclesFile, statsFile
+	t.Cleanup(func() { stateFile, cyclesFile, statsFile = oldState, oldCycles, oldStats })
+
+	tests := []struct {
+		file *string
+		save func()
+	}{
+		{&stateFile, state.save},
+		{&cyclesFile, cycles.save},
+		{&statsFile, stats.Save},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		*tt.file = filepath.Join(dir, "saved.json")
+		tt.save()
+		tt.save()
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || files[0].Name() != "saved.json" {
+			t.Errorf("saving left %d files in the directory, want only saved.json", len(files))
+		}
+		*tt.file = ""
+	}
+}
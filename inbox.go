@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// inboxName is the optional list new cards are triaged from, empty when there isn't one.
+var inboxName string
+
+// miscProjectName is the project that Inbox cards without a checklist are added to.
+var miscProjectName string
+
+// PlanTriage sorts out a card dropped on the Inbox.
+// A card with a checklist is a project, so it moves to Projects.
+// Anything else becomes an item on the misc project, and a task card:
+// in To Do if the misc project is Active, or in Storage if it isn't.
+func PlanTriage(card trel.Card) (Plan, error) {
+	plan := Plan{Operation: fmt.Sprintf("triaging %q", card.Name), Feature: "inbox-triage"}
+
+	checklists, err := card.Checklists()
+	if err != nil {
+		return plan, err
+	}
+	if len(checklists) > 0 {
+		plan.Move(&card, board.Inbox, board.Projects)
+		return plan, nil
+	}
+
+	misc, err := FindProjectCard(miscProjectName)
+	if err != nil {
+		return plan, fmt.Errorf("unable to find the %q project for Inbox cards: %s", miscProjectName, err)
+	}
+	plan.AddCheckItem(misc, card.Name)
+	if misc.IDList == board.Active.ID {
+		plan.Move(&card, board.Inbox, board.ToDo)
+	} else {
+		plan.Move(&card, board.Inbox, board.Storage)
+	}
+	return plan, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ifo/trel"
+)
+
+// syncLabels copies an Active project card's labels to its task cards, and keeps them in step when the project's labels change.
+var syncLabels bool
+
+// CardLabelIDs fetches the IDs of a card's labels.
+func CardLabelIDs(cardID string) (map[string]bool, error) {
+	var card struct {
+		IDLabels []string `json:"idLabels"`
+	}
+	if err := apiDo(http.MethodGet, "cards/"+cardID, url.Values{"fields": {"idLabels"}}, &card); err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, id := range card.IDLabels {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// CopyProjectLabels gives a task card each of its project card's labels it doesn't have, when -sync-labels is on.
+func CopyProjectLabels(cardID, projectID string) error {
+	if !syncLabels || projectID == "" {
+		return nil
+	}
+	var project struct {
+		Labels []Label `json:"labels"`
+	}
+	if err := apiDo(http.MethodGet, "cards/"+projectID, url.Values{"fields": {"labels"}}, &project); err != nil {
+		return err
+	}
+	if len(project.Labels) == 0 {
+		return nil
+	}
+	has, err := CardLabelIDs(cardID)
+	if err != nil {
+		return err
+	}
+	for _, l := range project.Labels {
+		if has[l.ID] {
+			continue
+		}
+		if err := LabelCard(cardID, l.ID, l.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncLabels gives a task card its project card's labels once the rest of the plan is done.
+// It does nothing without -sync-labels.
+func (p *Plan) SyncLabels(c *trel.Card, projectID string) {
+	if !syncLabels {
+		return
+	}
+	p.Changes = append(p.Changes, Change{
+		Op: "syncLabels", Card: c.Name,
+		apply: func() error { return CopyProjectLabels(c.ID, projectID) },
+	})
+}
+
+// LabelChange is a label being added to or taken off an Active project card.
+type LabelChange struct {
+	Action struct {
+		ID   string `json:"id"`
+		Type string `json:"type"` // "addLabelToCard" or "removeLabelFromCard"
+		Data struct {
+			Card struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"card"`
+			Label struct {
+				ID    string `json:"id"`
+				Name  string `json:"name"`
+				Color string `json:"color"`
+			} `json:"label"`
+		} `json:"data"`
+	} `json:"action"`
+}
+
+// Label adds a label to a task card.
+func (p *Plan) Label(c trel.Card, labelID, name string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "addLabel", Card: c.Name, To: name, id: c.ID,
+		apply: func() error { return LabelCard(c.ID, labelID, name) },
+	})
+}
+
+// Unlabel takes a label off a task card.
+func (p *Plan) Unlabel(c trel.Card, labelID, name string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "removeLabel", Card: c.Name, From: name, id: c.ID,
+		apply: func() error { return UnlabelCard(c.ID, labelID, name) },
+	})
+}
+
+// Handle adds the label to, or takes it off, each of the project's task cards.
+func (lac LabelChange) Handle() error {
+	plan, err := lac.Plan()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = lac.Action.ID
+	return RunPlan(plan)
+}
+
+// Plan works out which of the project's task cards need the label added or taken off.
+// Labels put on task cards by hand are left alone unless the project had the same label.
+func (lac LabelChange) Plan() (Plan, error) {
+	label := lac.Action.Data.Label
+	add := lac.Action.Type == "addLabelToCard"
+	verb := "removing"
+	if add {
+		verb = "adding"
+	}
+	plan := Plan{Operation: fmt.Sprintf("%s label %q on %q", verb, label.Name, lac.Action.Data.Card.Name), Feature: "label-sync"}
+	if !syncLabels {
+		return plan, nil
+	}
+	project, err := trelClient.Card(lac.Action.Data.Card.ID)
+	if err != nil {
+		return plan, err
+	}
+	if project.IDList != board.Active.ID {
+		return plan, nil
+	}
+	tasks, err := ProjectTaskCards(project)
+	if err != nil {
+		return plan, err
+	}
+
+	for _, task := range tasks {
+		has, err := CardLabelIDs(task.ID)
+		if err != nil {
+			return plan, err
+		}
+		switch {
+		case add && !has[label.ID]:
+			plan.Label(task, label.ID, label.Name)
+		case !add && has[label.ID]:
+			plan.Unlabel(task, label.ID, label.Name)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,51 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestLabelChange checks that a project's label is added to or taken off its task cards through a plan,
+// so shadow mode and idempotency keys apply to it.
+func TestLabelChange(t *testing.T) {
+	tests := []struct {
+		action string
+		shadow bool
+		has    []string
+		want   []string
+	}{
+		{"addLabelToCard", false, nil, []string{"l1"}},
+		{"addLabelToCard", true, nil, nil},
+		{"removeLabelFromCard", false, []string{"l1", "l2"}, []string{"l2"}},
+		{"removeLabelFromCard", true, []string{"l1"}, []string{"l1"}},
+	}
+	t.Cleanup(func() { syncLabels, shadowFeatures = false, map[string]bool{} })
+	for _, tt := range tests {
+		fake, boardID := watchFake(t)
+		project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+		fake.AddChecklist(project.ID, "Tasks", "write")
+		task := fake.AddCard(board.ToDo.ID, "write")
+		task.IDLabels = tt.has
+		syncLabels, shadowFeatures = true, map[string]bool{"label-sync": tt.shadow}
+
+		var lac LabelChange
+		lac.Action.ID, lac.Action.Type = "a1", tt.action
+		lac.Action.Data.Card.ID, lac.Action.Data.Card.Name = project.ID, project.Name
+		lac.Action.Data.Label.ID, lac.Action.Data.Label.Name = "l1", "urgent"
+		if err := lac.Handle(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(task.IDLabels, tt.want) {
+			t.Errorf("%s with shadow %v left labels %q, want %q", tt.action, tt.shadow, task.IDLabels, tt.want)
+		}
+		want := 1
+		if tt.shadow {
+			want = 0
+		}
+		if got := len(applied.Keys); got != want {
+			t.Errorf("%s with shadow %v marked %d changes applied, want %d", tt.action, tt.shadow, got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// listenAddr is where the server listens, like ":8080", "127.0.0.1:8080", or "unix:/run/watcher.sock",
+// empty to listen on -port.
+var listenAddr string
+
+// Listen listens on a TCP address, or on a Unix domain socket for an address like "unix:/run/watcher.sock".
+// A socket file left behind by an earlier run is removed first.
+func Listen(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The proxy in front of the watcher may run as another user in the same group.
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SetupLogging points logger at its destination:
+// "tempfile" for a new file under logLoc each run, "stdout", "file" for the rotated logFile, or "both" for stdout and logFile.
+// Log directories are made if they don't exist.
+func SetupLogging(to, logFile string, maxSize int64, maxAge time.Duration, keep int) error {
+	var out io.Writer
+	switch to {
+	case "tempfile":
+		if err := os.MkdirAll(logLoc, 0755); err != nil {
+			return err
+		}
+		f, err := ioutil.TempFile(logLoc, "log_*.log")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("logging to file: %s\n", f.Name())
+		out = f
+	case "stdout":
+		out = os.Stdout
+	case "file", "both":
+		f, err := OpenRotatingFile(logFile, maxSize, maxAge, keep)
+		if err != nil {
+			return err
+		}
+		out = f
+		if to == "both" {
+			out = io.MultiWriter(os.Stdout, f)
+		} else {
+			fmt.Printf("logging to file: %s\n", logFile)
+		}
+	default:
+		return fmt.Errorf("unknown log destination %q, use \"tempfile\", \"stdout\", \"file\", or \"both\"", to)
+	}
+	logger.SetOutput(out)
+	return nil
+}
+
+// RotatingFile is a log file that is moved aside, to its name with the time appended,
+// once it grows past maxSize bytes or gets older than maxAge, whichever is set.
+// Only the newest keep files moved aside are kept, or all of them if keep is 0.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep}
+	return rf, rf.open()
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size, rf.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	full := rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize
+	old := rf.maxAge > 0 && time.Since(rf.opened) > rf.maxAge
+	if full || old {
+		if err := rf.rotate(); err != nil {
+			// Keep logging to the current file rather than losing the line.
+			fmt.Fprintf(os.Stderr, "unable to rotate log file: %s\n", err)
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	aside := rf.path + "." + time.Now().Format("20060102-150405")
+	if err := os.Rename(rf.path, aside); err != nil {
+		// The file was closed, so it has to be reopened either way.
+		if openErr := rf.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	if rf.keep <= 0 {
+		return nil
+	}
+	// The time format sorts oldest first.
+	rotated, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(rotated)
+	for len(rotated) > rf.keep {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+	return nil
+}
@@ -12,7 +12,7 @@
 //
 // Startup involves:
 // - Fetching all trel.List resources.
-// - Ensuring there is a webhook on the Active list.
+// - Ensuring there is a webhook on each watched list (Active and Done by default).
 // - Ensuring all cards on the active board have an active webhook.
 //
 // Watching involves:
@@ -34,6 +34,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ifo/trel"
@@ -44,43 +45,207 @@ const logLoc = "./log/"
 // The capture names exist only as documentation. They are otherwise unused.
 var regex = regexp.MustCompile(".*/(?P<objType>.*)/(?P<objID>.*)/?$")
 
-var logger *log.Logger
+// logger writes to stderr until SetupLogging points it at the -log destination.
+var logger = log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile)
 var trelClient *trel.Client
 var host = os.Getenv("HOST")
 var port = os.Getenv("PORT")
+
+// basePath is the path the server is reached under behind a reverse proxy, like "/trello-watcher", empty for the root.
+// It is added to callback URLs, and taken off requests before they are routed.
+var basePath string
 var board Board
 
-type Board struct {
-	Projects trel.List
-	Active   trel.List
-	ToDo     trel.List
-	Done     trel.List
-	Storage  trel.List
-	Webhooks trel.Webhooks
-}
+// strict makes the watcher refuse to guess in ambiguous situations,
+// such as duplicate card names or list moves it doesn't know about.
+var strict bool
 
-func init() {
-	// Setup logging.
-	logTmp, err := ioutil.TempFile(logLoc, "log_*.log")
-	if err != nil {
-		log.Fatal(err)
-	}
-	logger = log.New(logTmp, "", log.Ldate|log.Ltime|log.Lshortfile)
-	fmt.Printf("logging to file: %s\n", logTmp.Name())
+// checkItemOnly matches checklist items that are too small to get a card, nil when every item gets one.
+var checkItemOnly *regexp.Regexp
 
+// storeComplete and storeIncomplete are what happens to a stored project's task cards, for complete and incomplete
+// checklist items: "storage" to move them to Storage, "archive" to archive them, or "delete" to delete them.
+var storeComplete, storeIncomplete string
+
+// resolveInterval is how often the board lists are looked up again by name,
+// in case one was deleted and recreated.
+var resolveInterval time.Duration
+
+// setup parses the flags, loads the saved state, and resolves the boards the command or server works on.
+// It is run from main, rather than init, so tests can run without the watcher's flags.
+func setup() {
 	// Fetch the trello board lists.
-	var boardID, key, token string
+	var boardIDs, key, token string
+	var err error
 
-	pBoardID := flag.String("board", "", "trello board id")
+	pBoardID := flag.String("board", "", "trello board id, or comma separated ids to watch several boards with the same layout")
 	pKey := flag.String("key", "", "trello api key")
 	pToken := flag.String("token", "", "trello api token")
 	pHost := flag.String("host", "", "server host name (web address)")
 	pPort := flag.String("port", "0", "server port")
+	pStrict := flag.Bool("strict", false, "fail on ambiguous situations instead of guessing")
+	pResolveInterval := flag.Duration("resolve-interval", time.Hour, "how often to re-resolve the board lists by name, 0 to disable")
+	pHygieneInterval := flag.Duration("hygiene-interval", 24*time.Hour, "how often to rebuild the board hygiene report, 0 to disable")
+	pMaxMutations := flag.Int("max-mutations", 100, "most card changes a single activation or storage may make, 0 for no limit")
+	pWebhookLists := flag.String("webhook-lists", "", "comma separated list names that get webhooks (default \"Active,To Do,Done\")")
+	pUsageFile := flag.String("usage-file", "./usage.json", "where to keep the local feature usage ledger, empty to disable")
+	pDoneArchive := flag.String("done-archive", "", "optional list that Done is rolled into, e.g. \"Done Archive\"")
+	pDoneArchiveInterval := flag.Duration("done-archive-interval", 7*24*time.Hour, "how often Done is rolled into the -done-archive list")
+	pRetention := flag.String("retention", "", "comma separated retention rules, like \"archive-done=30d,orphans=archive,max-storage=200\", empty to keep every card")
+	pRetentionInterval := flag.Duration("retention-interval", 24*time.Hour, "how often the -retention rules are applied")
+	pCheckItemOnly := flag.String("checkitem-only", "", "regexp for checklist items that never get a card, e.g. \"^(call|email):\"")
+	pTimezone := flag.String("timezone", "", "IANA timezone days and weeks are counted in, e.g. \"Europe/Berlin\" (default the server's)")
+	pWeekStart := flag.String("week-start", "sunday", "day weeks start on")
+	pSyncMembers := flag.Bool("sync-members", false, "assign a task card's checklist item to the card's member when its members change, and the card to the item's member when it is assigned")
+	pStoreComplete := flag.String("store-complete", "storage", "what happens to the task cards of complete checklist items when their project is stored: \"storage\", \"archive\", or \"delete\"")
+	pStoreIncomplete := flag.String("store-incomplete", "storage", "what happens to the task cards of incomplete checklist items when their project is stored: \"storage\", \"archive\", or \"delete\"")
+	pSortToDo := flag.String("sort-todo", "", "keep To Do sorted by \"checklist\" order, \"due\" date, priority \"label\", or \"name\", empty to leave it as it is")
+	pPriorityLabels := flag.String("priority-labels", "urgent,high,medium,low", "comma separated label names from most to least urgent, for -sort-todo label")
+	pProjectTemplate := flag.String("project-template", "", "name of a card whose checklists are copied onto a project card without any when it is moved to Active, empty to not copy any")
+	pTaskTemplate := flag.String("task-template", "", "Go text/template for the description of task cards the watcher makes, with {{.Project}}, {{.ProjectURL}}, {{.Checklist}}, {{.CheckItem}}, and {{.CheckItemID}}, empty to leave them blank")
+	pSyncLabels := flag.Bool("sync-labels", false, "copy an Active project card's labels to its task cards, and keep them in step when the project's labels change")
+	pSyncDue := flag.Bool("sync-due", false, "copy checklist item due dates to their task cards, and a task card's due date back to its item")
+	pAppliedFile := flag.String("applied-file", "./applied.json", "where to keep the keys of changes already made, so redelivered webhooks are safe, empty to keep them in memory")
+	pInbox := flag.String("inbox", "", "optional list new cards are triaged from, e.g. \"Inbox\"")
+	pMiscProject := flag.String("misc-project", "Misc", "project that Inbox cards without a checklist are added to")
+	pStaleAfter := flag.String("stale-after", "", "how long a card can sit in To Do without moving before it gets a comment nudging about it, like \"14d\", empty to not nudge")
+	pStaleInterval := flag.Duration("stale-interval", time.Hour, "how often To Do is checked for -stale-after cards")
+	pStaleLabel := flag.String("stale-label", "", "label stale To Do cards also get, taken off once they're done, empty to only comment")
+	pAgingInterval := flag.Duration("aging-interval", 0, "how often To Do cards are labeled by how long they've been there, 0 to disable")
+	pShadow := flag.String("shadow", "", "comma separated features that only log what they would do, e.g. \"inbox-triage,done-archive\"")
+	pDigestTo := flag.String("digest-to", "", "comma separated email addresses a weekly digest of the board is sent to, empty to not send one")
+	pDigestFrom := flag.String("digest-from", "", "address the weekly digest is sent from (default the first -digest-to)")
+	pDigestSchedule := flag.String("digest-schedule", "monday 09:00", "day and time of day the weekly digest is sent")
+	pSMTPAddr := flag.String("smtp-addr", "", "host:port of the mail server the weekly digest is sent through")
+	pSMTPUser := flag.String("smtp-user", "", "user to log in to -smtp-addr as, empty to not log in")
+	pSMTPPassword := flag.String("smtp-password", "", "password for -smtp-user (or set WATCHER_SMTP_PASSWORD)")
+	pSummaryTime := flag.String("summary-time", "", "time of day to comment a daily summary on Active project cards, like \"21:30\", empty to disable")
+	pStickerInterval := flag.Duration("sticker-interval", 0, "how often project cards are checked for command stickers, a thumbsup to activate a Projects card and a clock to snooze an Active one, 0 to disable")
+	pBudgetInterval := flag.Duration("budget-interval", time.Hour, "how often Active project cards with a \"budget: 20h\" line get the time their tasks spent in To Do totalled, from -cycles-file, 0 to disable")
+	pCyclesFile := flag.String("cycles-file", "./cycles.json", "where to keep when cards entered and left To Do and Done, for cycle times, empty to disable")
+	pStatsFile := flag.String("stats-file", "./stats.json", "where to keep daily counters and monthly rollups, empty to disable")
+	pPreset := flag.String("preset", "", "bundle of settings to start from: solo-maker, gtd, or kanban-team")
+	pListNames := flag.String("list-names", "", "comma separated role=list pairs for lists not named like the default board, e.g. \"To Do=Zu erledigen\"")
+	pCleanupOnExit := flag.String("cleanup-on-exit", "", "\"deactivate\" or \"delete\" the watcher's webhooks when it is stopped")
+	pStateFile := flag.String("state-file", "./state.json", "where to keep the webhooks the watcher made and which task card is for which checklist item")
+	pPoll := flag.Duration("poll", 0, "read board actions this often instead of using webhooks, for when Trello can't reach the server, 0 to use webhooks")
+	pLog := flag.String("log", "tempfile", "where to log: \"tempfile\" for a new file in ./log/ each run, \"stdout\", \"file\" for -log-file, or \"both\" for stdout and -log-file")
+	pLogFile := flag.String("log-file", "./log/watcher.log", "log file for -log file or both, rotated by -log-max-size and -log-max-age")
+	pLogMaxSize := flag.Int("log-max-size", 10, "megabytes -log-file can grow to before it is rotated, 0 for no limit")
+	pLogMaxAge := flag.Duration("log-max-age", 24*time.Hour, "how long -log-file is written to before it is rotated, 0 for no limit")
+	pLogKeep := flag.Int("log-keep", 7, "how many rotated log files to keep, 0 to keep them all")
+	pRetries := flag.Int("retries", 4, "how many times a Trello request that fails with a network or server error is retried")
+	pRetryBase := flag.Duration("retry-base", 500*time.Millisecond, "how long the first retry of a Trello request waits, doubling for each one after")
+	pRateLimit := flag.Int("rate-limit", 90, "most Trello requests to send every 10 seconds, under Trello's limit of 100 per token, 0 for no limit")
+	pReconcileInterval := flag.Duration("reconcile-interval", 15*time.Minute, "how often active projects are checked for changes missed webhooks left out of sync, 0 to disable")
+	pCreateMissingLists := flag.Bool("create-missing-lists", false, "make any of the board's lists that don't exist, in order, instead of refusing to start")
+	pDryRun := flag.Bool("dry-run", false, "log every change the watcher would make to Trello, including webhooks, instead of making it")
+	pAdminToken := flag.String("admin-token", "", "token the API and admin routes require, as a bearer token or basic auth password (default $WATCHER_ADMIN_TOKEN)")
+	pOnCardRemoved := flag.String("on-card-removed", "", "when a task card is deleted or archived, \"recreate\" it, \"complete\" or \"remove\" its checklist item, or leave the item alone")
+	pOnCheckItemRemoved := flag.String("on-checkitem-removed", "", "when a checklist item or checklist is removed from an Active project, \"delete\" or \"store\" its task cards, or leave them")
+	pRecord := flag.String("record", "", "directory to record every webhook payload handled to, with a snapshot of the boards, for replay")
+	pTunnel := flag.String("tunnel", "", "open a tunnel with \"cloudflared\", \"ngrok\", or a command with {addr} for the local address, and use its URL as -host")
+	pListen := flag.String("listen", "", "address to listen on instead of -port, like \"127.0.0.1:8080\" or \"unix:/run/trello-watcher.sock\"")
+	pBasePath := flag.String("base-path", "", "path the server is reached under behind a reverse proxy, e.g. \"/trello-watcher\"")
+	pTLSCert := flag.String("tls-cert", "", "certificate file to serve HTTPS with, for -host, reloaded when it changes, empty to serve HTTP")
+	pTLSKey := flag.String("tls-key", "", "key file for -tls-cert")
+	pAutocertDir := flag.String("autocert-dir", "", "directory to keep certificates for -host from Let's Encrypt in, to serve HTTPS on port 443 without -tls-cert")
+	pAutocertEmail := flag.String("autocert-email", "", "contact address given to Let's Encrypt with -autocert-dir")
+	pAccessCheckInterval := flag.Duration("access-check-interval", 5*time.Minute, "how often the watcher checks it can still reach each board, 0 to only check when an event fails")
+	pAlertURL := flag.String("alert-url", "", "URL to post alerts to as JSON {\"text\": ...}, like a Slack incoming webhook, such as losing access to a board")
+	pDueReminders := flag.String("due-reminders", "", "comma separated times before a To Do card's due date to remind about it, like \"1d,2h\", empty to not remind")
+	pReminderInterval := flag.Duration("reminder-interval", 5*time.Minute, "how often To Do cards are checked for -due-reminders to send")
+	pReminderURL := flag.String("reminder-url", "", "Slack or Mattermost style incoming webhook URL reminders are also posted to")
+	pActiveLimit := flag.Int("active-limit", 0, "most projects Active can have, a card moved there beyond it is moved back to Projects with a comment, 0 for no limit")
+	pAutoPromote := flag.Bool("auto-promote", false, "move the top Projects card to Active, and set it up, whenever the last project leaves Active")
+	pOnProjectComplete := flag.String("on-project-complete", "", "move an Active project card whose checklist items are all complete to \"Projects\", another list by name, or \"archive\", storing its task cards")
+	pProjectProgress := flag.Bool("project-progress", false, "keep a count of complete checklist items, like \"[3/7]\", at the end of each Active project card's name")
+	pProjectPrefix := flag.Bool("project-prefix", false, "name each task card the watcher makes \"Project: item\", to tell projects apart on To Do")
+	pProjectLabels := flag.Bool("project-labels", false, "label each task card the watcher makes with its project's name, to tell projects apart on To Do")
+	pConfig := flag.String("config", "", "TOML file of settings named like flags, which flags and the environment override")
 	flag.Parse()
 
-	boardID, key, token = *pBoardID, *pKey, *pToken
-	if boardID == "" {
-		boardID = os.Getenv("TRELLO_BOARD_ID")
+	// replay runs against a fake of the boards, so nothing it does is kept.
+	if flag.Arg(0) == "replay" {
+		*pStateFile, *pAppliedFile, *pStatsFile, *pCyclesFile, *pUsageFile, *pRecord = "", "", "", "", "", ""
+	}
+
+	// The setup wizard writes the config file, so it may not exist yet, and it asks for everything else.
+	wizard := flag.Arg(0) == "setup" && (flag.Arg(1) == "-interactive" || flag.Arg(1) == "--interactive")
+	configFile = *pConfig
+	if *pConfig != "" && !wizard {
+		if err := ApplyConfig(*pConfig); err != nil {
+			logger.Fatalln(err)
+		}
+	}
+	if *pPreset != "" {
+		if err := ApplyPreset(*pPreset); err != nil {
+			logger.Fatalln(err)
+		}
+	}
+
+	if err := SetupLogging(*pLog, *pLogFile, int64(*pLogMaxSize)<<20, *pLogMaxAge, *pLogKeep); err != nil {
+		logger.Fatalf("Unable to set up logging: %s\n", err)
+	}
+
+	usageFile = *pUsageFile
+	if err := LoadUsage(); err != nil {
+		logger.Printf("Unable to load usage from %s: %s\n", usageFile, err)
+	}
+
+	if err := SetClock(*pTimezone, *pWeekStart); err != nil {
+		logger.Fatalln(err)
+	}
+
+	dryRun = *pDryRun
+	adminToken = *pAdminToken
+	if adminToken == "" {
+		adminToken = os.Getenv("WATCHER_ADMIN_TOKEN")
+	}
+	appliedFile = *pAppliedFile
+	if err := LoadApplied(); err != nil {
+		logger.Printf("Unable to load applied changes from %s: %s\n", appliedFile, err)
+	}
+	if dryRun {
+		// Actions a dry run only pretended to handle must still be handled by a real run.
+		appliedFile = ""
+	}
+
+	stateFile = *pStateFile
+	if err := LoadState(); err != nil {
+		logger.Printf("Unable to load state from %s: %s\n", stateFile, err)
+	}
+
+	statsFile = *pStatsFile
+	if err := LoadStats(); err != nil {
+		logger.Printf("Unable to load stats from %s: %s\n", statsFile, err)
+	}
+	cyclesFile = *pCyclesFile
+	if err := LoadCycles(); err != nil {
+		logger.Printf("Unable to load cycles from %s: %s\n", cyclesFile, err)
+	}
+	maxRetries, retryBase = *pRetries, *pRetryBase
+	limiter.Limit = *pRateLimit
+	useTrelloTransport(dryRunTransport{next: retryTransport{next: ownWritesTransport{next: throttleTransport{next: countingTransport{next: http.DefaultTransport}}}}})
+
+	// Some commands don't need the board.
+	switch flag.Arg(0) {
+	case "presets", "usage-report":
+		return
+	}
+	if wizard {
+		return
+	}
+
+	boardIDs, key, token = *pBoardID, *pKey, *pToken
+	if flag.Arg(0) == "replay" {
+		if boardIDs, err = SetupReplay(flag.Args()[1:]); err != nil {
+			logger.Fatalln(err)
+		}
+		key, token = "replay", "replay"
+	}
+	if boardIDs == "" {
+		boardIDs = os.Getenv("TRELLO_BOARD_ID")
 	}
 	if key == "" {
 		key = os.Getenv("TRELLO_KEY")
@@ -94,27 +259,191 @@ func init() {
 	if *pPort != "0" {
 		port = *pPort
 	}
-	if boardID == "" || key == "" || token == "" || host == "" || port == "0" {
-		logger.Fatalln("The Board ID, Trello Key and Token, Host, and Port are all required")
+	strict = *pStrict
+	cleanupOnExit = *pCleanupOnExit
+	if cleanupOnExit != "" && cleanupOnExit != "deactivate" && cleanupOnExit != "delete" {
+		logger.Fatalf("Bad -cleanup-on-exit %q, use \"deactivate\" or \"delete\"\n", cleanupOnExit)
+	}
+	if err := SetListNames(*pListNames); err != nil {
+		logger.Fatalln(err)
+	}
+	syncMembers = *pSyncMembers
+	syncDue = *pSyncDue
+	syncLabels = *pSyncLabels
+	projectTemplate = *pProjectTemplate
+	storeComplete, storeIncomplete = *pStoreComplete, *pStoreIncomplete
+	for _, f := range []struct{ name, policy string }{{"store-complete", storeComplete}, {"store-incomplete", storeIncomplete}} {
+		switch f.policy {
+		case "storage", "archive", "delete":
+		default:
+			logger.Fatalf("Bad -%s %q, use \"storage\", \"archive\", or \"delete\"\n", f.name, f.policy)
+		}
+	}
+	sortToDo = *pSortToDo
+	if sortToDo != "" {
+		ok := false
+		for _, s := range toDoSorts {
+			ok = ok || s == sortToDo
+		}
+		if !ok {
+			logger.Fatalf("Bad -sort-todo %q, use \"checklist\", \"due\", \"label\", or \"name\"\n", sortToDo)
+		}
+	}
+	for _, name := range strings.Split(*pPriorityLabels, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			priorityLabels = append(priorityLabels, name)
+		}
+	}
+	if err := SetTaskTemplate(*pTaskTemplate); err != nil {
+		logger.Fatalf("Bad -task-template: %s\n", err)
+	}
+	resolveInterval = *pResolveInterval
+	hygieneInterval = *pHygieneInterval
+	agingInterval = *pAgingInterval
+	budgetInterval = *pBudgetInterval
+	stickerInterval = *pStickerInterval
+	if *pStaleAfter != "" {
+		d, err := ParseDays(*pStaleAfter)
+		if err != nil || d <= 0 {
+			logger.Fatalf("Bad -stale-after %q, use a duration like \"12h\" or days like \"14d\"\n", *pStaleAfter)
+		}
+		staleAfter = d
+	}
+	staleInterval = *pStaleInterval
+	staleLabel = *pStaleLabel
+	summaryTime = *pSummaryTime
+	digestTo = nil
+	for _, to := range strings.Split(*pDigestTo, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			digestTo = append(digestTo, to)
+		}
+	}
+	digestFrom, digestSchedule = *pDigestFrom, *pDigestSchedule
+	if digestFrom == "" && len(digestTo) > 0 {
+		digestFrom = digestTo[0]
+	}
+	smtpAddr, smtpUser, smtpPassword = *pSMTPAddr, *pSMTPUser, *pSMTPPassword
+	if smtpPassword == "" {
+		smtpPassword = os.Getenv("WATCHER_SMTP_PASSWORD")
+	}
+	if len(digestTo) > 0 && smtpAddr == "" {
+		logger.Fatalln("-digest-to needs an -smtp-addr to send through")
+	}
+	maxMutations = *pMaxMutations
+	doneArchiveName = *pDoneArchive
+	inboxName = *pInbox
+	if err := SetShadowFeatures(*pShadow); err != nil {
+		logger.Fatalln(err)
+	}
+	miscProjectName = *pMiscProject
+	if *pCheckItemOnly != "" {
+		if checkItemOnly, err = regexp.Compile(*pCheckItemOnly); err != nil {
+			logger.Fatalf("Bad -checkitem-only pattern: %s\n", err)
+		}
+	}
+	doneArchiveInterval = *pDoneArchiveInterval
+	if err := SetRetention(*pRetention); err != nil {
+		logger.Fatalf("Bad -retention: %s\n", err)
+	}
+	retentionInterval = *pRetentionInterval
+	pollInterval = *pPoll
+	reconcileInterval = *pReconcileInterval
+	accessCheckInterval = *pAccessCheckInterval
+	alertURL = *pAlertURL
+	projectLabels = *pProjectLabels
+	projectPrefix = *pProjectPrefix
+	projectProgress = *pProjectProgress
+	onProjectComplete = *pOnProjectComplete
+	autoPromote = *pAutoPromote
+	activeLimit = *pActiveLimit
+	if err := SetReminderLeads(*pDueReminders); err != nil {
+		logger.Fatalf("Bad -due-reminders: %s\n", err)
+	}
+	reminderInterval = *pReminderInterval
+	reminderURL = *pReminderURL
+	createMissingLists = *pCreateMissingLists
+	listenAddr = *pListen
+	recordDir = *pRecord
+	onCardRemoved = *pOnCardRemoved
+	onCheckItemRemoved = *pOnCheckItemRemoved
+	if onCheckItemRemoved != "" && onCheckItemRemoved != "delete" && onCheckItemRemoved != "store" {
+		logger.Fatalf("Bad -on-checkitem-removed %q, use \"delete\" or \"store\"\n", onCheckItemRemoved)
+	}
+	switch onCardRemoved {
+	case "", "recreate", "complete", "remove":
+	default:
+		logger.Fatalf("Bad -on-card-removed %q, use \"recreate\", \"complete\", or \"remove\"\n", onCardRemoved)
+	}
+	basePath = CleanBasePath(*pBasePath)
+	tlsCert, tlsKey = *pTLSCert, *pTLSKey
+	if (tlsCert == "") != (tlsKey == "") {
+		logger.Fatalln("-tls-cert and -tls-key must be given together")
+	}
+	autocertDir, autocertEmail = *pAutocertDir, *pAutocertEmail
+	if autocertDir != "" && tlsCert != "" {
+		logger.Fatalln("-autocert-dir can't be used with -tls-cert")
+	}
+	if autocertDir != "" && (host == "" || *pTunnel != "") {
+		logger.Fatalln("-autocert-dir needs the -host certificates are got for, and can't be used with -tunnel")
+	}
+	webhookLists := *pWebhookLists
+	if webhookLists == "" {
+		webhookLists = os.Getenv("TRELLO_WEBHOOK_LISTS")
+	}
+	if webhookLists == "" {
+		webhookLists = "Active,To Do,Done"
+	}
+	if key == "" || token == "" {
+		logger.Fatalln("The Trello Key and Token are both required")
+	}
+	if boardIDs == "" && flag.Arg(0) != "bootstrap" {
+		logger.Fatalln("The Board ID is required")
+	}
+	// Only the server needs to know where it is, and only for Trello to send it webhooks.
+	switch flag.Arg(0) {
+	case "", "run":
+		if *pTunnel != "" && !polling() {
+			addr, err := TunnelAddr()
+			if err != nil {
+				logger.Fatalln(err)
+			}
+			if host, err = StartTunnel(*pTunnel, addr); err != nil {
+				logger.Fatalf("Unable to open a tunnel: %s\n", err)
+			}
+			// A tunnel's host changes each run, so its webhooks are no use once the watcher stops.
+			if cleanupOnExit == "" {
+				cleanupOnExit = "delete"
+			}
+		}
+		if (host == "" && !polling()) || (port == "0" && listenAddr == "") {
+			logger.Fatalln("The Host and Port (or -listen) are required to run the server")
+		}
+	case "setup":
+		if host == "" && !polling() {
+			logger.Fatalln("The Host is required to set up webhooks")
+		}
 	}
 
 	// We can leave the username empty because we already know the board id.
 	trelClient = trel.New("", key, token)
-	lists, err := trelClient.Board(boardID)
-	if err != nil {
-		logger.Println(err)
-		logger.Fatalln("Failed to retrieve board lists")
-	}
 
-	listNames := []string{"Projects", "Active", "To Do", "Done", "Storage"}
-	lm := map[string]trel.List{}
-	for _, name := range listNames {
-		l, err := lists.FindList(name)
-		if err != nil {
-			logger.Println(err)
-			logger.Fatalf("The board needs a list named %q\n", name)
+	var watchedNames []string
+	for _, name := range strings.Split(webhookLists, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			watchedNames = append(watchedNames, name)
 		}
-		lm[name] = l
+	}
+
+	watchedListNames = watchedNames
+
+	switch flag.Arg(0) {
+	case "doctor":
+		// doctor checks the boards itself, reporting every problem instead of stopping at the first.
+		doctorBoardIDs = strings.Split(boardIDs, ",")
+		return
+	case "bootstrap":
+		// bootstrap makes its own board.
+		return
 	}
 
 	webhooks, err := trelClient.Webhooks()
@@ -122,36 +451,221 @@ func init() {
 		logger.Println(err)
 		logger.Fatalln("Unable to retrieve webhooks")
 	}
+	state.PruneWebhooks(webhooks)
 
-	// Setup the board global.
-	board = Board{
-		Projects: lm["Projects"],
-		Active:   lm["Active"],
-		ToDo:     lm["To Do"],
-		Done:     lm["Done"],
-		Storage:  lm["Storage"],
-		Webhooks: webhooks,
+	// Every board has the same layout, so they are all resolved the same way.
+	for _, boardID := range strings.Split(boardIDs, ",") {
+		if boardID = strings.TrimSpace(boardID); boardID == "" {
+			continue
+		}
+		lists, err := trelClient.Board(boardID)
+		if err != nil {
+			logger.Println(err)
+			logger.Fatalln("Failed to retrieve board lists")
+		}
+
+		// Fail fast if the token can't make changes to the board.
+		if err := CheckBoardPermissions(lists.ID); err != nil {
+			logger.Fatalln(err)
+		}
+
+		if createMissingLists {
+			if err := CreateMissingLists(lists.ID); err != nil {
+				logger.Fatalf("%s: %s\n", lists.Name, err)
+			}
+		}
+		b, err := ResolveBoard(lists, watchedNames)
+		if err != nil {
+			logger.Fatalf("%s: %s\n", lists.Name, err)
+		}
+		// Each board gets its own copy, so webhooks added or activated on one don't overwrite another's.
+		b.Webhooks = append(trel.Webhooks(nil), webhooks...)
+
+		for _, l := range b.ClosedLists() {
+			logger.Printf("WARNING: The %s list on %s is archived, automation is paused until it is restored\n", l.Name, b.Name)
+		}
+		for _, w := range b.UnwatchedWarnings() {
+			logger.Printf("WARNING: %s: %s\n", b.Name, w)
+		}
+		boards = append(boards, &b)
 	}
+
+	// Commands work on the first board.
+	board = *boards[0]
 }
 
 func main() {
+	setup()
+	if cmd := flag.Arg(0); cmd != "" && cmd != "run" {
+		var err error
+		switch args := flag.Args()[1:]; cmd {
+		case "setup":
+			err = SetupCommand(args)
+		case "status":
+			err = StatusCommand(args)
+		case "teardown":
+			err = TeardownCommand(args)
+		case "doctor":
+			err = DoctorCommand(args)
+		case "bootstrap":
+			err = BootstrapCommand(args)
+		case "import":
+			err = ImportCommand(args)
+		case "export-project":
+			err = ExportProjectCommand(args)
+		case "export-completed":
+			err = ExportCompletedCommand(args)
+		case "card":
+			err = CardCommand(args)
+		case "project":
+			err = ProjectCommand(args)
+		case "presets":
+			err = PresetsCommand(args)
+		case "usage-report":
+			err = UsageReportCommand(args)
+		case "replay":
+			err = ReplayCommand(args)
+		case "migrate":
+			err = MigrateCommand(args)
+		default:
+			err = fmt.Errorf("unknown command %q", cmd)
+		}
+		if err != nil {
+			logger.Println(err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	Run()
+}
+
+// Run serves webhooks and the API, and runs the scheduled jobs, until the process is stopped.
+func Run() {
+	if recordDir != "" {
+		// Recordings are replayed against the boards as they were when recording started.
+		if err := SnapshotBoards(); err != nil {
+			logger.Fatalf("Unable to snapshot the boards for recording: %s\n", err)
+		}
+	}
+
 	// Give the server a second to start before creating webhooks.
 	go func() {
 		time.Sleep(1 * time.Second)
-		SetupInitialWebhooks()
-		cards, err := board.Active.Cards()
+		ForEachBoard(func() error {
+			Startup()
+			return nil
+		})
+		// The poller catches up on its own.
+		if !polling() {
+			CatchUp()
+		}
+	}()
+	go WaitForShutdown()
+
+	if resolveInterval > 0 {
+		go func() {
+			for range Schedule(resolveInterval) {
+				ForEachBoard(func() error {
+					if err := board.Reresolve(); err != nil {
+						logger.Printf("Unable to re-resolve board lists: %s\n", err)
+					}
+					return nil
+				})
+			}
+		}()
+	}
+
+	if hygieneInterval > 0 {
+		go RunHygieneReports()
+	}
+
+	if agingInterval > 0 {
+		go RunAgingLabels()
+	}
+	if staleAfter > 0 && staleInterval > 0 {
+		go RunStaleNudges()
+	}
+	if cyclesFile != "" && budgetInterval > 0 {
+		go RunBudgets()
+	}
+	if stickerInterval > 0 {
+		go RunStickers()
+	}
+	if summaryTime != "" {
+		tick, err := DailyAt(summaryTime)
 		if err != nil {
-			logger.Fatalf("Unable to fetch active cards: %s\n", err)
+			logger.Fatalln(err)
 		}
-		for _, card := range cards {
-			SetupActiveProjectCard(card)
+		go RunDaySummaries(tick)
+	}
+	if len(digestTo) > 0 {
+		tick, err := WeeklyAt(digestSchedule)
+		if err != nil {
+			logger.Fatalln(err)
 		}
-	}()
+		go RunDigests(tick)
+	}
+	if doneArchiveName != "" && doneArchiveInterval > 0 {
+		go RunDoneArchive()
+	}
+	if retention != (RetentionPolicy{}) && retentionInterval > 0 {
+		go RunRetention()
+	}
+	if polling() {
+		go RunPoller()
+	}
+	if reconcileInterval > 0 {
+		go RunReconciler()
+	}
+	if accessCheckInterval > 0 {
+		go RunAccessChecks()
+	}
+	if len(reminderLeads) > 0 && reminderInterval > 0 {
+		go RunDueReminders()
+	}
 
-	http.HandleFunc("/", index)
-	http.HandleFunc("/webhooks", webhooks)
 	logger.Println("Starting server...")
-	logger.Fatalln(http.ListenAndServe(":"+port, nil))
+	if adminToken == "" {
+		logger.Println("WARNING: No -admin-token is set, so the API is open to anyone who can reach the server")
+	}
+	addr := listenAddr
+	if addr == "" {
+		addr = ":" + port
+	}
+	logger.Fatalln(ListenAndServe(addr, Handler()))
+}
+
+// Handler serves Trello's callbacks, the API, and the dashboard, behind the -admin-token and under the -base-path.
+// The routes are on their own ServeMux, rather than http.DefaultServeMux, so tests and other servers can use it.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", index)
+	mux.HandleFunc("/webhooks", boardHandler(webhooksAPI))
+	mux.HandleFunc("/webhooks/", boardHandler(webhooksAPI))
+	mux.HandleFunc("/api/cards/", cardsAPI)
+	mux.HandleFunc("/api/near-misses", nearMissesAPI)
+	mux.HandleFunc("/api/hygiene", boardHandler(hygieneAPI))
+	mux.HandleFunc("/api/pending", pendingAPI)
+	mux.HandleFunc("/api/pending/", pendingAPI)
+	mux.HandleFunc("/api/projects/", boardHandler(projectsAPI))
+	mux.HandleFunc("/api/status", boardHandler(statusAPI))
+	mux.HandleFunc("/api/schema", schemaAPI)
+	mux.HandleFunc("/api/simulate", boardHandler(simulateAPI))
+	mux.HandleFunc("/api/stats", boardHandler(statsAPI))
+	mux.HandleFunc("/api/stats/history", statsHistoryAPI)
+	mux.HandleFunc("/api/shadow", boardHandler(shadowAPI))
+	mux.HandleFunc("/ui", boardHandler(dashboardAPI))
+	mux.HandleFunc("/events", eventsAPI)
+	mux.HandleFunc("/admin/pause", pauseAPI)
+	mux.HandleFunc("/admin/resume", pauseAPI)
+	mux.HandleFunc("/healthz", healthzAPI)
+	mux.HandleFunc("/readyz", readyzAPI)
+	handler := RequireAdmin(mux)
+	if basePath != "" {
+		handler = http.StripPrefix(basePath, handler)
+	}
+	return handler
 }
 
 func index(w http.ResponseWriter, r *http.Request) {
@@ -193,6 +707,17 @@ func index(w http.ResponseWriter, r *http.Request) {
 	objType := captures[1]
 	objID := captures[2]
 
+	// Callbacks without a board are for the first board.
+	var boardID string
+	if m := boardPath.FindStringSubmatch(r.URL.Path); m != nil {
+		boardID = m[1]
+	}
+	if _, ok := FindBoard(boardID); !ok {
+		// Trello removes a webhook when its callback is gone.
+		logger.Printf("Received a webhook for board %s, which isn't watched\n", boardID)
+		http.Error(w, "", http.StatusGone)
+		return
+	}
 	// Attempt to parse the body.
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -201,17 +726,87 @@ func index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	understood, err := DispatchPayload(boardID, objType, objID, body)
+	RecordPayload(boardID, objType, objID, body, understood, err)
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if understood {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// We didn't understand the body, so write a file containing the response received for the item.
+	err = RecordResponse(objType, objID, bytes.NewReader(body))
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DispatchPayload handles a webhook payload for an object on a board, empty for the first board.
+// It reports whether the payload was understood, so ones that weren't can be recorded.
+func DispatchPayload(boardID, objType, objID string, body []byte) (bool, error) {
+	handleEvent := func(e Event) error {
+		defer tasks.Wait(e.Task)()
+		err := WithBoard(boardID, func() error { return eventPipeline(e) })
+		if err == nil {
+			// A failed action isn't seen, so catching up after a restart can try it again.
+			state.SeeAction(boardID, e.ActionID)
+		}
+		return err
+	}
+
 	if objType == "list" {
 		var listChange ListChange
-		if err = json.Unmarshal(body, &listChange); err == nil {
-			err = listChange.Handle()
-			if err != nil {
-				logger.Println(err)
-				http.Error(w, "", http.StatusInternalServerError)
-				return
+		if err := ParsePayload(body, &listChange); err == nil {
+			handle := listChange.Handle
+			switch listChange.Action.Type {
+			case "addMemberToCard", "removeMemberFromCard":
+				var memberChange MemberChange
+				if err = ParsePayload(body, &memberChange); err == nil {
+					schemaReport.Check(body, memberChange)
+					handle = memberChange.Handle
+				}
+			case "updateCard":
+				schemaReport.Check(body, listChange)
+				if listChange.Action.Data.Old.Name != "" {
+					handle = listChange.HandleRename
+				} else if listChange.Action.Data.Old.Closed != nil && listChange.Action.Data.Card.Closed {
+					handle = listChange.HandleRemoved
+				} else if listChange.Action.Data.Old.Due != nil {
+					handle = listChange.HandleDueChange
+				}
+			case "deleteCard":
+				schemaReport.Check(body, listChange)
+				handle = listChange.HandleRemoved
+			case "updateList":
+				schemaReport.Check(body, listChange)
+				if listChange.Action.Data.Old.Name == "" {
+					// Only a rename changes anything the watcher keeps.
+					return false, nil
+				}
+				handle = listChange.HandleListRename
+			default:
+				schemaReport.Check(body, listChange)
+			}
+			if err == nil {
+				err = handleEvent(Event{
+					ObjType:    objType,
+					ObjID:      objID,
+					ActionID:   listChange.Action.ID,
+					ActionType: listChange.Action.Type,
+					CardID:     listChange.Action.Data.Card.ID,
+					Task:       TaskKey(listChange.Action.Data.Card.ID, "", listChange.Action.Data.Card.Name),
+					handle:     handle,
+				})
 			}
-			w.WriteHeader(http.StatusNoContent)
-			return
+			return true, err
 		} else {
 			logger.Println(err)
 		}
@@ -219,43 +814,65 @@ func index(w http.ResponseWriter, r *http.Request) {
 
 	if objType == "card" {
 		var checkItemChange CheckItemChange
-		if err := json.Unmarshal(body, &checkItemChange); err == nil {
+		if err := ParsePayload(body, &checkItemChange); err == nil {
 			var err error
-			var understood bool
+			var handle func() error
 			switch checkItemChange.Action.Type {
 			case "updateCheckItemStateOnCard":
-				err = checkItemChange.Handle()
-				understood = true
+				schemaReport.Check(body, checkItemChange)
+				handle = checkItemChange.Handle
 			case "updateCheckItem":
-				err = checkItemChange.HandleCheckItemRename()
-				understood = true
-			}
-
-			if err != nil {
-				logger.Println(err)
-				http.Error(w, "", http.StatusInternalServerError)
-				return
+				schemaReport.Check(body, checkItemChange)
+				if checkItemChange.Action.Data.Old.Due != nil {
+					handle = checkItemChange.HandleCheckItemDue
+				} else if checkItemChange.Action.Data.Old.IDMember != nil {
+					handle = checkItemChange.HandleCheckItemMember
+				} else {
+					handle = checkItemChange.HandleCheckItemRename
+				}
+			case "createCheckItem", "addChecklistToCard":
+				schemaReport.Check(body, checkItemChange)
+				handle = checkItemChange.HandleCheckItemsAdded
+			case "deleteCheckItem", "removeChecklistFromCard":
+				schemaReport.Check(body, checkItemChange)
+				handle = checkItemChange.HandleCheckItemsRemoved
+			case "addLabelToCard", "removeLabelFromCard":
+				var labelChange LabelChange
+				if lerr := ParsePayload(body, &labelChange); lerr == nil {
+					schemaReport.Check(body, labelChange)
+					handle = labelChange.Handle
+				} else {
+					logger.Println(lerr)
+				}
+			case "addAttachmentToCard":
+				var attachmentChange AttachmentChange
+				if aerr := ParsePayload(body, &attachmentChange); aerr == nil {
+					schemaReport.Check(body, attachmentChange)
+					handle = attachmentChange.Handle
+				} else {
+					logger.Println(aerr)
+				}
 			}
-
+			understood := handle != nil
 			if understood {
-				w.WriteHeader(http.StatusNoContent)
-				return
+				err = handleEvent(Event{
+					ObjType:    objType,
+					ObjID:      objID,
+					ActionID:   checkItemChange.Action.ID,
+					ActionType: checkItemChange.Action.Type,
+					CardID:     checkItemChange.Action.Data.Card.ID,
+					Task:       TaskKey("", checkItemChange.Action.Data.CheckItem.ID, checkItemChange.Action.Data.CheckItem.Name),
+					handle:     handle,
+				})
 			}
 
+			return understood, err
 		} else {
 			logger.Println(err)
 		}
 	}
 
-	// We didn't understand the body, so write a file containing the response received for the item.
-	err = RecordResponse(objType, objID, bytes.NewReader(body))
-	if err != nil {
-		logger.Println(err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
+	return false, nil
 }
 
 type ListChange struct {
@@ -264,23 +881,38 @@ type ListChange struct {
 		Name string `json:"name"`
 	} `json:"model"`
 	Action struct {
-		Type string `json:"type"` // "updateCard"
+		ID   string    `json:"id"`
+		Type string    `json:"type"` // "updateCard"
+		Date time.Time `json:"date"`
 		Data struct {
 			ListAfter struct {
-				ID   string `json:ID`
+				ID   string `json:"id"`
 				Name string `json:"name"`
 			} `json:"listAfter"`
 			ListBefore struct {
-				ID   string `json:ID`
+				ID   string `json:"id"`
 				Name string `json:"name"`
 			} `json:"listBefore"`
+			// List is where a card was created, copied, or moved from another board.
+			List struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"list"`
 			Card struct {
-				ID     string `json:"id"`
-				IDList string `json:"idList"`
-				Name   string `json:"name"`
+				ID     string     `json:"id"`
+				IDList string     `json:"idList"`
+				Name   string     `json:"name"`
+				Closed bool       `json:"closed"`
+				Due    *time.Time `json:"due"`
 			} `json:"card"`
 			Old struct {
 				IDList string `json:"idList"`
+				// Name is set when the card, or for updateList the list, was renamed.
+				Name string `json:"name"`
+				// Closed is set when the card was archived or unarchived.
+				Closed *bool `json:"closed"`
+				// Due is set, to null if there wasn't one, when the card's due date changed.
+				Due json.RawMessage `json:"due"`
 			} `json:"old"`
 		} `json:"data"`
 	} `json:"action"`
@@ -288,48 +920,117 @@ type ListChange struct {
 
 func (lc ListChange) Handle() error {
 	logger.Printf("ListChange being handled for card %s\n", lc.Action.Data.Card.ID)
-	card, err := trelClient.Card(lc.Action.Data.Card.ID)
+	lc.RecordCycles()
+	plan, err := lc.Plan()
 	if err != nil {
 		return err
 	}
+	plan.ActionID = lc.Action.ID
+	return RunPlan(plan)
+}
+
+// Plan works out what needs to change because of the card move, without changing anything.
+func (lc ListChange) Plan() (Plan, error) {
+	card, err := trelClient.Card(lc.Action.Data.Card.ID)
+	if err != nil {
+		return Plan{}, err
+	}
 
+	// The payload has the lists' names as they are now, so catch up on any renames missed.
+	board.RenameList(lc.Action.Data.ListAfter.ID, lc.Action.Data.ListAfter.Name)
+	board.RenameList(lc.Action.Data.ListBefore.ID, lc.Action.Data.ListBefore.Name)
+	board.RenameList(lc.Action.Data.List.ID, lc.Action.Data.List.Name)
 	afterName := lc.Action.Data.ListAfter.Name
 	beforeName := lc.Action.Data.ListBefore.Name
 
+	// Cards that arrive on the Inbox get triaged.
+	if board.Inbox.ID != "" {
+		switch lc.Action.Type {
+		case "createCard", "copyCard", "moveCardToBoard":
+			if lc.Action.Data.List.ID == board.Inbox.ID {
+				return PlanTriage(card)
+			}
+		default:
+			if afterName == board.Inbox.Name && beforeName != board.Inbox.Name {
+				return PlanTriage(card)
+			}
+		}
+		// Moves out of the Inbox are triage, which is already done.
+		if beforeName == board.Inbox.Name {
+			return Plan{}, nil
+		}
+	}
+
 	// Ignore all moves to and from storage
 	if beforeName == board.Storage.Name || afterName == board.Storage.Name {
-		return nil
+		return Plan{}, nil
+	}
+	// Moving between Done and the Done archive doesn't change anything.
+	if board.IsDone(beforeName) && board.IsDone(afterName) {
+		return Plan{}, nil
 	}
 
-	// The card moved to Active from Projects, so set it up.
+	// The card moved to Active from Projects, so set it up, unless Active already has as many projects as it can.
+	// A project without checklists gets the template's first.
 	if afterName == board.Active.Name && beforeName == board.Projects.Name {
-		return SetupActiveProjectCard(card)
+		if plan, over, err := PlanActiveLimit(card); over || err != nil {
+			return plan, err
+		}
+		if plan, stamped, err := PlanProjectTemplate(card); stamped || err != nil {
+			return plan, err
+		}
+		return PlanSetupActiveProject(card)
 	}
-	// The card moved to Projects from Active, so store it.
-	if afterName == board.Projects.Name && beforeName == board.Active.Name {
-		return StoreInactiveProjectCard(card)
+	// The card moved to Projects from Active, or to where finished projects go, so store it,
+	// if it wasn't already when it was moved there, and promote the next project if Active is left empty.
+	if beforeName == board.Active.Name && (afterName == board.Projects.Name || (onProjectComplete != "" && afterName == onProjectComplete)) {
+		plan, err := PlanStoreInactiveProject(card)
+		if err != nil {
+			return plan, err
+		}
+		err = PlanPromotion(&plan, card.ID)
+		return plan, err
 	}
 
 	// The card moved to Done from To Do, so complete the CheckItem.
 	if afterName == board.Done.Name && beforeName == board.ToDo.Name {
-		if ci, err := FindListCheckItem(board.Active, card.Name); err == nil {
-			return ci.Complete()
-		} else {
-			return err
+		plan := Plan{Operation: fmt.Sprintf("completing %q", card.Name)}
+		ci, err := FindTaskCheckItem(board.Active, card)
+		if err != nil {
+			return plan, err
+		}
+		state.Link(ci.ID, card.ID)
+		plan.Complete(ci)
+		if onProjectComplete != "" {
+			project, err := trelClient.Card(ci.Checklist.IDCard)
+			if err != nil {
+				return plan, err
+			}
+			err = PlanProjectComplete(&plan, project, ci.ID)
+			return plan, err
 		}
+		return plan, nil
 	}
 
 	// The card moved to To Do from Done, so mark the CheckItem incomplete.
-	if afterName == board.ToDo.Name && beforeName == board.Done.Name {
-		if ci, err := FindListCheckItem(board.Active, card.Name); err == nil {
-			return ci.Incomplete()
-		} else {
-			return err
+	if afterName == board.ToDo.Name && board.IsDone(beforeName) {
+		plan := Plan{Operation: fmt.Sprintf("reopening %q", card.Name)}
+		ci, err := FindTaskCheckItem(board.Active, card)
+		if err != nil {
+			return plan, err
 		}
+		state.Link(ci.ID, card.ID)
+		plan.Incomplete(ci)
+		return plan, nil
+	}
+
+	// In strict mode, a move we don't understand is an error rather than something to ignore.
+	if strict && afterName != "" && beforeName != "" {
+		return Plan{}, fmt.Errorf("unknown transition for card %q from %q to %q", card.Name, beforeName, afterName)
 	}
 
 	// The card wasn't moved to or from Projects or Active, so don't do anything.
-	return nil
+	return Plan{}, nil
 }
 
 type CheckItemChange struct {
@@ -338,8 +1039,13 @@ type CheckItemChange struct {
 		Name string `json:"name"`
 	} `json:"model"`
 	Action struct {
+		ID string `json:"id"`
 		// "updateCheckItemStateOnCard"
 		// "updateCheckItem"
+		// "createCheckItem"
+		// "addChecklistToCard"
+		// "deleteCheckItem"
+		// "removeChecklistFromCard"
 		Type string `json:"type"`
 		Data struct {
 			Card struct {
@@ -347,9 +1053,11 @@ type CheckItemChange struct {
 				Name string `json:"name"`
 			} `json:"card"`
 			CheckItem struct {
-				ID    string `json:"id"`
-				Name  string `json:"name"`
-				State string `json:"state"`
+				ID       string     `json:"id"`
+				Name     string     `json:"name"`
+				State    string     `json:"state"`
+				Due      *time.Time `json:"due"`
+				IDMember string     `json:"idMember"`
 			} `json:"checkItem"`
 			Checklist struct {
 				ID   string `json:"id"`
@@ -357,38 +1065,88 @@ type CheckItemChange struct {
 			} `json:"checklist"`
 			Old struct {
 				Name string `json:"name"`
+				// Due is set, to null if there wasn't one, when the item's due date changed.
+				Due json.RawMessage `json:"due"`
+				// IDMember is set, to null if there wasn't one, when the item was assigned or unassigned.
+				IDMember json.RawMessage `json:"idMember"`
 			} `json:"old"`
 		} `json:"data"`
 	} `json:"action"`
 }
 
 func (cic CheckItemChange) Handle() error {
+	plan, err := cic.Plan()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = cic.Action.ID
+	if onProjectComplete != "" && cic.Action.Data.CheckItem.State == "complete" {
+		project, err := trelClient.Card(cic.Action.Data.Card.ID)
+		if err != nil {
+			return err
+		}
+		if err := PlanProjectComplete(&plan, project, cic.Action.Data.CheckItem.ID); err != nil {
+			return err
+		}
+	}
+	plan.UpdateProgress(cic.Action.Data.Card.ID, cic.Action.Data.Card.Name)
+	return RunPlan(plan)
+}
+
+// Plan works out which card needs to move or be created because of the CheckItem change.
+func (cic CheckItemChange) Plan() (Plan, error) {
 	ciName := cic.Action.Data.CheckItem.Name
 	ciState := cic.Action.Data.CheckItem.State
 	logger.Printf("CheckItemChange made with name %s and state %s\n", ciName, ciState)
+	plan := Plan{Operation: fmt.Sprintf("marking %q %s", ciName, ciState)}
+	if IsCheckItemOnly(ciName) {
+		return plan, nil
+	}
 	// A CheckItem was marked complete, so move the card to Done.
+	ciID := cic.Action.Data.CheckItem.ID
 	if ciState == "complete" {
-		card, err := board.ToDo.FindCard(ciName)
+		card, err := FindListTaskCard(board.ToDo, ciID, cic.Action.Data.Card.Name, ciName)
 		if err != nil {
-			return err
+			return plan, err
 		}
-		return card.Move(board.Done.ID)
+		state.Link(ciID, card.ID)
+		plan.Move(card, board.ToDo, board.Done)
+		return plan, nil
 	}
 
 	// A CheckItem was created or marked incomplete, so move it to To Do or make one.
 	if ciState == "incomplete" {
-		card, err := board.Done.FindCard(ciName)
+		doneCards, err := AllCards(board.DoneLists()...)
+		if err != nil {
+			return plan, err
+		}
+		card, err := FindTaskCard(doneCards, ciID, cic.Action.Data.Card.Name, ciName)
 		if _, ok := err.(trel.NotFoundError); ok {
 			// Check to see if the card already exists, and if not, make it.
-			if _, err = board.ToDo.FindCard(ciName); err != nil {
+			_, err = FindListTaskCard(board.ToDo, ciID, cic.Action.Data.Card.Name, ciName)
+			if _, ok := err.(trel.NotFoundError); ok {
 				// Make the card, because we did not find it anywhere.
-				_, err = board.ToDo.NewCard(ciName, "", "bottom")
+				// But first, report any similar names that may have been meant.
+				if cards, err := AllCards(board.ToDo); err == nil {
+					ReportNearMisses(ciName, AppendCards(cards, doneCards))
+				}
+				var member string
+				if ciID != "" {
+					if member, err = CheckItemMember(cic.Action.Data.Card.ID, ciID); err != nil {
+						return plan, err
+					}
+				}
+				plan.CreateFor(TaskCardName(cic.Action.Data.Card.Name, ciName), board.ToDo, member, ciID, cic.Action.Data.Card.ID)
+				return plan, nil
 			}
-			return err
+			return plan, err
+		} else if err != nil {
+			return plan, err
 		}
-		return card.Move(board.ToDo.ID)
+		state.Link(ciID, card.ID)
+		plan.Move(card, board.Done, board.ToDo)
 	}
-	return nil
+	return plan, nil
 }
 
 func RecordResponse(objType, objID string, r io.Reader) error {
@@ -411,49 +1169,87 @@ func RecordResponse(objType, objID string, r io.Reader) error {
 }
 
 func SetupActiveProjectCard(card trel.Card) error {
-	if !HasWebhook(card.ID, board.Webhooks) {
-		wh, err := DefaultWebhook(trelClient, "card", card.ID)
-		if err != nil {
-			return err
-		}
-		board.Webhooks = append(board.Webhooks, wh)
+	plan, err := PlanSetupActiveProject(card)
+	if err != nil {
+		return err
 	}
+	return RunPlan(plan)
+}
 
-	// Ensure webhook is active.
-	wh, err := board.Webhooks.Find(card.ID)
+// PlanSetupActiveProject is PlanActivation, after making sure the card has an active webhook.
+func PlanSetupActiveProject(card trel.Card) (Plan, error) {
+	plan, err := PlanActivation(card)
 	if err != nil {
-		return err
+		return plan, err
 	}
-	if err := wh.Activate(); err != nil {
-		return err
+	plan.Feature = "activate-project"
+	plan.UpdateProgress(card.ID, card.Name)
+	if polling() {
+		return plan, nil
 	}
 
+	webhook := Change{
+		Op: "activateWebhook", Card: card.Name,
+		apply: func() error {
+			if !HasWebhook(card.ID, board.Webhooks) {
+				wh, err := DefaultWebhook(trelClient, "card", card.ID)
+				if err != nil {
+					return err
+				}
+				board.Webhooks = append(board.Webhooks, wh)
+			}
+
+			// Ensure webhook is active.
+			wh, err := board.Webhooks.Find(card.ID)
+			if err != nil {
+				return err
+			}
+			return wh.Activate()
+		},
+	}
+	plan.Changes = append([]Change{webhook}, plan.Changes...)
+	return plan, nil
+}
+
+// PlanActivation works out which cards need to be moved out of Storage or created for an active project card.
+// Trello sends checklists and their items in order, and the cards go to the bottom of their list one after another,
+// so they end up in the order of the checklist items.
+func PlanActivation(card trel.Card) (Plan, error) {
+	plan := Plan{Operation: fmt.Sprintf("activating %q", card.Name)}
+
 	checklists, err := card.Checklists()
 	if err != nil {
-		return err
+		return plan, err
 	}
 
 	cards, err := board.Storage.Cards()
 	if err != nil {
-		return err
+		return plan, err
 	}
 
 	todoCards, err := board.ToDo.Cards()
 	if err != nil {
-		return err
+		return plan, err
 	}
 
-	doneCards, err := board.Done.Cards()
+	doneCards, err := AllCards(board.DoneLists()...)
 	if err != nil {
-		return err
+		return plan, err
 	}
 
-	// Before we load up any cards in the Done list, we need to deactivate the webhook to prevent a bunch of card moving spam.
-	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
-		wh.Deactivate()
+	// The project description can limit which checklists are brought back.
+	selected := SelectedChecklists(card.Description)
+
+	// Cards for assigned checklist items are assigned to the same member.
+	members, err := CheckItemMembers(card.ID)
+	if err != nil {
+		return plan, err
 	}
 
 	for _, cl := range checklists {
+		if len(selected) > 0 && !selected[cl.Name] {
+			continue
+		}
 
 		// If every item in the checklist is complete, skip adding them to the board.
 		allComplete := true
@@ -468,118 +1264,170 @@ func SetupActiveProjectCard(card trel.Card) error {
 		}
 
 		for _, ci := range cl.CheckItems {
+			if IsCheckItemOnly(ci.Name) {
+				continue
+			}
+			list := board.ToDo
+			if ci.State == "complete" {
+				list = board.Done
+			}
+
 			// Either find the card and move it, or make one.
-			c, err := cards.Find(ci.Name)
+			c, err := FindTaskCard(cards, ci.ID, card.Name, ci.Name)
 			if _, ok := err.(trel.NotFoundError); ok {
-				// See if the card exists on another board, otherwise make it.
-				if _, err := todoCards.Find(ci.Name); err == nil {
-					return nil
-				}
-				if _, err := doneCards.Find(ci.Name); err == nil {
-					return nil
-				}
-				// Make the card.
-				list := board.ToDo
-				if ci.State == "complete" {
-					list = board.Done
+				// See if the card exists on another list, otherwise make it.
+				// Either way it is linked, so another project's task with the same name can't be taken for it.
+				if c, err := FindTaskCard(todoCards, ci.ID, card.Name, ci.Name); err == nil {
+					state.Link(ci.ID, c.ID)
+					continue
 				}
-				_, cardErr := list.NewCard(ci.Name, "", "bottom")
-				if cardErr != nil {
-					return err
+				if c, err := FindTaskCard(doneCards, ci.ID, card.Name, ci.Name); err == nil {
+					state.Link(ci.ID, c.ID)
+					continue
 				}
+				// Make the card, reporting any similar names that may have been meant.
+				ReportNearMisses(ci.Name, AppendCards(cards, todoCards, doneCards))
+				plan.CreateFor(TaskCardName(card.Name, ci.Name), list, members[ci.Name], ci.ID, card.ID)
+			} else if err != nil {
+				return plan, err
 			} else {
-				// Move the card.
-				list := board.ToDo
-				if ci.State == "complete" {
-					list = board.Done
-				}
-				err := c.Move(list.ID)
-				if err != nil {
-					return err
-				}
+				state.Link(ci.ID, c.ID)
+				plan.MoveToBottom(c, board.Storage, list)
+				plan.SyncDue(c, card.ID, ci.ID)
+				plan.SyncLabels(c, card.ID)
 			}
 		}
 	}
 
-	// Reactivate the Done webhook.
-	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
-		wh.Activate()
-	}
-
-	return nil
+	return plan, nil
 }
 
-func StoreInactiveProjectCard(card trel.Card) error {
-	// Move all cards to storage
+// PlanStorage works out which To Do and Done cards need to be moved to Storage for an inactive project card,
+// or archived or deleted instead, as -store-complete and -store-incomplete say.
+func PlanStorage(card trel.Card) (Plan, error) {
+	plan := Plan{Operation: fmt.Sprintf("storing %q", card.Name)}
+
+	// Move all cards to storage, unless they are archived or deleted.
 	checklists, err := card.Checklists()
 	if err != nil {
-		return err
+		return plan, err
 	}
 
 	// Collect all cards on the To Do and Done boards.
 	todoCards, err := board.ToDo.Cards()
 	if err != nil {
-		return err
+		return plan, err
 	}
-	doneCards, err := board.Done.Cards()
+	doneCards, err := AllCards(board.DoneLists()...)
 	if err != nil {
-		return err
+		return plan, err
 	}
 	cards := append(todoCards, doneCards...)
 
-	// Before we remove any cards from the Done list, we need to deactivate the webhook to prevent a bunch of card moving spam.
-	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
-		wh.Deactivate()
-	}
-
 	for _, cl := range checklists {
 		for _, ci := range cl.CheckItems {
-			c, err := cards.Find(ci.Name)
+			c, err := FindTaskCard(cards, ci.ID, card.Name, ci.Name)
 			if _, ok := err.(trel.NotFoundError); ok {
 				// Ignore cards that are missing.
 				// They will be created later if this project becomes active again.
 				continue
+			} else if err != nil {
+				return plan, err
 			}
-			// Move the card.
-			err = c.Move(board.Storage.ID)
-			if err != nil {
-				return err
+			from := board.ToDo
+			for _, l := range board.DoneLists() {
+				if c.IDList == l.ID {
+					from = l
+				}
+			}
+			policy := storeIncomplete
+			if ci.State == "complete" {
+				policy = storeComplete
+			}
+			switch policy {
+			case "archive":
+				plan.Archive(c, from)
+			case "delete":
+				plan.RemoveCard(c, from)
+			default:
+				plan.Move(c, from, board.Storage)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// IsCheckItemOnly reports whether a checklist item is only tracked as a checklist item, and never gets a card.
+func IsCheckItemOnly(name string) bool {
+	return checkItemOnly != nil && checkItemOnly.MatchString(name)
+}
+
+// SelectedChecklists reads a "checklists:" line from a project card description.
+// e.g. "checklists: Phase 1, Phase 2" only materializes those two checklists.
+// An empty result means every checklist should be used.
+func SelectedChecklists(desc string) map[string]bool {
+	selected := map[string]bool{}
+	for _, line := range strings.Split(desc, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(strings.ToLower(line), "checklists:") {
+			continue
+		}
+		for _, name := range strings.Split(line[len("checklists:"):], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				selected[name] = true
 			}
 		}
 	}
+	return selected
+}
 
-	// Reactivate the Done webhook.
-	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
-		wh.Activate()
+func StoreInactiveProjectCard(card trel.Card) error {
+	plan, err := PlanStoreInactiveProject(card)
+	if err != nil {
+		return err
 	}
+	return RunPlan(plan)
+}
 
-	// Deactivate this card's webhook if it exists.
-	webhook, err := board.Webhooks.Find(card.ID)
+// PlanStoreInactiveProject is PlanStorage, followed by deactivating the card's webhook.
+func PlanStoreInactiveProject(card trel.Card) (Plan, error) {
+	plan, err := PlanStorage(card)
 	if err != nil {
-		logger.Println(err)
-		// Ignore webhooks that are missing.
-		return nil
+		return plan, err
+	}
+	plan.Feature = "store-project"
+	if polling() {
+		return plan, nil
 	}
-	return webhook.Deactivate()
+
+	plan.Changes = append(plan.Changes, Change{
+		Op: "deactivateWebhook", Card: card.Name,
+		apply: func() error {
+			// Deactivate this card's webhook if it exists.
+			webhook, err := board.Webhooks.Find(card.ID)
+			if err != nil {
+				logger.Println(err)
+				// Ignore webhooks that are missing.
+				return nil
+			}
+			return webhook.Deactivate()
+		},
+	})
+	return plan, nil
 }
 
 func SetupInitialWebhooks() {
-	if !HasWebhook(board.Active.ID, board.Webhooks) {
-		hook, err := DefaultWebhook(trelClient, "list", board.Active.ID)
-		if err != nil {
-			logger.Println(err)
-			logger.Fatalln("Unable to create Webhook for Active list")
-		}
-		board.Webhooks = append(board.Webhooks, hook)
+	// The poller reads the actions webhooks would have sent.
+	if polling() {
+		return
 	}
-
-	if !HasWebhook(board.Done.ID, board.Webhooks) {
-		hook, err := DefaultWebhook(trelClient, "list", board.Done.ID)
-		if err != nil {
-			logger.Println(err)
-			logger.Fatalln("Unable to create Webhook for Active list")
-		}
-		board.Webhooks = append(board.Webhooks, hook)
+	if dryRun {
+		logDryRunWebhooks()
+		return
+	}
+	if err := EnsureListWebhooks(); err != nil {
+		logger.Fatalln(err)
 	}
 
 	cards, err := board.Active.Cards()
@@ -600,6 +1448,33 @@ func SetupInitialWebhooks() {
 	}
 }
 
+// EnsureListWebhooks makes sure every watched list has a webhook.
+func EnsureListWebhooks() error {
+	if polling() {
+		return nil
+	}
+	if dryRun {
+		logDryRunWebhooks()
+		return nil
+	}
+	for _, l := range board.WatchedLists {
+		if !HasWebhook(l.ID, board.Webhooks) {
+			hook, err := DefaultWebhook(trelClient, "list", l.ID)
+			if err != nil {
+				return fmt.Errorf("unable to create Webhook for %s list: %s", l.Name, err)
+			}
+			board.Webhooks = append(board.Webhooks, hook)
+			continue
+		}
+		// The webhook may have been deactivated on shutdown.
+		wh, _ := board.Webhooks.Find(l.ID)
+		if err := wh.Activate(); err != nil {
+			return fmt.Errorf("unable to activate Webhook for %s list: %s", l.Name, err)
+		}
+	}
+	return nil
+}
+
 func HasWebhook(id string, ws trel.Webhooks) bool {
 	_, err := ws.Find(id)
 	if err != nil {
@@ -610,50 +1485,211 @@ func HasWebhook(id string, ws trel.Webhooks) bool {
 
 func DefaultWebhook(c *trel.Client, typ, id string) (trel.Webhook, error) {
 	cb := DefaultCallbackURL(typ, id)
-	return c.NewWebhook(fmt.Sprintf("%s: %s", typ, id), cb, id)
+	wh, err := c.NewWebhook(fmt.Sprintf("%s: %s", typ, id), cb, id)
+	if err == nil {
+		state.OwnWebhook(wh, typ)
+	}
+	return wh, err
 }
 
 func DefaultCallbackURL(typ, id string) string {
-	return MakeCallbackURL("https", host, typ, id)
+	return MakeCallbackURL("https", host, board.ID, typ, id)
 }
 
-func MakeCallbackURL(scheme, host, typ, id string) string {
+// MakeCallbackURL makes a webhook callback URL under the basePath, which says which board the object is on.
+// Callback URLs without a board, from before there could be several, are for the first board.
+func MakeCallbackURL(scheme, host, boardID, typ, id string) string {
 	u := url.URL{
 		Scheme: scheme,
 		Host:   host,
-		Path:   fmt.Sprintf("/%s/%s", typ, id),
+		Path:   fmt.Sprintf("%s/boards/%s/%s/%s", basePath, boardID, typ, id),
 	}
 	return u.String()
 }
 
+// CleanBasePath makes a base path start with a slash and not end with one, so "trello-watcher/" is "/trello-watcher",
+// and "/" is empty.
+func CleanBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// FindListCheckItem finds a checklist item by name on the cards of a list.
+// A name starting with the prefix of the card the item is on, like a task card's with -project-prefix, matches too.
+// In strict mode, finding more than one item with that name is an AmbiguousError.
 func FindListCheckItem(l trel.List, ciName string) (*trel.CheckItem, error) {
+	return findListCheckItem(l, ciName, nil)
+}
+
+// findListCheckItem is FindListCheckItem, passing over the items skip reports true for.
+func findListCheckItem(l trel.List, ciName string, skip func(checkItemID string) bool) (*trel.CheckItem, error) {
 	cards, err := l.Cards()
 	if err != nil {
 		return nil, err
 	}
 
+	var found *trel.CheckItem
+	count := 0
 	for _, c := range cards {
 		cls, err := c.Checklists()
 		if err != nil {
 			return nil, err
 		}
 		for _, cl := range cls {
-			if ci, err := cl.CheckItems.Find(ciName); err == nil {
-				return ci, nil
+			for i := range cl.CheckItems {
+				if cl.CheckItems[i].Name != TaskName(c.Name, ciName) || (skip != nil && skip(cl.CheckItems[i].ID)) {
+					continue
+				}
+				if found == nil {
+					found = &cl.CheckItems[i]
+				}
+				count++
 			}
 		}
+		// Lenient mode takes the first match.
+		if found != nil && !strict {
+			return found, nil
+		}
 	}
 
+	if count > 1 {
+		return nil, AmbiguousError{Type: "CheckItem", Identifier: ciName, Count: count}
+	}
+	if found != nil {
+		return found, nil
+	}
 	return nil, trel.NotFoundError{Type: "CheckItem", Identifier: ciName}
 }
 
-func webhooks(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "", 404)
-		return
+// FindCard finds a card by name.
+// In strict mode, finding more than one card with that name is an AmbiguousError.
+func FindCard(cards trel.Cards, name string) (*trel.Card, error) {
+	c, err := cards.Find(name)
+	if err != nil || !strict {
+		return c, err
+	}
+	count := 0
+	for _, card := range cards {
+		if card.Name == name {
+			count++
+		}
+	}
+	if count > 1 {
+		return nil, AmbiguousError{Type: "Card", Identifier: name, Count: count}
+	}
+	return c, nil
+}
+
+// AllCards fetches the cards on all of the given lists.
+func AllCards(lists ...trel.List) (trel.Cards, error) {
+	var all trel.Cards
+	for _, l := range lists {
+		cards, err := l.Cards()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, cards...)
+	}
+	return all, nil
+}
+
+// AppendCards joins card slices into a new slice, leaving the originals untouched.
+func AppendCards(cardSets ...trel.Cards) trel.Cards {
+	var all trel.Cards
+	for _, cards := range cardSets {
+		all = append(all, cards...)
+	}
+	return all
+}
+
+// FindListCard is FindCard for all the cards on a list.
+func FindListCard(l trel.List, name string) (*trel.Card, error) {
+	cards, err := l.Cards()
+	if err != nil {
+		return nil, err
+	}
+	return FindCard(cards, name)
+}
+
+// FindTaskCard finds the task card for a project's checklist item among cards.
+// The card linked to the item in the state is used if it is there,
+// otherwise the card is found by name, with or without the project's prefix, for cards from before links were kept.
+// Cards linked to other items are never found by name, since they are other tasks,
+// like another Active project's task with the same name.
+// In strict mode, finding more than one card by name is an AmbiguousError.
+func FindTaskCard(cards trel.Cards, checkItemID, project, name string) (*trel.Card, error) {
+	if id, ok := state.TaskCard(checkItemID); ok {
+		for i := range cards {
+			if cards[i].ID == id {
+				return &cards[i], nil
+			}
+		}
 	}
+	var found []int
+	for i, c := range cards {
+		if ciID, ok := state.TaskCheckItem(c.ID); ok && ciID != checkItemID {
+			continue
+		}
+		if TaskName(project, c.Name) == name {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		return &trel.Card{}, trel.NotFoundError{Type: "Card", Identifier: name}
+	}
+	if strict && len(found) > 1 {
+		return nil, AmbiguousError{Type: "Card", Identifier: name, Count: len(found)}
+	}
+	return &cards[found[0]], nil
+}
 
-	for _, wh := range board.Webhooks {
-		fmt.Fprintf(w, "%+v\n", wh)
+// FindListTaskCard is FindTaskCard for all the cards on a list.
+func FindListTaskCard(l trel.List, checkItemID, project, name string) (*trel.Card, error) {
+	cards, err := l.Cards()
+	if err != nil {
+		return nil, err
 	}
+	return FindTaskCard(cards, checkItemID, project, name)
+}
+
+// FindTaskCheckItem finds the checklist item a task card is for, on the cards of a list.
+// Like FindTaskCard, the linked item is used if there is one, otherwise the item is found by name,
+// passing over items linked to other cards, so each Active project's tasks are kept apart.
+func FindTaskCheckItem(l trel.List, card trel.Card) (*trel.CheckItem, error) {
+	if ciID, ok := state.TaskCheckItem(card.ID); ok {
+		cards, err := l.Cards()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cards {
+			cls, err := c.Checklists()
+			if err != nil {
+				return nil, err
+			}
+			for _, cl := range cls {
+				for i := range cl.CheckItems {
+					if cl.CheckItems[i].ID == ciID {
+						return &cl.CheckItems[i], nil
+					}
+				}
+			}
+		}
+	}
+	return findListCheckItem(l, card.Name, func(checkItemID string) bool {
+		id, ok := state.TaskCard(checkItemID)
+		return ok && id != card.ID
+	})
+}
+
+type AmbiguousError struct {
+	Type       string
+	Identifier string
+	Count      int
+}
+
+func (a AmbiguousError) Error() string {
+	return fmt.Sprintf("found %d of %s with identifier %q, expected only one", a.Count, a.Type, a.Identifier)
 }
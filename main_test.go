@@ -0,0 +1,138 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetupActiveProjectCard(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "review", "ship")
+	cl.CheckItems[1].State = "complete"
+	stored := fake.AddCard(fake.ListID(boardID, "Storage"), "write")
+	state.Link(cl.CheckItems[0].ID, stored.ID)
+
+	card, err := trelClient.Card(project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupActiveProjectCard(card); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write", "ship"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+	if got, want := fake.cardsOn(board.Done.ID), []string{"review"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+	if got := fake.cardsOn(board.Storage.ID); len(got) != 0 {
+		t.Errorf("Storage = %q, want it empty", got)
+	}
+	if !HasWebhook(project.ID, board.Webhooks) {
+		t.Errorf("no webhook was made for the project card")
+	}
+	if id, _ := state.TaskCard(cl.CheckItems[2].ID); id == "" {
+		t.Errorf("the card made for %q isn't linked to its checklist item", "ship")
+	}
+}
+
+func TestCheckItemChangeHandle(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	fake.AddCard(board.ToDo.ID, "write")
+
+	change := func(i int, st string) CheckItemChange {
+		var cic CheckItemChange
+		cic.Action.Type = "updateCheckItemStateOnCard"
+		cic.Action.Data.Card.ID = project.ID
+		cic.Action.Data.Card.Name = project.Name
+		cic.Action.Data.CheckItem.ID = cl.CheckItems[i].ID
+		cic.Action.Data.CheckItem.Name = cl.CheckItems[i].Name
+		cic.Action.Data.CheckItem.State = st
+		return cic
+	}
+
+	// Completing an item moves its card to Done.
+	if err := change(0, "complete").Handle(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.Done.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+
+	// Marking it incomplete again moves it back to To Do.
+	if err := change(0, "incomplete").Handle(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+
+	// An incomplete item without a card gets one.
+	if err := change(1, "incomplete").Handle(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write", "ship"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+
+	// Completing an item whose card can't be found is an error, rather than a change to another card.
+	fake.AddChecklist(project.ID, "More", "missing")
+	cls := fake.cardChecklists(project.ID)
+	missing := cls[len(cls)-1].CheckItems[0]
+	var cic CheckItemChange
+	cic.Action.Data.Card.ID = project.ID
+	cic.Action.Data.Card.Name = project.Name
+	cic.Action.Data.CheckItem.ID = missing.ID
+	cic.Action.Data.CheckItem.Name = missing.Name
+	cic.Action.Data.CheckItem.State = "complete"
+	if err := cic.Handle(); err == nil {
+		t.Errorf("completing %q with no card succeeded", missing.Name)
+	}
+}
+
+// TestHandler checks the server's routes are served under -base-path, with only the public ones open without -admin-token.
+func TestHandler(t *testing.T) {
+	oldToken, oldBase := adminToken, basePath
+	t.Cleanup(func() {
+		adminToken, basePath = oldToken, oldBase
+		pause.since, pause.reason = time.Time{}, ""
+	})
+	adminToken, basePath = "secret", "/watcher"
+	h := Handler()
+
+	tests := []struct {
+		method, path, token string
+		status              int
+		paused              bool
+	}{
+		{http.MethodGet, "/watcher/healthz", "", http.StatusOK, false},
+		{http.MethodPost, "/watcher/admin/pause", "", http.StatusUnauthorized, false},
+		{http.MethodPost, "/watcher/admin/pause", "wrong", http.StatusUnauthorized, false},
+		{http.MethodPost, "/watcher/admin/pause", "secret", http.StatusOK, true},
+		{http.MethodPost, "/watcher/admin/resume", "secret", http.StatusOK, false},
+		{http.MethodGet, "/healthz", "", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+		if Paused() != tt.paused {
+			t.Errorf("after %s %s, paused is %t, want %t", tt.method, tt.path, Paused(), tt.paused)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/ifo/trel"
+)
+
+// syncMembers copies a task card's member back to its checklist item when the card's members change,
+// and a checklist item's member to its task card when the item is assigned.
+var syncMembers bool
+
+// CheckItemMembers maps each checklist item name on a card to its assigned member, for the items that have one.
+func CheckItemMembers(cardID string) (map[string]string, error) {
+	cls, err := CardChecklistInfo(cardID)
+	if err != nil {
+		return nil, err
+	}
+	members := map[string]string{}
+	for _, cl := range cls {
+		for _, ci := range cl.CheckItems {
+			if ci.IDMember != "" {
+				members[ci.Name] = ci.IDMember
+			}
+		}
+	}
+	return members, nil
+}
+
+// CheckItemMember is the member assigned to one checklist item on a card, or "" if there isn't one.
+func CheckItemMember(cardID, checkItemID string) (string, error) {
+	cls, err := CardChecklistInfo(cardID)
+	if err != nil {
+		return "", err
+	}
+	for _, cl := range cls {
+		for _, ci := range cl.CheckItems {
+			if ci.ID == checkItemID {
+				return ci.IDMember, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// AddCardMember adds a member to a card. Trello notifies the member.
+func AddCardMember(cardID, memberID string) error {
+	return apiDo(http.MethodPost, "cards/"+cardID+"/idMembers", url.Values{"value": {memberID}}, nil)
+}
+
+// RemoveCardMember removes a member from a card.
+func RemoveCardMember(cardID, memberID string) error {
+	return apiDo(http.MethodDelete, "cards/"+cardID+"/idMembers/"+memberID, nil, nil)
+}
+
+// SetCheckItemMember assigns a checklist item to a member, or unassigns it if memberID is "".
+func SetCheckItemMember(cardID, checkItemID, memberID string) error {
+	return apiDo(http.MethodPut, "cards/"+cardID+"/checkItem/"+checkItemID, url.Values{"idMember": {memberID}}, nil)
+}
+
+// MemberChange is a member being added to or removed from a card on a watched list.
+type MemberChange struct {
+	Action struct {
+		ID   string `json:"id"`
+		Type string `json:"type"` // "addMemberToCard" or "removeMemberFromCard"
+		Data struct {
+			IDMember string `json:"idMember"`
+			Card     struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"card"`
+		} `json:"data"`
+	} `json:"action"`
+}
+
+// Handle keeps the task card's checklist item assigned to one of the card's members.
+// The item keeps its member if they are still on the card, and is unassigned if the card has none.
+func (mc MemberChange) Handle() error {
+	if !syncMembers {
+		return nil
+	}
+	task := trel.Card{ID: mc.Action.Data.Card.ID, Name: mc.Action.Data.Card.Name}
+	ci, err := FindTaskCheckItem(board.Active, task)
+	if err != nil {
+		return err
+	}
+
+	var card struct {
+		IDMembers []string `json:"idMembers"`
+	}
+	err = apiDo(http.MethodGet, "cards/"+mc.Action.Data.Card.ID, url.Values{"fields": {"idMembers"}}, &card)
+	if err != nil {
+		return err
+	}
+	current, err := CheckItemMember(ci.Checklist.IDCard, ci.ID)
+	if err != nil {
+		return err
+	}
+
+	member := ""
+	for _, id := range card.IDMembers {
+		if id == current {
+			return nil
+		}
+		if member == "" {
+			member = id
+		}
+	}
+	if member == current {
+		return nil
+	}
+	if err := SetCheckItemMember(ci.Checklist.IDCard, ci.ID, member); err != nil {
+		return err
+	}
+	timeline.Add(ci.Checklist.IDCard, TimelineEntry{Source: "watcher", Type: "assignCheckItem", Detail: ci.Name})
+	return nil
+}
+
+// HandleCheckItemMember gives an Active project's checklist item's task card the member the item was assigned to,
+// in place of the item's old member. The card's other members are left alone.
+func (cic CheckItemChange) HandleCheckItemMember() error {
+	if !syncMembers {
+		return nil
+	}
+	ciID, name := cic.Action.Data.CheckItem.ID, cic.Action.Data.CheckItem.Name
+	cards, err := AllCards(append(board.DoneLists(), board.ToDo)...)
+	if err != nil {
+		return err
+	}
+	task, err := FindTaskCard(cards, ciID, cic.Action.Data.Card.Name, name)
+	if _, ok := err.(trel.NotFoundError); ok {
+		// The item has no card, like a -checkitem-only one.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	state.Link(ciID, task.ID)
+
+	var card struct {
+		IDMembers []string `json:"idMembers"`
+	}
+	err = apiDo(http.MethodGet, "cards/"+task.ID, url.Values{"fields": {"idMembers"}}, &card)
+	if err != nil {
+		return err
+	}
+	onCard := map[string]bool{}
+	for _, id := range card.IDMembers {
+		onCard[id] = true
+	}
+
+	member := cic.Action.Data.CheckItem.IDMember
+	var old string
+	if err := json.Unmarshal(cic.Action.Data.Old.IDMember, &old); err != nil {
+		return err
+	}
+	if member != "" && !onCard[member] {
+		if err := AssignCard(*task, member); err != nil {
+			return err
+		}
+	}
+	if old != "" && old != member && onCard[old] {
+		if err := UnassignCard(task.ID, old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/ifo/trel"
+)
+
+// Migration is a task card found for a project's checklist item on a board from before the watcher kept links.
+type Migration struct {
+	Project   CardInfo
+	CheckItem CheckItemInfo
+	Card      CardInfo
+}
+
+// PlanMigration matches the Storage, To Do, and Done cards to the checklist items of the Projects and Active cards,
+// by name like FindTaskCard, for the items and cards that aren't linked yet.
+// A card that matches items of more than one project can't be told apart, so it is returned in ambiguous instead.
+func PlanMigration() (found []Migration, ambiguous map[string][]string, err error) {
+	var tasks []CardInfo
+	for _, l := range []trel.List{board.Storage, board.ToDo, board.Done} {
+		cards, err := ListCardInfo(l.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, cards...)
+	}
+	var unlinked trel.Cards
+	byID := map[string]CardInfo{}
+	for _, c := range tasks {
+		if _, ok := state.TaskCheckItem(c.ID); !ok {
+			unlinked = append(unlinked, trel.Card{ID: c.ID, Name: c.Name})
+			byID[c.ID] = c
+		}
+	}
+
+	matches := map[string][]Migration{}
+	var order []string
+	for _, l := range []trel.List{board.Active, board.Projects} {
+		projects, err := ListCardInfo(l.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range projects {
+			cls, err := CardChecklistInfo(p.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, cl := range cls {
+				for _, ci := range cl.CheckItems {
+					if _, ok := state.TaskCard(ci.ID); ok {
+						continue
+					}
+					c, err := FindTaskCard(unlinked, ci.ID, p.Name, ci.Name)
+					if err != nil {
+						continue
+					}
+					if len(matches[c.ID]) == 0 {
+						order = append(order, c.ID)
+					}
+					matches[c.ID] = append(matches[c.ID], Migration{Project: p, CheckItem: ci, Card: byID[c.ID]})
+				}
+			}
+		}
+	}
+
+	ambiguous = map[string][]string{}
+	for _, id := range order {
+		ms := matches[id]
+		if len(ms) == 1 {
+			found = append(found, ms[0])
+			continue
+		}
+		for _, m := range ms {
+			ambiguous[m.Card.Name] = append(ambiguous[m.Card.Name], ProjectName(m.Project.Name))
+		}
+	}
+	return found, ambiguous, nil
+}
+
+// MigrateCommand links the task cards on a board from before the watcher kept links to their checklist items,
+// and with -project-labels, gives each its project's label, so the multi-project features can tell projects apart.
+func MigrateCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	list := fs.Bool("list", false, "only list the task cards that would be linked")
+	fs.Parse(args)
+
+	found, ambiguous, err := PlanMigration()
+	if err != nil {
+		return err
+	}
+	for _, m := range found {
+		fmt.Printf("%s -> %s\n", m.Card.Name, ProjectName(m.Project.Name))
+	}
+	var names []string
+	for name := range ambiguous {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s matches tasks in %q, link it by hand\n", name, ambiguous[name])
+	}
+	if *list {
+		fmt.Printf("%d task cards would be linked\n", len(found))
+		return nil
+	}
+
+	for _, m := range found {
+		state.Link(m.CheckItem.ID, m.Card.ID)
+		if !projectLabels {
+			continue
+		}
+		labelID, err := ProjectLabel(m.Project.ID)
+		if err != nil {
+			return err
+		}
+		if !hasLabel(m.Card.IDLabels, labelID) {
+			if err := AddCardLabel(m.Card.ID, labelID); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("%d task cards linked\n", len(found))
+	usage.Record("migrate")
+	return nil
+}
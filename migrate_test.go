@@ -0,0 +1,58 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"testing"
+)
+
+// TestMigrateCommand checks that task cards are linked to the one project item they match,
+// and given its label, and that cards matching items in more than one project are left alone.
+func TestMigrateCommand(t *testing.T) {
+	fake, boardID := watchFake(t)
+	oldLabels, oldTaskLabels := projectLabels, taskLabels
+	t.Cleanup(func() { projectLabels, taskLabels = oldLabels, oldTaskLabels })
+	projectLabels, taskLabels = true, map[string]string{}
+
+	launch := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	launchItems := fake.AddChecklist(launch.ID, "Tasks", "write", "ship").CheckItems
+	docs := fake.AddCard(fake.ListID(boardID, "Projects"), "Docs")
+	docsItems := fake.AddChecklist(docs.ID, "Tasks", "review", "write").CheckItems
+	review := fake.AddCard(board.Storage.ID, "review")
+	ship := fake.AddCard(board.ToDo.ID, "ship")
+	write := fake.AddCard(board.ToDo.ID, "write")
+	old := fake.AddCard(board.Done.ID, "old")
+
+	if err := MigrateCommand(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	label := func(name string) string {
+		for _, l := range fake.Labels {
+			if l.Name == name {
+				return l.ID
+			}
+		}
+		return ""
+	}
+	tests := []struct {
+		card      *FakeCard
+		checkItem string
+		label     string
+	}{
+		{review, docsItems[0].ID, label("Docs")},
+		{ship, launchItems[1].ID, label("Launch")},
+		{write, "", ""},
+		{old, "", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := state.TaskCheckItem(tt.card.ID); got != tt.checkItem {
+			t.Errorf("%q is linked to %q, want %q", tt.card.Name, got, tt.checkItem)
+		}
+		if tt.label == "" && len(tt.card.IDLabels) != 0 {
+			t.Errorf("%q was labeled %q", tt.card.Name, tt.card.IDLabels)
+		} else if tt.label != "" && !hasLabel(tt.card.IDLabels, tt.label) {
+			t.Errorf("%q doesn't have its project's label", tt.card.Name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// nearMissScore is the lowest similarity that counts as a near miss.
+const nearMissScore = 0.75
+
+// nearMissReportsSize is how many reports are kept for the API.
+const nearMissReportsSize = 50
+
+var nearMissReports struct {
+	sync.Mutex
+	reports []NearMissReport
+}
+
+type NearMiss struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// NearMissReport lists the cards that almost matched a name that wasn't found.
+type NearMissReport struct {
+	Time       time.Time  `json:"time"`
+	Name       string     `json:"name"`
+	Candidates []NearMiss `json:"candidates"`
+}
+
+// NearMisses finds the best few cards whose names are similar to, but not the same as, name.
+func NearMisses(name string, cards trel.Cards) []NearMiss {
+	var misses []NearMiss
+	for _, c := range cards {
+		if c.Name == name {
+			continue
+		}
+		if score := Similarity(name, c.Name); score >= nearMissScore {
+			misses = append(misses, NearMiss{Name: c.Name, Score: score})
+		}
+	}
+	sort.SliceStable(misses, func(i, j int) bool { return misses[i].Score > misses[j].Score })
+	if len(misses) > 3 {
+		misses = misses[:3]
+	}
+	return misses
+}
+
+// ReportNearMisses logs and keeps any near misses for a name that is about to get a new card.
+func ReportNearMisses(name string, cards trel.Cards) {
+	misses := NearMisses(name, cards)
+	if len(misses) == 0 {
+		return
+	}
+	usage.Record("near-miss-report")
+	for _, m := range misses {
+		logger.Printf("No card named %q, but %q is a near miss (%.2f)\n", name, m.Name, m.Score)
+	}
+
+	nearMissReports.Lock()
+	defer nearMissReports.Unlock()
+	nearMissReports.reports = append(nearMissReports.reports, NearMissReport{Time: time.Now(), Name: name, Candidates: misses})
+	if len(nearMissReports.reports) > nearMissReportsSize {
+		nearMissReports.reports = nearMissReports.reports[1:]
+	}
+}
+
+// Similarity scores two names from 0 to 1, where 1 means the same once case and surrounding space are ignored.
+func Similarity(a, b string) float64 {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// nearMissesAPI serves the recent near miss reports.
+func nearMissesAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nearMissReports.Lock()
+	reports := append([]NearMissReport(nil), nearMissReports.reports...)
+	nearMissReports.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build noreplay
+
+package main
+
+import "errors"
+
+// errNoReplay is what the replay command fails with in a build without the fake it runs against.
+var errNoReplay = errors.New("replay isn't in this build, it was built with -tags noreplay")
+
+// SetupReplay fails, since the fake replay runs against was left out of the build.
+func SetupReplay(args []string) (string, error) {
+	return "", errNoReplay
+}
+
+// ReplayCommand fails, since the fake replay runs against was left out of the build.
+func ReplayCommand(args []string) error {
+	return errNoReplay
+}
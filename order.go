@@ -0,0 +1,59 @@
+package main
+
+import "sync"
+
+// tasks orders the events for each task, see TaskQueue.
+var tasks = &TaskQueue{tails: map[string]chan struct{}{}}
+
+// TaskQueue hands events for the same task over one at a time, in the order they arrived.
+// A task card being moved and its checklist item being checked at nearly the same time
+// would otherwise race for the board lock, and whichever won would be handled first.
+type TaskQueue struct {
+	mu    sync.Mutex
+	tails map[string]chan struct{} // Closed when the latest event for the task is done.
+}
+
+// Wait blocks until every earlier event for the task is done, and returns the func to call when this one is.
+// Events without a task don't wait.
+func (q *TaskQueue) Wait(task string) func() {
+	if task == "" {
+		return func() {}
+	}
+	q.mu.Lock()
+	prev := q.tails[task]
+	done := make(chan struct{})
+	q.tails[task] = done
+	q.mu.Unlock()
+
+	if prev != nil {
+		<-prev
+	}
+	return func() {
+		q.mu.Lock()
+		if q.tails[task] == done {
+			delete(q.tails, task)
+		}
+		q.mu.Unlock()
+		close(done)
+	}
+}
+
+// TaskKey names the task a card or checklist item is for.
+// Linked task cards and checklist items share the card's ID, and the rest share their name,
+// so both sides of a task get the same key either way.
+func TaskKey(cardID, checkItemID, name string) string {
+	if cardID != "" {
+		if _, ok := state.TaskCheckItem(cardID); ok {
+			return cardID
+		}
+	}
+	if checkItemID != "" {
+		if id, ok := state.TaskCard(checkItemID); ok {
+			return id
+		}
+	}
+	if name == "" {
+		return ""
+	}
+	return "name:" + name
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// ownWriteSlack is how far apart a write and the action Trello records for it can be, allowing for clock skew.
+const ownWriteSlack = time.Minute
+
+// ownWriteAge is how long a write is kept waiting for its action to be read.
+// A write whose action never shows up, like a move to the list the card was already on, is dropped after it.
+const ownWriteAge = 24 * time.Hour
+
+// ownWritesTransport records each change the watcher makes to a card or checklist, by the action Trello records for it,
+// so polling and catching up can tell the watcher's own actions from those of people using the same token.
+type ownWritesTransport struct {
+	next http.RoundTripper
+}
+
+func (t ownWritesTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	if err != nil || resp.StatusCode >= 300 || r.Method == http.MethodGet || !strings.HasPrefix(r.URL.String(), trel.API_PREFIX) {
+		return resp, err
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/1/"), "/")
+	if path == "cards" && r.Method == http.MethodPost {
+		// A new card's ID is only known from the response, which is put back for the caller to read.
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var c struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(body, &c) == nil && c.ID != "" {
+			state.Wrote(c.ID, "createCard", time.Now())
+		}
+		return resp, nil
+	}
+
+	for _, w := range ownWriteActions(r.Method, strings.Split(path, "/"), r.URL.Query().Get("state")) {
+		state.Wrote(w[0], w[1], time.Now())
+	}
+	return resp, nil
+}
+
+// ownWriteActions are the card or checklist ID, and the type, of each action Trello records for a request.
+// Requests that make no action polling reads, like comments and webhooks, have none.
+func ownWriteActions(method string, parts []string, checkItemState string) [][2]string {
+	if len(parts) < 2 || (parts[0] != "cards" && parts[0] != "checklists") {
+		return nil
+	}
+	id := parts[1]
+	switch {
+	case parts[0] == "cards" && len(parts) == 2 && method == http.MethodPut:
+		return [][2]string{{id, "updateCard"}}
+	case parts[0] == "cards" && len(parts) == 2 && method == http.MethodDelete:
+		return [][2]string{{id, "deleteCard"}}
+	case parts[0] == "cards" && len(parts) == 4 && parts[2] == "checkItem" && method == http.MethodPut:
+		if checkItemState != "" {
+			return [][2]string{{id, "updateCheckItemStateOnCard"}}
+		}
+		return [][2]string{{id, "updateCheckItem"}}
+	case parts[0] == "cards" && len(parts) == 4 && parts[2] == "checkItem" && method == http.MethodDelete:
+		return [][2]string{{id, "deleteCheckItem"}}
+	case parts[0] == "cards" && len(parts) == 3 && parts[2] == "idMembers" && method == http.MethodPost:
+		return [][2]string{{id, "addMemberToCard"}}
+	case parts[0] == "cards" && len(parts) == 4 && parts[2] == "idMembers" && method == http.MethodDelete:
+		return [][2]string{{id, "removeMemberFromCard"}}
+	case parts[0] == "cards" && len(parts) == 3 && parts[2] == "idLabels" && method == http.MethodPost:
+		return [][2]string{{id, "addLabelToCard"}}
+	case parts[0] == "cards" && len(parts) == 4 && parts[2] == "idLabels" && method == http.MethodDelete:
+		return [][2]string{{id, "removeLabelFromCard"}}
+	case parts[0] == "cards" && len(parts) == 3 && parts[2] == "checklists" && method == http.MethodPost:
+		return [][2]string{{id, "addChecklistToCard"}}
+	case parts[0] == "cards" && len(parts) == 3 && parts[2] == "attachments" && method == http.MethodPost:
+		return [][2]string{{id, "addAttachmentToCard"}}
+	case parts[0] == "checklists" && len(parts) == 3 && parts[2] == "checkItems" && method == http.MethodPost:
+		return [][2]string{{id, "createCheckItem"}}
+	case parts[0] == "checklists" && len(parts) == 4 && parts[2] == "checkItems" && method == http.MethodDelete:
+		return [][2]string{{id, "deleteCheckItem"}}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var pending = &PendingPlans{plans: map[string]*PendingPlan{}}
+
+// PendingPlan is a Plan that was over the guardrail, waiting to be approved or discarded.
+type PendingPlan struct {
+	ID      string    `json:"id"`
+	Board   string    `json:"board"`
+	Created time.Time `json:"created"`
+	Plan    Plan      `json:"plan"`
+}
+
+type PendingPlans struct {
+	mu    sync.Mutex
+	next  int
+	plans map[string]*PendingPlan
+}
+
+// Hold keeps a plan until it is approved or discarded, and returns its ID.
+func (pp *PendingPlans) Hold(p Plan) string {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.next++
+	id := strconv.Itoa(pp.next)
+	pp.plans[id] = &PendingPlan{ID: id, Board: board.ID, Created: time.Now(), Plan: p}
+	return id
+}
+
+// Take removes and returns a pending plan.
+func (pp *PendingPlans) Take(id string) (*PendingPlan, bool) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	p, ok := pp.plans[id]
+	delete(pp.plans, id)
+	return p, ok
+}
+
+func (pp *PendingPlans) List() []*PendingPlan {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	var out []*PendingPlan
+	for _, p := range pp.plans {
+		out = append(out, p)
+	}
+	return out
+}
+
+// pendingAPI serves the pending plans.
+// GET /api/pending lists them,
+// POST /api/pending/{id}/approve applies one,
+// and DELETE /api/pending/{id} discards one.
+func pendingAPI(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/pending"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(pending.List()); err != nil {
+			logger.Println(err)
+		}
+
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "approve":
+		p, ok := pending.Take(parts[0])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Printf("Applying approved plan %s: %s\n", p.ID, p.Plan.Operation)
+		err := WithBoard(p.Board, func() error { return ApplyPlan(p.Plan) })
+		if err != nil {
+			logger.Println(err)
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete && len(parts) == 1 && parts[0] != "":
+		if _, ok := pending.Take(parts[0]); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// maxMutations caps how many changes a single plan may make, 0 for no cap.
+var maxMutations int
+
+// A Change is a single board mutation the watcher intends to make.
+type Change struct {
+	Op   string `json:"op"` // "move" or "create"
+	Card string `json:"card"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	// Member is who a created card is assigned to, from its checklist item.
+	Member string `json:"member,omitempty"`
+
+	// id is the card or checklist item the change is about, or for a new card, the item it is for, if known.
+	id    string
+	apply func() error
+}
+
+// Key is the change's idempotency key, made from the Trello action that caused it and what it does.
+// It goes by the ID of the card or checklist item when there is one, since names aren't unique,
+// like two items with the same name in one project, and by name otherwise.
+// Changes without an action, like scheduled ones, have no key.
+func (c Change) Key(actionID string) string {
+	if actionID == "" {
+		return ""
+	}
+	what := c.Card
+	if c.id != "" {
+		what = c.id
+	}
+	return actionID + "/" + c.Op + "/" + what + "/" + c.To
+}
+
+// A Plan is every Change an operation, like activating a project, needs.
+// Planning first means the changes can be checked before any of them are made.
+type Plan struct {
+	Operation string   `json:"operation"`
+	Changes   []Change `json:"changes"`
+	// ActionID is the Trello action the plan responds to, if any.
+	ActionID string `json:"actionID,omitempty"`
+	// Feature is recorded in the usage ledger when the plan is applied.
+	Feature string `json:"-"`
+}
+
+func (p *Plan) Move(c *trel.Card, from, to trel.List) {
+	p.Changes = append(p.Changes, Change{
+		Op: "move", Card: c.Name, From: from.Name, To: to.Name, id: c.ID,
+		apply: func() error { return MoveCard(c, to) },
+	})
+}
+
+// MoveToBottom is Move to the bottom of the list, so cards moved one after another stay in that order.
+func (p *Plan) MoveToBottom(c *trel.Card, from, to trel.List) {
+	p.Changes = append(p.Changes, Change{
+		Op: "move", Card: c.Name, From: from.Name, To: to.Name, id: c.ID,
+		apply: func() error { return MoveCardToBottom(c, to) },
+	})
+}
+
+func (p *Plan) Create(name string, to trel.List) {
+	p.CreateFor(name, to, "", "", "")
+}
+
+// CreateFor is Create for a checklist item's task card, which is assigned to a member if memberID isn't "",
+// described by -task-template, given the label of the project card with projectID with -project-labels,
+// its labels with -sync-labels, and its item's due date with -sync-due.
+func (p *Plan) CreateFor(name string, to trel.List, memberID, checkItemID, projectID string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "create", Card: name, To: to.Name, Member: memberID, id: checkItemID,
+		apply: func() error {
+			desc, err := TaskDescription(projectID, checkItemID)
+			if err != nil {
+				return err
+			}
+			c, err := NewCard(to, name, desc)
+			if err != nil {
+				return err
+			}
+			state.Link(checkItemID, c.ID)
+			if err := LabelTaskCard(c.ID, projectID); err != nil {
+				return err
+			}
+			if err := CopyDueToCard(c.ID, projectID, checkItemID); err != nil {
+				return err
+			}
+			if err := CopyProjectLabels(c.ID, projectID); err != nil {
+				return err
+			}
+			if memberID == "" {
+				return nil
+			}
+			return AssignCard(c, memberID)
+		},
+	})
+}
+
+func (p *Plan) AddCheckItem(project *trel.Card, name string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "addCheckItem", Card: name, To: project.Name,
+		apply: func() error { return AddCheckItem(project, name) },
+	})
+}
+
+func (p *Plan) RenameCard(c *trel.Card, name string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "renameCard", Card: c.Name, From: c.Name, To: name, id: c.ID,
+		apply: func() error { return RenameCard(c, name) },
+	})
+}
+
+func (p *Plan) RenameCheckItem(ci *trel.CheckItem, name string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "renameCheckItem", Card: ci.Name, From: ci.Name, To: name, id: ci.ID,
+		apply: func() error { return RenameTaskCheckItem(ci, name) },
+	})
+}
+
+func (p *Plan) RemoveCard(c *trel.Card, from trel.List) {
+	p.Changes = append(p.Changes, Change{
+		Op: "deleteCard", Card: c.Name, From: from.Name, id: c.ID,
+		apply: func() error { return RemoveCard(c) },
+	})
+}
+
+func (p *Plan) Comment(c *trel.Card, text string) {
+	p.Changes = append(p.Changes, Change{
+		Op: "comment", Card: c.Name, To: text, id: c.ID,
+		apply: func() error { return Comment(c.ID, text) },
+	})
+}
+
+func (p *Plan) Archive(c *trel.Card, from trel.List) {
+	p.Changes = append(p.Changes, Change{
+		Op: "archiveCard", Card: c.Name, From: from.Name, id: c.ID,
+		apply: func() error { return ArchiveCard(c) },
+	})
+}
+
+func (p *Plan) RemoveCheckItem(ci *trel.CheckItem) {
+	p.Changes = append(p.Changes, Change{
+		Op: "removeCheckItem", Card: ci.Name, From: ci.Checklist.Name, id: ci.ID,
+		apply: func() error { return RemoveCheckItem(ci) },
+	})
+}
+
+func (p *Plan) Complete(ci *trel.CheckItem) {
+	p.Changes = append(p.Changes, Change{
+		Op: "completeCheckItem", Card: ci.Name, id: ci.ID,
+		apply: func() error { return CompleteCheckItem(ci) },
+	})
+}
+
+func (p *Plan) Incomplete(ci *trel.CheckItem) {
+	p.Changes = append(p.Changes, Change{
+		Op: "incompleteCheckItem", Card: ci.Name, id: ci.ID,
+		apply: func() error { return IncompleteCheckItem(ci) },
+	})
+}
+
+// Apply makes every change, stopping at the first failure.
+// Changes already made for the same action are skipped, so a retried or replayed webhook is safe.
+// The changes made are marked applied together once the plan stops, rather than saving the keys for each one.
+func (p Plan) Apply() error {
+	var made []string
+	seen := map[string]bool{}
+	defer func() {
+		if len(made) > 0 {
+			applied.Mark(made...)
+		}
+	}()
+	for _, c := range p.Changes {
+		key := c.Key(p.ActionID)
+		if key != "" && (applied.Done(key) || seen[key]) {
+			logger.Printf("Skipping %s, it was already applied\n", key)
+			continue
+		}
+		if err := c.apply(); err != nil {
+			return err
+		}
+		if key != "" {
+			made = append(made, key)
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// doneArchiveInterval is how often Done is rolled into the Done archive.
+var doneArchiveInterval time.Duration
+
+// PlanDoneArchive moves every Done card into the Done archive.
+func PlanDoneArchive() (Plan, error) {
+	plan := Plan{Operation: "archiving Done", Feature: "done-archive"}
+	cards, err := board.Done.Cards()
+	if err != nil {
+		return plan, err
+	}
+	for i := range cards {
+		plan.Move(&cards[i], board.Done, board.DoneArchive)
+	}
+	return plan, nil
+}
+
+// RunDoneArchive rolls Done into the Done archive on every board every doneArchiveInterval.
+func RunDoneArchive() {
+	for range Schedule(doneArchiveInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(ArchiveDone)
+	}
+}
+
+// ArchiveDone rolls the board's Done into its Done archive.
+func ArchiveDone() error {
+	plan, err := PlanDoneArchive()
+	if err != nil {
+		return fmt.Errorf("unable to archive Done: %s", err)
+	}
+	if Shadow(plan) {
+		return nil
+	}
+	if err := CheckGuardrail(plan); err != nil {
+		logger.Println(err)
+		return nil
+	}
+	if err := ApplyPlan(plan); err != nil {
+		return fmt.Errorf("unable to archive Done: %s", err)
+	}
+	logger.Printf("Moved %d cards from Done to %s\n", len(plan.Changes), board.DoneArchive.Name)
+	return nil
+}
+
+// RunPlan applies a plan, unless it is over the guardrail and has to wait for approval.
+func RunPlan(p Plan) error {
+	if len(p.Changes) == 0 || Shadow(p) {
+		return nil
+	}
+	if err := CheckGuardrail(p); err != nil {
+		// The plan waits for approval instead.
+		logger.Println(err)
+		return nil
+	}
+	return ApplyPlan(p)
+}
+
+// ApplyPlan applies a plan with the Done webhook deactivated,
+// since moving a bunch of cards in and out of Done would otherwise send a webhook for each one.
+// A single change isn't worth the extra requests.
+func ApplyPlan(p Plan) error {
+	if p.Feature != "" {
+		usage.Record(p.Feature)
+	}
+	if len(p.Changes) <= 1 {
+		return p.Apply()
+	}
+
+	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
+		wh.Deactivate()
+	}
+
+	err := p.Apply()
+
+	// Reactivate the Done webhook.
+	if wh, err := board.Webhooks.Find(board.Done.ID); err == nil {
+		wh.Activate()
+	}
+	return err
+}
+
+// CheckGuardrail holds plans that make more changes than maxMutations until they are approved,
+// so a bad computation can't bulk move the whole board.
+func CheckGuardrail(p Plan) error {
+	if maxMutations <= 0 || len(p.Changes) <= maxMutations {
+		return nil
+	}
+	id := pending.Hold(p)
+	usage.Record("guardrail-hold")
+	logger.Printf("ALERT: %s wants to make %d changes, more than the limit of %d. Nothing was changed, approve it at /api/pending/%s/approve\n", p.Operation, len(p.Changes), maxMutations, id)
+	return GuardrailError{Operation: p.Operation, Changes: len(p.Changes), Max: maxMutations, PendingID: id}
+}
+
+type GuardrailError struct {
+	Operation string
+	Changes   int
+	Max       int
+	PendingID string
+}
+
+func (g GuardrailError) Error() string {
+	return fmt.Sprintf("%s needs %d changes, over the limit of %d, and is pending approval as %s", g.Operation, g.Changes, g.Max, g.PendingID)
+}
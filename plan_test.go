@@ -0,0 +1,132 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ifo/trel"
+)
+
+// TestPlans checks the changes planned for activating, storing, completing, renaming, and removing,
+// on a board with an Active "Launch" project whose tasks are "write" and "ship".
+func TestPlans(t *testing.T) {
+	t.Cleanup(func() { onCheckItemRemoved = "" })
+	tests := []struct {
+		name string
+		// plan sets up the board from the fake and project, and plans the change.
+		plan func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error)
+		want []string
+	}{
+		{"activate", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.Storage.ID, "write")
+			card, err := trelClient.Card(project.ID)
+			if err != nil {
+				return Plan{}, err
+			}
+			return PlanActivation(card)
+		}, []string{"move write Storage To Do", "create ship  To Do"}},
+
+		{"store", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.ToDo.ID, "write")
+			f.AddCard(board.Done.ID, "ship")
+			card, err := trelClient.Card(project.ID)
+			if err != nil {
+				return Plan{}, err
+			}
+			return PlanStorage(card)
+		}, []string{"move write To Do Storage", "move ship Done Storage"}},
+
+		{"complete", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.ToDo.ID, "write")
+			cic := checkItemChange(project, items[0])
+			cic.Action.Data.CheckItem.State = "complete"
+			return cic.Plan()
+		}, []string{"move write To Do Done"}},
+
+		{"reopen", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.Done.ID, "write")
+			cic := checkItemChange(project, items[0])
+			cic.Action.Data.CheckItem.State = "incomplete"
+			return cic.Plan()
+		}, []string{"move write Done To Do"}},
+
+		{"rename", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.ToDo.ID, "write")
+			cic := checkItemChange(project, items[0])
+			cic.Action.Type = "updateCheckItem"
+			cic.Action.Data.CheckItem.Name = "draft"
+			cic.Action.Data.Old.Name = "write"
+			return cic.PlanRename()
+		}, []string{"renameCard write write draft"}},
+
+		{"remove", func(f *FakeTrello, project *FakeCard, items []*FakeCheckItem) (Plan, error) {
+			f.AddCard(board.ToDo.ID, "write")
+			onCheckItemRemoved = "delete"
+			cic := checkItemChange(project, items[0])
+			cic.Action.Type = "deleteCheckItem"
+			return cic.PlanCheckItemsRemoved()
+		}, []string{"deleteCard write To Do "}},
+	}
+	for _, tt := range tests {
+		fake, boardID := watchFake(t)
+		project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+		cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+		onCheckItemRemoved = ""
+
+		plan, err := tt.plan(fake, project, cl.CheckItems)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		var got []string
+		for _, c := range plan.Changes {
+			got = append(got, c.Op+" "+c.Card+" "+c.From+" "+c.To)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s planned %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// checkItemChange is a change to a project's checklist item, like Trello sends.
+func checkItemChange(project *FakeCard, ci *FakeCheckItem) CheckItemChange {
+	var cic CheckItemChange
+	cic.Action.ID = "a1"
+	cic.Action.Type = "updateCheckItemStateOnCard"
+	cic.Action.Data.Card.ID = project.ID
+	cic.Action.Data.Card.Name = project.Name
+	cic.Action.Data.CheckItem.ID = ci.ID
+	cic.Action.Data.CheckItem.Name = ci.Name
+	cic.Action.Data.CheckItem.State = ci.State
+	return cic
+}
+
+// TestChangeKey checks that changes are keyed by their action and the ID of what they are about, or its name without one.
+func TestChangeKey(t *testing.T) {
+	var p Plan
+	card := &trel.Card{ID: "c1", Name: "write"}
+	p.Move(card, trel.List{Name: "To Do"}, trel.List{Name: "Done"})
+	p.CreateFor("ship", trel.List{Name: "To Do"}, "", "ci1", "p1")
+	p.CreateFor("ship", trel.List{Name: "To Do"}, "", "ci2", "p1")
+	p.Create("review", trel.List{Name: "To Do"})
+	p.RenameCheckItem(&trel.CheckItem{ID: "ci3", Name: "draft"}, "edit")
+
+	tests := []struct {
+		change   Change
+		actionID string
+		want     string
+	}{
+		{p.Changes[0], "a1", "a1/move/c1/Done"},
+		{p.Changes[1], "a1", "a1/create/ci1/To Do"},
+		{p.Changes[2], "a1", "a1/create/ci2/To Do"},
+		{p.Changes[3], "a1", "a1/create/review/To Do"},
+		{p.Changes[4], "a1", "a1/renameCheckItem/ci3/edit"},
+		{p.Changes[0], "", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.change.Key(tt.actionID); got != tt.want {
+			t.Errorf("%s %s keyed %q for %q, want %q", tt.change.Op, tt.change.Card, got, tt.actionID, tt.want)
+		}
+	}
+}
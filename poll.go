@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pollInterval is how often board actions are read from Trello instead of waiting for webhooks, 0 to use webhooks.
+var pollInterval time.Duration
+
+// polling reports whether the watcher reads board actions instead of having webhooks,
+// in which case it makes no webhooks at all.
+func polling() bool {
+	return pollInterval > 0
+}
+
+// pollLimit is the most actions Trello returns at once.
+const pollLimit = 1000
+
+// pollListActions are the actions a list webhook would be sent.
+var pollListActions = []string{
+	"updateCard", "createCard", "copyCard", "moveCardToBoard",
+	"addMemberToCard", "removeMemberFromCard", "deleteCard", "updateList",
+}
+
+// pollCardActions are the actions an Active project card's webhook would be sent.
+var pollCardActions = []string{
+	"updateCheckItemStateOnCard", "updateCheckItem", "addAttachmentToCard",
+	"createCheckItem", "addChecklistToCard", "deleteCheckItem", "removeChecklistFromCard",
+	"addLabelToCard", "removeLabelFromCard",
+}
+
+// polledAction is the part of a Trello action needed to route it like a webhook would.
+type polledAction struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Date time.Time `json:"date"`
+	Data struct {
+		Card struct {
+			ID string `json:"id"`
+		} `json:"card"`
+		Checklist struct {
+			ID string `json:"id"`
+		} `json:"checklist"`
+		List struct {
+			ID string `json:"id"`
+		} `json:"list"`
+		ListBefore struct {
+			ID string `json:"id"`
+		} `json:"listBefore"`
+		ListAfter struct {
+			ID string `json:"id"`
+		} `json:"listAfter"`
+	} `json:"data"`
+}
+
+// RunPoller reads every board's new actions every pollInterval,
+// and handles each of them as if a webhook had sent it.
+func RunPoller() {
+	// Polling picks up from the last action seen, so actions missed while the watcher was down are handled too.
+	// Boards never seen start from now.
+	since := map[string]string{}
+	start := time.Now().UTC().Format(time.RFC3339)
+	for _, b := range boards {
+		since[b.ID] = state.LastAction(b.ID)
+		if since[b.ID] == "" {
+			since[b.ID] = start
+		}
+	}
+
+	for range time.Tick(pollInterval) {
+		for _, b := range boards {
+			// The board's actions are caught up on once access is back, since the last one seen stays put.
+			if _, lost := AccessLost(b.ID); lost {
+				continue
+			}
+			last, err := PollBoard(b, since[b.ID])
+			if err != nil {
+				logger.Printf("Unable to poll board %s: %s\n", b.Name, err)
+				if cerr := CheckAccess(b.ID); cerr != nil {
+					logger.Printf("Unable to check access to %s: %s\n", b.Name, cerr)
+				}
+			}
+			if last != "" {
+				since[b.ID] = last
+			}
+		}
+	}
+}
+
+// WatcherMemberID is the ID of the member the token belongs to.
+func WatcherMemberID() (string, error) {
+	var me struct {
+		ID string `json:"id"`
+	}
+	err := apiDo(http.MethodGet, "members/me", url.Values{"fields": {"id"}}, &me)
+	return me.ID, err
+}
+
+// CatchUp handles the actions on each board since the last one seen, which were missed while the watcher was down.
+// Like polling, it only skips the watcher's own writes, so changes made with its token, like the board owner's, are replayed.
+// Boards never seen before have nothing to catch up on.
+func CatchUp() {
+	for _, b := range boards {
+		since := state.LastAction(b.ID)
+		if since == "" {
+			continue
+		}
+		if _, err := PollBoard(b, since); err != nil {
+			logger.Printf("Unable to catch up on missed actions on %s: %s\n", b.Name, err)
+		}
+	}
+}
+
+// PollBoard handles a board's actions since an action ID or time, skipping the watcher's own,
+// and returns the ID of the last action handled.
+// It stops at the first action that fails, returning the one before it, so that one is polled again.
+// The watcher's own actions are told apart by the writes it recorded, rather than by member,
+// since the token is usually that of someone who uses the board too.
+func PollBoard(b *Board, since string) (string, error) {
+	var raw []json.RawMessage
+	params := url.Values{
+		"since":  {since},
+		"limit":  {strconv.Itoa(pollLimit)},
+		"filter": {strings.Join(pollListActions, ",") + "," + strings.Join(pollCardActions, ",")},
+	}
+	for {
+		var page []json.RawMessage
+		if err := apiDo(http.MethodGet, "boards/"+b.ID+"/actions", params, &page); err != nil {
+			return "", err
+		}
+		raw = append(raw, page...)
+		if len(page) < pollLimit {
+			break
+		}
+		// Trello lists the newest action first, so the rest are before the last one in the page.
+		var oldest polledAction
+		if err := json.Unmarshal(page[len(page)-1], &oldest); err != nil {
+			return "", err
+		}
+		params.Set("before", oldest.ID)
+	}
+
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	// The board is read under its lock, but the actions are handled outside it, since handling takes the lock too.
+	watched := map[string]bool{}
+	active := map[string]bool{}
+	err := WithBoard(b.ID, func() error {
+		for _, l := range board.WatchedLists {
+			watched[l.ID] = true
+		}
+		cards, err := board.Active.Cards()
+		if err != nil {
+			return err
+		}
+		for _, c := range cards {
+			active[c.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Trello lists the newest action first.
+	var last string
+	for i := len(raw) - 1; i >= 0; i-- {
+		var a polledAction
+		if err := json.Unmarshal(raw[i], &a); err != nil {
+			return last, err
+		}
+		// The watcher doesn't react to its own changes.
+		own := state.OwnAction(a.Type, a.Date, a.Data.Card.ID, a.Data.Checklist.ID)
+		if objType, objID := pollRoute(a, watched, active); objType != "" && !own {
+			body, err := json.Marshal(struct {
+				Action json.RawMessage `json:"action"`
+			}{raw[i]})
+			if err != nil {
+				return last, err
+			}
+			understood, err := DispatchPayload(b.ID, objType, objID, body)
+			RecordPayload(b.ID, objType, objID, body, understood, err)
+			if err != nil {
+				// Polling stops short of a failed action, so the next poll tries it again.
+				return last, fmt.Errorf("polled %s %s failed: %s", a.Type, a.ID, err)
+			}
+			if !understood {
+				logger.Printf("Polled %s %s wasn't understood\n", a.Type, a.ID)
+			}
+		}
+		last = a.ID
+		state.SeeAction(b.ID, a.ID)
+	}
+	return last, nil
+}
+
+// pollRoute works out which webhook, by object type and ID, would have been sent an action, if any.
+func pollRoute(a polledAction, watched, active map[string]bool) (string, string) {
+	for _, t := range pollCardActions {
+		if a.Type == t {
+			if active[a.Data.Card.ID] {
+				return "card", a.Data.Card.ID
+			}
+			return "", ""
+		}
+	}
+	for _, id := range []string{a.Data.ListAfter.ID, a.Data.ListBefore.ID, a.Data.List.ID} {
+		if watched[id] {
+			return "list", id
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,187 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestPollBoard checks that polling handles changes made with the watcher's token by someone using the board,
+// and skips the changes the watcher made itself.
+func TestPollBoard(t *testing.T) {
+	fake, boardID := watchFake(t)
+	useTrelloTransport(ownWritesTransport{next: fake})
+	project := fake.AddCard(fake.ListID(boardID, "Projects"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	since := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	fake.Move(project.ID, board.Active.ID)
+	last, err := PollBoard(boards[0], since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write", "ship"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("To Do = %q, want %q", got, want)
+	}
+
+	fake.Check(cl.CheckItems[0].ID, "complete")
+	if last, err = PollBoard(boards[0], last); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.Done.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Done = %q, want %q", got, want)
+	}
+
+	// The watcher's move of the task card to Done is read next, and skipped.
+	before := len(recentEvents.events)
+	if _, err := PollBoard(boards[0], last); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recentEvents.events) - before; n != 0 {
+		t.Errorf("handled %d of the watcher's own actions", n)
+	}
+	if len(state.Writes) != 0 {
+		t.Errorf("writes left unmatched: %v", state.Writes)
+	}
+}
+
+// TestPollBoardPages checks that more actions than Trello sends at once are read a page at a time.
+func TestPollBoardPages(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Projects"), "Launch")
+	fake.AddChecklist(project.ID, "Tasks", "write")
+	stored := fake.AddCard(board.Storage.ID, "old")
+	since := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	fake.Move(project.ID, board.Active.ID)
+	for i := 0; i < pollLimit; i++ {
+		fake.addAction(stored, "updateCard", "pos", map[string]interface{}{})
+	}
+	if _, err := PollBoard(boards[0], since); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+}
+
+// TestCatchUp checks that the changes made with the watcher's token while it was down are handled on startup.
+func TestCatchUp(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Projects"), "Launch")
+	fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	seen := fake.addAction(project, "updateCard", "name", map[string]interface{}{})
+	state.SeeAction(boardID, seen.ID)
+
+	fake.Move(project.ID, board.Active.ID)
+	CatchUp()
+	if got, want := fake.cardsOn(board.ToDo.ID), []string{"write", "ship"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+	if got := state.LastAction(boardID); got <= seen.ID {
+		t.Errorf("the last action seen is still %s", got)
+	}
+}
+
+// TestPollBoardFailure checks that polling stops short of an action that fails, so the next poll tries it again.
+func TestPollBoardFailure(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write")
+	since := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	// Completing an item whose card can't be found fails.
+	fake.Check(cl.CheckItems[0].ID, "complete")
+	failed := fake.Actions[len(fake.Actions)-1].ID
+	last, err := PollBoard(boards[0], since)
+	if err == nil {
+		t.Fatal("polling an action that failed succeeded")
+	}
+	if last >= failed {
+		t.Errorf("polling went on to %s, past the failed action", last)
+	}
+
+	fake.AddCard(board.ToDo.ID, "write")
+	if last, err = PollBoard(boards[0], since); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.cardsOn(board.Done.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+	if last < failed {
+		t.Errorf("polling didn't go past the action once it was handled")
+	}
+}
+
+// TestCatchUpFailure checks that an action that fails isn't recorded as seen, so the next catch up tries it again.
+func TestCatchUpFailure(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write")
+	seen := fake.addAction(project, "updateCard", "name", map[string]interface{}{})
+	state.SeeAction(boardID, seen.ID)
+
+	// Completing an item whose card can't be found fails.
+	fake.Check(cl.CheckItems[0].ID, "complete")
+	CatchUp()
+	if got := state.LastAction(boardID); got != seen.ID {
+		t.Errorf("the last action seen is %s, past the failed one", got)
+	}
+
+	fake.AddCard(board.ToDo.ID, "write")
+	CatchUp()
+	if got, want := fake.cardsOn(board.Done.ID), []string{"write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+	if got := state.LastAction(boardID); got <= seen.ID {
+		t.Errorf("the last action seen is still %s", got)
+	}
+}
+
+// TestPollActions checks that polling and catching up act on each kind of change made while webhooks weren't delivered,
+// on a board with a "Launch" project whose tasks are "write" and "ship".
+func TestPollActions(t *testing.T) {
+	tests := []struct {
+		name string
+		// list is where the project card starts.
+		list string
+		// act changes the board the way someone using it would.
+		act        func(f *FakeTrello, project *FakeCard, cl *FakeChecklist)
+		todo, done []string
+	}{
+		{"activate", "Projects", func(f *FakeTrello, project *FakeCard, cl *FakeChecklist) {
+			f.Move(project.ID, board.Active.ID)
+		}, []string{"write", "ship"}, nil},
+		{"complete", "Active", func(f *FakeTrello, project *FakeCard, cl *FakeChecklist) {
+			f.AddCard(board.ToDo.ID, "write")
+			f.Check(cl.CheckItems[0].ID, "complete")
+		}, nil, []string{"write"}},
+		{"unwatched", "Projects", func(f *FakeTrello, project *FakeCard, cl *FakeChecklist) {
+			f.addAction(f.AddCard(board.Storage.ID, "old"), "updateCard", "pos", map[string]interface{}{})
+		}, nil, nil},
+	}
+	for _, tt := range tests {
+		for _, catchUp := range []bool{false, true} {
+			fake, boardID := watchFake(t)
+			project := fake.AddCard(fake.ListID(boardID, tt.list), "Launch")
+			cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+			seen := fake.addAction(project, "updateCard", "name", map[string]interface{}{})
+			state.SeeAction(boardID, seen.ID)
+
+			tt.act(fake, project, cl)
+			if catchUp {
+				CatchUp()
+			} else if _, err := PollBoard(boards[0], seen.ID); err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+			if got := fake.cardsOn(board.ToDo.ID); !reflect.DeepEqual(got, tt.todo) {
+				t.Errorf("%s with catch up %v: To Do = %q, want %q", tt.name, catchUp, got, tt.todo)
+			}
+			if got := fake.cardsOn(board.Done.ID); !reflect.DeepEqual(got, tt.done) {
+				t.Errorf("%s with catch up %v: Done = %q, want %q", tt.name, catchUp, got, tt.done)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+)
+
+// projectPrefix names the task cards the watcher makes "Project: item", to tell projects apart on To Do.
+var projectPrefix bool
+
+// TaskCardName is the name of the task card for a project's checklist item.
+func TaskCardName(project, item string) string {
+	if !projectPrefix || project == "" {
+		return item
+	}
+	return ProjectName(project) + ": " + item
+}
+
+// TaskName is a task card's name without its project's prefix, which is its checklist item's name.
+// The prefix is taken off even without -project-prefix, so cards made with it still match.
+func TaskName(project, card string) string {
+	if project == "" {
+		return card
+	}
+	return strings.TrimPrefix(card, ProjectName(project)+": ")
+}
+
+// RenamedTaskCardName is the name of a project's task card after its checklist item is renamed to item.
+// A card with the project's prefix keeps it, and one without gets it with -project-prefix.
+func RenamedTaskCardName(project, card, item string) string {
+	if TaskName(project, card) != card {
+		return ProjectName(project) + ": " + item
+	}
+	return TaskCardName(project, item)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// presets bundle flag values for common ways of working.
+// Flags given on the command line override the preset's values.
+var presets = map[string]map[string]string{
+	// One person, one active project, minimal noise.
+	"solo-maker": {
+		"webhook-lists":    "Active,Done",
+		"strict":           "false",
+		"hygiene-interval": "168h",
+		"max-mutations":    "100",
+	},
+	// Frequent reviews, so every working list is watched and the board is linted daily.
+	"gtd": {
+		"webhook-lists":    "Active,To Do,Done",
+		"strict":           "false",
+		"hygiene-interval": "24h",
+		"resolve-interval": "1h",
+		"max-mutations":    "200",
+	},
+	// Several people share the board, so don't guess and keep bulk changes small.
+	"kanban-team": {
+		"webhook-lists":    "Active,To Do,Done",
+		"strict":           "true",
+		"hygiene-interval": "24h",
+		"resolve-interval": "15m",
+		"max-mutations":    "50",
+	},
+}
+
+// ApplyPreset sets the preset's flag values, except for flags that were given explicitly.
+func ApplyPreset(name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, f := range sortedKeys(preset) {
+		if given[f] {
+			continue
+		}
+		if err := flag.Set(f, preset[f]); err != nil {
+			return fmt.Errorf("preset %q has a bad value for -%s: %s", name, f, err)
+		}
+	}
+	return nil
+}
+
+// PresetsCommand prints what each preset, or just the named ones, expands to.
+//
+//	trello-watcher presets [name...]
+func PresetsCommand(args []string) error {
+	names := args
+	if len(names) == 0 {
+		names = sortedKeys(presets)
+	}
+	for _, name := range names {
+		preset, ok := presets[name]
+		if !ok {
+			return fmt.Errorf("unknown preset %q", name)
+		}
+		fmt.Println(name + ":")
+		for _, f := range sortedKeys(preset) {
+			fmt.Printf("  -%s=%q\n", f, preset[f])
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
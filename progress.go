@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ifo/trel"
+)
+
+// projectProgress keeps a count of complete checklist items, like "[3/7]", at the end of each Active project card's name.
+var projectProgress bool
+
+// progressSuffix is the count at the end of a project card's name.
+var progressSuffix = regexp.MustCompile(`\s*\[\d+/\d+\]$`)
+
+// ProjectName is a project card's name without its progress count.
+func ProjectName(name string) string {
+	return progressSuffix.ReplaceAllString(name, "")
+}
+
+// ProgressName is a project card's name with the count of complete checklist items out of all of them.
+func ProgressName(name string, checklists trel.Checklists) string {
+	complete, total := 0, 0
+	for _, cl := range checklists {
+		for _, ci := range cl.CheckItems {
+			if ci.State == "complete" {
+				complete++
+			}
+			total++
+		}
+	}
+	return fmt.Sprintf("%s [%d/%d]", ProjectName(name), complete, total)
+}
+
+// UpdateProgress counts a project card's checklist items, once the rest of the plan is done,
+// and renames the card if its count is out of date. It does nothing without -project-progress.
+func (p *Plan) UpdateProgress(projectID, projectName string) {
+	if !projectProgress {
+		return
+	}
+	p.Changes = append(p.Changes, Change{
+		Op: "updateProgress", Card: ProjectName(projectName),
+		apply: func() error {
+			project, err := trelClient.Card(projectID)
+			if err != nil {
+				return err
+			}
+			// A project stored since keeps its last count.
+			if project.IDList != board.Active.ID {
+				return nil
+			}
+			checklists, err := project.Checklists()
+			if err != nil {
+				return err
+			}
+			if name := ProgressName(project.Name, checklists); name != project.Name {
+				return RenameCard(&project, name)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/url"
+)
+
+// projectLabels gives each task card the watcher makes a label named after its project, to tell projects apart on To Do.
+var projectLabels bool
+
+// labelColors are the colors Trello has for labels, which a project's label color is picked from by its name.
+var labelColors = []string{"green", "yellow", "orange", "red", "purple", "blue", "sky", "lime", "pink", "black"}
+
+// taskLabels are the project label IDs, by project card ID.
+// Label IDs are unique across boards, so every board's labels are kept together.
+var taskLabels = map[string]string{}
+
+// ProjectLabel finds the label named after a project card on the board, making it if it is missing,
+// and returns its ID. A new label takes the color of the project card's first label,
+// or if it has none, a color picked by its name, so it stays the same every time.
+func ProjectLabel(projectID string) (string, error) {
+	if id, ok := taskLabels[projectID]; ok {
+		return id, nil
+	}
+	var project struct {
+		Name   string  `json:"name"`
+		Labels []Label `json:"labels"`
+	}
+	if err := apiDo(http.MethodGet, "cards/"+projectID, url.Values{"fields": {"name,labels"}}, &project); err != nil {
+		return "", err
+	}
+
+	var labels []Label
+	if err := apiDo(http.MethodGet, "boards/"+board.ID+"/labels", nil, &labels); err != nil {
+		return "", err
+	}
+	project.Name = ProjectName(project.Name)
+	for _, l := range labels {
+		if l.Name == project.Name {
+			taskLabels[projectID] = l.ID
+			return l.ID, nil
+		}
+	}
+
+	color := ""
+	for _, l := range project.Labels {
+		if l.Color != "" {
+			color = l.Color
+			break
+		}
+	}
+	if color == "" {
+		h := fnv.New32a()
+		h.Write([]byte(project.Name))
+		color = labelColors[h.Sum32()%uint32(len(labelColors))]
+	}
+	var l Label
+	params := url.Values{"name": {project.Name}, "color": {color}, "idBoard": {board.ID}}
+	if err := apiDo(http.MethodPost, "labels", params, &l); err != nil {
+		return "", err
+	}
+	logger.Printf("Made the %s label for %q\n", color, project.Name)
+	taskLabels[projectID] = l.ID
+	return l.ID, nil
+}
+
+// LabelTaskCard gives a task card its project's label, when -project-labels is on.
+func LabelTaskCard(cardID, projectID string) error {
+	if !projectLabels || projectID == "" {
+		return nil
+	}
+	labelID, err := ProjectLabel(projectID)
+	if err != nil {
+		return err
+	}
+	return AddCardLabel(cardID, labelID)
+}
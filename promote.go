@@ -0,0 +1,43 @@
+package main
+
+// autoPromote moves the top Projects card to Active whenever the last project leaves Active, so there is always one.
+var autoPromote bool
+
+// PlanPromotion adds moving the top Projects card to Active, and setting it up, to the plan,
+// if Active is empty once the card with leavingID has left it.
+func PlanPromotion(plan *Plan, leavingID string) error {
+	if !autoPromote {
+		return nil
+	}
+	active, err := board.Active.Cards()
+	if err != nil {
+		return err
+	}
+	for _, c := range active {
+		if c.ID != leavingID {
+			return nil
+		}
+	}
+
+	projects, err := board.Projects.Cards()
+	if err != nil {
+		return err
+	}
+	for i := range projects {
+		// The card leaving Active may have just been put back on Projects.
+		if projects[i].ID == leavingID {
+			continue
+		}
+		next := &projects[i]
+		setup, err := PlanSetupActiveProject(*next)
+		if err != nil {
+			return err
+		}
+		logger.Printf("Active is empty, promoting %q\n", next.Name)
+		plan.Move(next, board.Projects, board.Active)
+		plan.Changes = append(plan.Changes, setup.Changes...)
+		return nil
+	}
+	logger.Println("Active is empty, and there is no project to promote")
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// rateWindow is the window Trello limits requests in, 100 per token every 10 seconds.
+const rateWindow = 10 * time.Second
+
+// limiter keeps Trello requests under rateLimit per rateWindow.
+var limiter = &RateLimiter{}
+
+// RateLimiter spaces out requests so no more than Limit are sent in any rateWindow,
+// and holds every request back after Trello says to slow down.
+type RateLimiter struct {
+	Limit int // 0 for no limit.
+
+	mu     sync.Mutex
+	sent   []time.Time // When each request in the last rateWindow was sent, oldest first.
+	paused time.Time
+}
+
+// Wait blocks until a request can be sent, and reports whether it had to wait.
+func (l *RateLimiter) Wait(ctx context.Context) (bool, error) {
+	waited := false
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= rateWindow {
+			l.sent = l.sent[1:]
+		}
+		var until time.Time
+		if now.Before(l.paused) {
+			until = l.paused
+		} else if l.Limit > 0 && len(l.sent) >= l.Limit {
+			until = l.sent[0].Add(rateWindow)
+		} else {
+			l.sent = append(l.sent, now)
+			l.mu.Unlock()
+			return waited, nil
+		}
+		l.mu.Unlock()
+
+		waited = true
+		select {
+		case <-time.After(time.Until(until)):
+		case <-ctx.Done():
+			return waited, ctx.Err()
+		}
+	}
+}
+
+// PauseFor holds every request back for d, when Trello answers with a 429.
+func (l *RateLimiter) PauseFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// Recent is how many requests were sent in the last rateWindow.
+func (l *RateLimiter) Recent() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recent := 0
+	for _, t := range l.sent {
+		if time.Since(t) < rateWindow {
+			recent++
+		}
+	}
+	return recent
+}
+
+// RetryAfter is how long a 429 response says to wait, or 0 if it doesn't say.
+func RetryAfter(resp *http.Response) time.Duration {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// throttleTransport waits for the limiter before each Trello request,
+// and pauses every request when one is rate limited.
+type throttleTransport struct {
+	next http.RoundTripper
+}
+
+func (t throttleTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(r.URL.String(), trel.API_PREFIX) {
+		return t.next.RoundTrip(r)
+	}
+
+	waited, err := limiter.Wait(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	if waited {
+		stats.Add(statThrottled)
+	}
+
+	resp, err := t.next.RoundTrip(r)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		stats.Add(statRateLimited)
+		wait := RetryAfter(resp)
+		if wait <= 0 {
+			// Trello didn't say, so wait out a whole window.
+			wait = rateWindow
+		}
+		logger.Printf("Rate limited by Trello, holding requests for %s\n", wait)
+		limiter.PauseFor(wait)
+	}
+	return resp, err
+}
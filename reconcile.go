@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// reconcileInterval is how often every active project is checked for drift from missed webhooks, 0 to disable.
+var reconcileInterval time.Duration
+
+// PlanReconcile brings an active project's task cards back in line with its checklists.
+// Missing cards are brought back or made, like on activation.
+// When a task card and its checklist item disagree about being done, being done wins:
+// a complete item's card is moved to Done, and a Done card's item is completed.
+// Nothing says which side changed last, so a missed move back to To Do looks the same as a missed completion, and is undone.
+func PlanReconcile(card trel.Card) (Plan, error) {
+	plan, err := PlanActivation(card)
+	if err != nil {
+		return plan, err
+	}
+	plan.Operation = fmt.Sprintf("reconciling %q", card.Name)
+	plan.Feature = "reconcile"
+
+	checklists, err := card.Checklists()
+	if err != nil {
+		return plan, err
+	}
+	todoCards, err := board.ToDo.Cards()
+	if err != nil {
+		return plan, err
+	}
+	doneCards, err := AllCards(board.DoneLists()...)
+	if err != nil {
+		return plan, err
+	}
+	selected := SelectedChecklists(card.Description)
+
+	for _, cl := range checklists {
+		if len(selected) > 0 && !selected[cl.Name] {
+			continue
+		}
+		for i := range cl.CheckItems {
+			ci := &cl.CheckItems[i]
+			if IsCheckItemOnly(ci.Name) {
+				continue
+			}
+			if ci.State == "complete" {
+				if c, err := FindTaskCard(todoCards, ci.ID, card.Name, ci.Name); err == nil {
+					state.Link(ci.ID, c.ID)
+					plan.Move(c, board.ToDo, board.Done)
+				}
+				continue
+			}
+			if c, err := FindTaskCard(doneCards, ci.ID, card.Name, ci.Name); err == nil {
+				state.Link(ci.ID, c.ID)
+				plan.Complete(ci)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// RunReconciler reconciles every board's active projects every reconcileInterval.
+func RunReconciler() {
+	for range Schedule(reconcileInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(Reconcile)
+	}
+}
+
+// Reconcile reconciles each of the board's active projects.
+func Reconcile() error {
+	cards, err := board.Active.Cards()
+	if err != nil {
+		return fmt.Errorf("unable to reconcile: %s", err)
+	}
+	for _, card := range cards {
+		plan, err := PlanReconcile(card)
+		if err != nil {
+			logger.Printf("Unable to reconcile %q: %s\n", card.Name, err)
+			continue
+		}
+		if len(plan.Changes) > 0 {
+			logger.Printf("%q drifted, making %d changes\n", card.Name, len(plan.Changes))
+		}
+		if err := RunPlan(plan); err != nil {
+			logger.Printf("Unable to reconcile %q: %s\n", card.Name, err)
+		}
+	}
+	return nil
+}
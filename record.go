@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// recordDir is where every webhook payload the watcher handles is recorded, with a snapshot of the boards, for replay.
+// Empty to not record them.
+var recordDir string
+
+// snapshotFile is the name of the boards snapshot in a recording directory.
+const snapshotFile = "board.json"
+
+// Recording is a webhook payload as it was received, and what came of it.
+type Recording struct {
+	Received   time.Time       `json:"received"`
+	BoardID    string          `json:"boardId"`
+	ObjType    string          `json:"objType"`
+	ObjID      string          `json:"objId"`
+	Understood bool            `json:"understood"`
+	Error      string          `json:"error,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+
+	// Path is the file the recording was read from.
+	Path string `json:"-"`
+}
+
+// RecordPayload writes a handled payload to the recordDir, if there is one.
+func RecordPayload(boardID, objType, objID string, body []byte, understood bool, handleErr error) {
+	if recordDir == "" {
+		return
+	}
+	rec := Recording{Received: time.Now().UTC(), BoardID: boardID, ObjType: objType, ObjID: objID, Understood: understood, Payload: body}
+	if handleErr != nil {
+		rec.Error = handleErr.Error()
+	}
+	if !json.Valid(body) {
+		// Keep a payload that isn't JSON as a string, so the recording still is.
+		rec.Payload, _ = json.Marshal(string(body))
+	}
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err == nil {
+		// Names sort in the order the payloads were received, which is the order they are replayed in.
+		name := fmt.Sprintf("%s_%s_%s.json", rec.Received.Format("20060102T150405.000000000"), objType, objID)
+		err = ioutil.WriteFile(filepath.Join(recordDir, name), b, 0644)
+	}
+	if err != nil {
+		logger.Printf("Unable to record the %s %s payload: %s\n", objType, objID, err)
+	}
+}
+
+// SnapshotBoards writes every board's lists, open cards, checklists, and labels to the recordDir,
+// as the FakeTrello recordings are replayed against.
+func SnapshotBoards() error {
+	if err := os.MkdirAll(recordDir, 0755); err != nil {
+		return err
+	}
+	fake := NewFakeTrello()
+	var err error
+	if fake.MemberID, err = WatcherMemberID(); err != nil {
+		return err
+	}
+
+	for _, b := range boards {
+		fake.Boards = append(fake.Boards, &FakeBoard{ID: b.ID, Name: b.Name})
+		var lists []*FakeList
+		var cards []*FakeCard
+		var checklists []*FakeChecklist
+		var labels []*FakeLabel
+		gets := []struct {
+			path   string
+			params url.Values
+			out    interface{}
+		}{
+			{"boards/" + b.ID + "/lists", url.Values{"filter": {"all"}}, &lists},
+			{"boards/" + b.ID + "/cards", url.Values{"filter": {"open"}}, &cards},
+			{"boards/" + b.ID + "/checklists", url.Values{"checkItem_fields": {"name,state,idChecklist,due,idMember,pos"}}, &checklists},
+			{"boards/" + b.ID + "/labels", nil, &labels},
+		}
+		for _, g := range gets {
+			if err := apiDo(http.MethodGet, g.path, g.params, g.out); err != nil {
+				return fmt.Errorf("unable to snapshot %s: %s", b.Name, err)
+			}
+		}
+		fake.Lists = append(fake.Lists, lists...)
+		fake.Cards = append(fake.Cards, cards...)
+		fake.Checklists = append(fake.Checklists, checklists...)
+		fake.Labels = append(fake.Labels, labels...)
+	}
+
+	return fake.Save(filepath.Join(recordDir, snapshotFile))
+}
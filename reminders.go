@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// reminderLeads are how long before a To Do card's due date it is reminded about, none to not remind.
+var reminderLeads []time.Duration
+
+// reminderInterval is how often To Do cards are checked for due dates to remind about.
+var reminderInterval time.Duration
+
+// reminderURL is where reminders are posted, like a Slack or Mattermost incoming webhook, empty to only comment.
+var reminderURL string
+
+// SetReminderLeads parses a comma separated list of lead times, like "1d,2h".
+// A lead is a Go duration, or a whole number of days like "3d".
+func SetReminderLeads(leads string) error {
+	reminderLeads = nil
+	for _, s := range strings.Split(leads, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		lead, err := ParseDays(s)
+		if err != nil {
+			return fmt.Errorf("bad reminder lead time %q, use a duration like \"2h\" or days like \"1d\"", s)
+		}
+		if lead <= 0 {
+			return fmt.Errorf("bad reminder lead time %q, it must be more than 0", s)
+		}
+		reminderLeads = append(reminderLeads, lead)
+	}
+	sort.Slice(reminderLeads, func(i, j int) bool { return reminderLeads[i] < reminderLeads[j] })
+	return nil
+}
+
+// leadName is a lead time for people, like "1 day" or "2h".
+func leadName(lead time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case lead == day:
+		return "1 day"
+	case lead%day == 0:
+		return fmt.Sprintf("%d days", lead/day)
+	}
+	s := lead.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// ReminderLead is the shortest lead time whose reminder is due at now for a card due then, if any is.
+// Only the shortest is sent, so a watcher that was down doesn't send every reminder it missed at once.
+func ReminderLead(now, due time.Time) (time.Duration, bool) {
+	if !now.Before(due) {
+		return 0, false
+	}
+	for _, lead := range reminderLeads {
+		if !now.Before(due.Add(-lead)) {
+			return lead, true
+		}
+	}
+	return 0, false
+}
+
+// SendDueReminders comments on each To Do card whose due date is within a lead time,
+// and posts the reminder to the reminderURL if there is one.
+// Each reminder is sent once per due date, and the longer ones it passed are skipped.
+func SendDueReminders() error {
+	cards, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return err
+	}
+	now := Now()
+	for _, c := range cards {
+		if c.Due == nil || c.DueComplete {
+			continue
+		}
+		lead, ok := ReminderLead(now, *c.Due)
+		if !ok || state.Reminded(c.ID, lead, *c.Due) {
+			continue
+		}
+
+		when := c.Due.In(location).Format("Mon Jan 2 15:04")
+		if err := Comment(c.ID, fmt.Sprintf("Reminder: due %s, in less than %s.", when, leadName(lead))); err != nil {
+			return err
+		}
+		if reminderURL != "" {
+			msg := fmt.Sprintf("%s on %s is due %s, in less than %s", c.Name, board.Name, when, leadName(lead))
+			if err := PostMessage(reminderURL, msg); err != nil {
+				logger.Printf("Unable to post the reminder for %q: %s\n", c.Name, err)
+			}
+		}
+		// The longer leads are passed too, so they aren't sent late.
+		for _, l := range reminderLeads {
+			if l >= lead {
+				state.Remind(c.ID, l, *c.Due)
+			}
+		}
+		logger.Printf("Reminded %q is due %s\n", c.Name, when)
+		usage.Record("due-reminder")
+	}
+	return nil
+}
+
+// SendCheckItemReminders reminds about each incomplete checklist item with a due date within a lead time
+// on the Projects and Active project cards that has no card in To Do,
+// like the items of a project that hasn't started yet, or of a checklist it doesn't use.
+// It comments on the project card, and posts the reminder to the reminderURL if there is one.
+// Items with a card in To Do are left to SendDueReminders, which goes by the card's due date.
+func SendCheckItemReminders() error {
+	todo, err := board.ToDo.Cards()
+	if err != nil {
+		return err
+	}
+	var projects []CardInfo
+	for _, l := range []trel.List{board.Projects, board.Active} {
+		cards, err := ListCardInfo(l.ID)
+		if err != nil {
+			return err
+		}
+		projects = append(projects, cards...)
+	}
+
+	now := Now()
+	for _, p := range projects {
+		cls, err := CardChecklistInfo(p.ID)
+		if err != nil {
+			return err
+		}
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				if ci.Due == nil || ci.State == "complete" {
+					continue
+				}
+				lead, ok := ReminderLead(now, *ci.Due)
+				if !ok || state.Reminded(ci.ID, lead, *ci.Due) {
+					continue
+				}
+				// More than one card found is an error, but still means the item has a card.
+				if _, err := FindTaskCard(todo, ci.ID, p.Name, ci.Name); err == nil {
+					continue
+				} else if _, ok := err.(trel.NotFoundError); !ok {
+					continue
+				}
+
+				when := ci.Due.In(location).Format("Mon Jan 2 15:04")
+				if err := Comment(p.ID, fmt.Sprintf("Reminder: %s is due %s, in less than %s.", ci.Name, when, leadName(lead))); err != nil {
+					return err
+				}
+				if reminderURL != "" {
+					msg := fmt.Sprintf("%s in %s on %s is due %s, in less than %s", ci.Name, ProjectName(p.Name), board.Name, when, leadName(lead))
+					if err := PostMessage(reminderURL, msg); err != nil {
+						logger.Printf("Unable to post the reminder for %q: %s\n", ci.Name, err)
+					}
+				}
+				for _, l := range reminderLeads {
+					if l >= lead {
+						state.Remind(ci.ID, l, *ci.Due)
+					}
+				}
+				logger.Printf("Reminded %q in %q is due %s\n", ci.Name, p.Name, when)
+				usage.Record("checkitem-due-reminder")
+			}
+		}
+	}
+	return nil
+}
+
+// RunDueReminders sends due date reminders every reminderInterval.
+func RunDueReminders() {
+	for range Schedule(reminderInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(func() error {
+			if err := SendDueReminders(); err != nil {
+				return fmt.Errorf("unable to send due date reminders: %s", err)
+			}
+			if err := SendCheckItemReminders(); err != nil {
+				return fmt.Errorf("unable to send checklist item due date reminders: %s", err)
+			}
+			return nil
+		})
+		state.PruneReminders(Now())
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSendCheckItemReminders checks that due checklist items without a card in To Do are reminded about once,
+// on their project card, and that items with a card are left to the card's reminders.
+func TestSendCheckItemReminders(t *testing.T) {
+	fake, boardID := watchFake(t)
+	oldLeads := reminderLeads
+	t.Cleanup(func() { reminderLeads = oldLeads })
+	if err := SetReminderLeads("1d,2h"); err != nil {
+		t.Fatal(err)
+	}
+
+	soon, later := Now().Add(time.Hour), Now().Add(72*time.Hour)
+	planned := fake.AddCard(fake.ListID(boardID, "Projects"), "Launch")
+	cl := fake.AddChecklist(planned.ID, "Tasks", "write", "ship", "tag")
+	cl.CheckItems[0].Due, cl.CheckItems[1].Due = &soon, &later
+	active := fake.AddCard(fake.ListID(boardID, "Active"), "Docs")
+	cl = fake.AddChecklist(active.ID, "Tasks", "review", "publish")
+	cl.CheckItems[0].Due, cl.CheckItems[1].Due = &soon, &soon
+	cl.CheckItems[1].State = "complete"
+	fake.AddCard(board.ToDo.ID, "review")
+
+	comments := func(cardID string) int {
+		n := 0
+		for _, a := range fake.Actions {
+			if a.Type == "commentCard" && a.card == cardID {
+				n++
+			}
+		}
+		return n
+	}
+	tests := []struct {
+		card *FakeCard
+		want int
+	}{
+		{planned, 1}, // Only "write" is due within a lead.
+		{active, 0},  // "review" has a card, and "publish" is complete.
+	}
+	for i := 0; i < 2; i++ {
+		if err := SendCheckItemReminders(); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			if got := comments(tt.card.ID); got != tt.want {
+				t.Errorf("run %d: %q got %d reminders, want %d", i+1, tt.card.Name, got, tt.want)
+			}
+		}
+	}
+}
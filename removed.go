@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// onCardRemoved is what happens when a task card is deleted or archived:
+// "recreate" its card, "complete" or "remove" its checklist item, or "" to leave the item alone.
+var onCardRemoved string
+
+// isTaskList reports whether a list holds task cards, which are To Do and the Done lists.
+func isTaskList(id string) bool {
+	if id == board.ToDo.ID {
+		return true
+	}
+	for _, l := range board.DoneLists() {
+		if l.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleRemoved deals with a task card being deleted or archived, as -on-card-removed says.
+func (lc ListChange) HandleRemoved() error {
+	lc.RecordCycles()
+	plan, err := lc.PlanRemoved()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = lc.Action.ID
+	return RunPlan(plan)
+}
+
+// PlanRemoved works out what needs to change because a task card was deleted or archived.
+func (lc ListChange) PlanRemoved() (Plan, error) {
+	card := trel.Card{ID: lc.Action.Data.Card.ID, Name: lc.Action.Data.Card.Name}
+	deleted := lc.Action.Type == "deleteCard"
+	plan := Plan{Operation: fmt.Sprintf("archived %q", card.Name), Feature: "card-removed"}
+	if deleted {
+		plan.Operation = fmt.Sprintf("deleted card %s", card.ID)
+	}
+	if !isTaskList(lc.Action.Data.List.ID) {
+		return plan, nil
+	}
+
+	// A deleted card's name isn't sent, so only a card linked to its item can be matched.
+	ci, err := FindTaskCheckItem(board.Active, card)
+	if _, ok := err.(trel.NotFoundError); ok {
+		logger.Printf("The %s task card isn't for an active project's checklist item\n", plan.Operation)
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	if deleted {
+		state.Unlink(ci.ID)
+	}
+
+	switch onCardRemoved {
+	case "recreate":
+		to := board.ToDo
+		if ci.State == "complete" {
+			to = board.Done
+		}
+		plan.CreateFor(TaskCardName(ci.Checklist.Card.Name, ci.Name), to, "", ci.ID, ci.Checklist.IDCard)
+	case "complete":
+		if ci.State != "complete" {
+			plan.Complete(ci)
+		}
+	case "remove":
+		plan.RemoveCheckItem(ci)
+	}
+	return plan, nil
+}
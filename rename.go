@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// HandleRename renames a task card's checklist item to match the card, so they keep matching by name.
+func (lc ListChange) HandleRename() error {
+	plan, err := lc.PlanRename()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = lc.Action.ID
+	return RunPlan(plan)
+}
+
+// PlanRename works out which checklist item needs renaming because a To Do or Done card was renamed.
+func (lc ListChange) PlanRename() (Plan, error) {
+	card := trel.Card{ID: lc.Action.Data.Card.ID, Name: lc.Action.Data.Card.Name}
+	oldName := lc.Action.Data.Old.Name
+	plan := Plan{Operation: fmt.Sprintf("renaming %q to %q", oldName, card.Name), Feature: "rename-sync"}
+
+	// Only task cards have checklist items.
+	listName := lc.Action.Data.List.Name
+	if listName != board.ToDo.Name && !board.IsDone(listName) {
+		return plan, nil
+	}
+
+	// The item is found by the card's old name, if it isn't linked to the card already.
+	ci, err := FindTaskCheckItem(board.Active, trel.Card{ID: card.ID, Name: oldName})
+	if _, ok := err.(trel.NotFoundError); ok {
+		// The card isn't for an active project's checklist item.
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	state.Link(ci.ID, card.ID)
+	if name := TaskName(ci.Checklist.Card.Name, card.Name); ci.Name != name {
+		plan.RenameCheckItem(ci, name)
+	}
+	return plan, nil
+}
+
+// HandleCheckItemRename renames an Active project's checklist item's task card to match the item.
+func (cic CheckItemChange) HandleCheckItemRename() error {
+	plan, err := cic.PlanRename()
+	if err != nil {
+		return err
+	}
+	plan.ActionID = cic.Action.ID
+	return RunPlan(plan)
+}
+
+// PlanRename works out which task card needs renaming because a checklist item was renamed.
+// Other changes to the item, like its due date, change nothing.
+func (cic CheckItemChange) PlanRename() (Plan, error) {
+	ciID, name := cic.Action.Data.CheckItem.ID, cic.Action.Data.CheckItem.Name
+	oldName := cic.Action.Data.Old.Name
+	plan := Plan{Operation: fmt.Sprintf("renaming %q to %q", oldName, name), Feature: "rename-sync"}
+	if oldName == "" || oldName == name {
+		return plan, nil
+	}
+
+	cards, err := AllCards(append(board.DoneLists(), board.ToDo)...)
+	if err != nil {
+		return plan, err
+	}
+	project := cic.Action.Data.Card.Name
+	// The card is found by the item's old name, if it isn't linked to the item already.
+	card, err := FindTaskCard(cards, ciID, project, oldName)
+	if _, ok := err.(trel.NotFoundError); ok {
+		// The item has no card, like a -checkitem-only one.
+		return plan, nil
+	} else if err != nil {
+		return plan, err
+	}
+	state.Link(ciID, card.ID)
+	if name = RenamedTaskCardName(project, card.Name, name); card.Name != name {
+		plan.RenameCard(card, name)
+	}
+	return plan, nil
+}
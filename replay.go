@@ -0,0 +1,137 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// replayFake is the Trello a replay runs against, nil unless running replay.
+var replayFake *FakeTrello
+
+// replayFlags are the flags the replay command takes.
+func replayFlags() (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	boardFile := fs.String("board", "", "boards snapshot to replay against (defaults to the board.json of the first directory given)")
+	out := fs.String("o", "", "file to save the boards to after replaying, to compare or replay more against")
+	return fs, boardFile, out
+}
+
+// SetupReplay loads the boards a replay runs against into a FakeTrello, and makes it answer every Trello request,
+// returning the comma separated IDs of the boards to watch.
+func SetupReplay(args []string) (string, error) {
+	fs, boardFile, _ := replayFlags()
+	fs.Parse(args)
+	if *boardFile == "" && fs.NArg() > 0 {
+		*boardFile = filepath.Join(fs.Arg(0), snapshotFile)
+	}
+	if *boardFile == "" {
+		return "", fmt.Errorf("replay needs a recording directory or -board")
+	}
+
+	var err error
+	if replayFake, err = LoadFakeTrello(*boardFile); err != nil {
+		return "", err
+	}
+	replayFake.Install()
+
+	var ids []string
+	for _, b := range replayFake.Boards {
+		ids = append(ids, b.ID)
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// ReplayResult is what came of replaying a recording.
+type ReplayResult struct {
+	Understood bool
+	Err        error
+	// Calls are the changes the watcher made to the fake in response.
+	Calls []FakeCall
+}
+
+// ReadRecordings reads recordings from files and directories, with a directory's in the order they were received.
+func ReadRecordings(paths []string) ([]Recording, error) {
+	var recs []Recording
+	for _, p := range paths {
+		files := []string{p}
+		if info, err := os.Stat(p); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(p, "*.json")); err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+		}
+		for _, f := range files {
+			if filepath.Base(f) == snapshotFile {
+				continue
+			}
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			rec := Recording{Path: f}
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return nil, fmt.Errorf("%s: %s", f, err)
+			}
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+// Replay handles a recording as if Trello had just sent it, against the replayFake.
+func Replay(rec Recording) ReplayResult {
+	before := len(replayFake.Calls)
+	var r ReplayResult
+	r.Understood, r.Err = DispatchPayload(rec.BoardID, rec.ObjType, rec.ObjID, rec.Payload)
+	r.Calls = append(r.Calls, replayFake.Calls[before:]...)
+	return r
+}
+
+// ReplayCommand feeds recorded webhook payloads back through the handlers, against a fake of the boards,
+// and prints the changes each one made.
+//
+//	trello-watcher [flags] replay [-board board.json] [-o after.json] dir|file...
+func ReplayCommand(args []string) error {
+	fs, _, out := replayFlags()
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("replay needs a recording directory or files")
+	}
+
+	recs, err := ReadRecordings(fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		r := Replay(rec)
+		switch {
+		case r.Err != nil:
+			fmt.Printf("%s: failed: %s\n", rec.Path, r.Err)
+		case !r.Understood:
+			fmt.Printf("%s: not understood\n", rec.Path)
+		default:
+			fmt.Printf("%s: %d changes\n", rec.Path, len(r.Calls))
+		}
+		if rec.Understood != r.Understood || (rec.Error == "") != (r.Err == nil) {
+			fmt.Printf("  differs from when it was recorded (understood: %t, error: %q)\n", rec.Understood, rec.Error)
+		}
+		for _, c := range r.Calls {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+
+	if *out != "" {
+		return replayFake.Save(*out)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReplay replays a recording of a project being activated and one of its tasks completed.
+func TestReplay(t *testing.T) {
+	// SetupReplay installs the fake for good, so the transports tests start with are put back.
+	t.Cleanup(func() { useTrelloTransport(nil); replayFake = nil })
+	ids, err := SetupReplay([]string{"testdata/replay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchBoards(t, ids)
+
+	recs, err := ReadRecordings([]string{"testdata/replay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("read %d recordings, want 2", len(recs))
+	}
+	for _, rec := range recs {
+		r := Replay(rec)
+		if r.Err != nil || !r.Understood {
+			t.Fatalf("%s: understood %t, error %v", rec.Path, r.Understood, r.Err)
+		}
+		if len(r.Calls) == 0 {
+			t.Errorf("%s: made no changes", rec.Path)
+		}
+	}
+
+	if got, want := replayFake.cardsOn(board.ToDo.ID), []string{"Tag the release"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("To Do = %q, want %q", got, want)
+	}
+	if got, want := replayFake.cardsOn(board.Done.ID), []string{"Update the docs", "Write the announcement"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Done = %q, want %q", got, want)
+	}
+	if got := replayFake.cardsOn(board.Storage.ID); len(got) != 0 {
+		t.Errorf("Storage = %q, want it empty", got)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// A RetentionPolicy is which old cards the retention job archives or deletes.
+type RetentionPolicy struct {
+	// DoneAge is how long a card stays on a Done list before it is archived, 0 to keep it.
+	DoneAge time.Duration
+	// Orphans is whether to "archive" or "delete" Storage cards whose project card was deleted, empty to keep them.
+	Orphans string
+	// MaxStorage is the most cards kept in Storage, the least recently active beyond it are archived, 0 for no limit.
+	MaxStorage int
+}
+
+// retention is the retention policy, the zero one to not run the job.
+var retention RetentionPolicy
+
+// retentionInterval is how often the retention policy is applied.
+var retentionInterval time.Duration
+
+// SetRetention parses comma separated retention rules, like "archive-done=30d,orphans=archive,max-storage=200".
+func SetRetention(rules string) error {
+	retention = RetentionPolicy{}
+	for _, rule := range strings.Split(rules, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("bad retention rule %q, use name=value", rule)
+		}
+		name, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch name {
+		case "archive-done":
+			age, err := ParseDays(value)
+			if err != nil || age <= 0 {
+				return fmt.Errorf("bad archive-done age %q, use a duration like \"12h\" or days like \"30d\"", value)
+			}
+			retention.DoneAge = age
+		case "orphans":
+			if value != "archive" && value != "delete" {
+				return fmt.Errorf("bad orphans %q, use \"archive\" or \"delete\"", value)
+			}
+			retention.Orphans = value
+		case "max-storage":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("bad max-storage %q, use a number of cards more than 0", value)
+			}
+			retention.MaxStorage = n
+		default:
+			return fmt.Errorf("unknown retention rule %q, use \"archive-done\", \"orphans\", or \"max-storage\"", name)
+		}
+	}
+	return nil
+}
+
+// boardCheckItemProjects fetches every checklist item on the board, including those on archived cards,
+// and returns the name of the project card each is on, by item ID.
+func boardCheckItemProjects() (map[string]string, error) {
+	var cards []struct {
+		Name       string          `json:"name"`
+		Checklists []ChecklistInfo `json:"checklists"`
+	}
+	params := url.Values{"fields": {"name"}, "checklists": {"all"}}
+	if err := apiDo(http.MethodGet, "boards/"+board.ID+"/cards/all", params, &cards); err != nil {
+		return nil, err
+	}
+	projects := map[string]string{}
+	for _, c := range cards {
+		for _, cl := range c.Checklists {
+			for _, ci := range cl.CheckItems {
+				projects[ci.ID] = ProjectName(c.Name)
+			}
+		}
+	}
+	return projects, nil
+}
+
+// activeTasks are the IDs of the checklist items on Active project cards, and the names of their task cards.
+func activeTasks() (map[string]bool, error) {
+	projects, err := board.Active.Cards()
+	if err != nil {
+		return nil, err
+	}
+	tasks := map[string]bool{}
+	for _, p := range projects {
+		cls, err := p.Checklists()
+		if err != nil {
+			return nil, err
+		}
+		for _, cl := range cls {
+			for _, ci := range cl.CheckItems {
+				tasks[ci.ID] = true
+				tasks[TaskCardName(p.Name, ci.Name)] = true
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// PlanRetention works out which cards the retention policy archives or deletes.
+// Done cards of Active projects are kept, since reconciling would make them again.
+// A Storage card is only an orphan if it is known to be for a checklist item that is gone,
+// so cards stored before the watcher kept track of them are never taken for orphans.
+func PlanRetention() (Plan, error) {
+	plan := Plan{Operation: "applying the retention policy", Feature: "retention"}
+
+	if retention.DoneAge > 0 {
+		active, err := activeTasks()
+		if err != nil {
+			return plan, err
+		}
+		for _, l := range board.DoneLists() {
+			cards, err := l.Cards()
+			if err != nil {
+				return plan, err
+			}
+			for i := range cards {
+				// Reconciling would only make the task cards of Active projects again.
+				ciID, _ := state.TaskCheckItem(cards[i].ID)
+				if active[ciID] || active[cards[i].Name] {
+					continue
+				}
+				since, err := InListSince(cards[i].ID)
+				if err != nil {
+					return plan, err
+				}
+				// A card whose move to Done is too old for Trello to still have can't be aged, so it is kept.
+				if since.IsZero() || time.Since(since) <= retention.DoneAge {
+					continue
+				}
+				plan.Archive(&cards[i], l)
+			}
+		}
+	}
+
+	if retention.Orphans == "" && retention.MaxStorage == 0 {
+		return plan, nil
+	}
+	stored, err := ListCardInfo(board.Storage.ID)
+	if err != nil {
+		return plan, err
+	}
+	gone := map[string]bool{}
+	if retention.Orphans != "" {
+		items, err := boardCheckItemProjects()
+		if err != nil {
+			return plan, err
+		}
+		for _, c := range stored {
+			ciID, ok := state.TaskCheckItem(c.ID)
+			if _, found := items[ciID]; !ok || found {
+				continue
+			}
+			card := &trel.Card{ID: c.ID, Name: c.Name}
+			if retention.Orphans == "delete" {
+				plan.RemoveCard(card, board.Storage)
+			} else {
+				plan.Archive(card, board.Storage)
+			}
+			gone[c.ID] = true
+		}
+	}
+
+	if retention.MaxStorage > 0 && len(stored)-len(gone) > retention.MaxStorage {
+		sort.SliceStable(stored, func(i, j int) bool { return stored[i].DateLastActivity.After(stored[j].DateLastActivity) })
+		kept := 0
+		for _, c := range stored {
+			if gone[c.ID] {
+				continue
+			}
+			if kept++; kept > retention.MaxStorage {
+				plan.Archive(&trel.Card{ID: c.ID, Name: c.Name}, board.Storage)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// RunRetention applies the retention policy on every board every retentionInterval.
+func RunRetention() {
+	for range Schedule(retentionInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(ApplyRetention)
+	}
+}
+
+// ApplyRetention archives and deletes the board's cards the retention policy no longer keeps.
+func ApplyRetention() error {
+	plan, err := PlanRetention()
+	if err != nil {
+		return fmt.Errorf("unable to apply the retention policy: %s", err)
+	}
+	if len(plan.Changes) == 0 || Shadow(plan) {
+		return nil
+	}
+	if err := CheckGuardrail(plan); err != nil {
+		logger.Println(err)
+		return nil
+	}
+	if err := ApplyPlan(plan); err != nil {
+		return fmt.Errorf("unable to apply the retention policy: %s", err)
+	}
+	logger.Printf("Archived or deleted %d cards for the retention policy\n", len(plan.Changes))
+	return nil
+}
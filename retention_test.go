@@ -0,0 +1,44 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanRetentionDoneAge(t *testing.T) {
+	fake, boardID := watchFake(t)
+	project := fake.AddCard(fake.ListID(boardID, "Active"), "Launch")
+	cl := fake.AddChecklist(project.ID, "Tasks", "write", "ship")
+	cl.CheckItems[0].State = "complete"
+	retention = RetentionPolicy{DoneAge: 30 * 24 * time.Hour}
+	t.Cleanup(func() { retention = RetentionPolicy{} })
+
+	movedToDone := func(name string, ago time.Duration) *FakeCard {
+		c := fake.AddCard(board.Done.ID, name)
+		a := fake.addAction(c, "updateCard", "idList", map[string]interface{}{})
+		a.Date = time.Now().Add(-ago)
+		return c
+	}
+	write := movedToDone("write", 40*24*time.Hour)
+	state.Link(cl.CheckItems[0].ID, write.ID)
+	movedToDone("ship", 40*24*time.Hour)
+	movedToDone("old", 40*24*time.Hour)
+	movedToDone("recent", 24*time.Hour)
+	// Its move to Done is too old for Trello to have.
+	fake.AddCard(board.Done.ID, "ancient")
+
+	plan, err := PlanRetention()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived []string
+	for _, c := range plan.Changes {
+		archived = append(archived, c.Card)
+	}
+	if want := []string{"old"}; !reflect.DeepEqual(archived, want) {
+		t.Errorf("archived %q, want %q", archived, want)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// maxRetries is how many times a failed Trello request is retried, 0 to never retry.
+var maxRetries int
+
+// retryBase is how long the first retry waits, doubling for each one after.
+var retryBase time.Duration
+
+// maxRetryWait caps the wait between retries.
+const maxRetryWait = 30 * time.Second
+
+// retryTransport retries Trello requests that fail with a network error, a rate limit, or a server error,
+// waiting a jittered exponential backoff between tries.
+// A POST isn't idempotent, since a timeout may come after Trello made the card or item, so it's only retried
+// when Trello couldn't have acted on it: on a rate limit, or when the connection was never made.
+// A single flaky request would otherwise abort a whole activation or setup halfway through.
+// Like countingTransport, installing it with useTrelloTransport covers both trel and apiDo.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(r.URL.String(), trel.API_PREFIX) {
+		return t.next.RoundTrip(r)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(r)
+		if attempt >= maxRetries || !transient(r.Method, resp, err) {
+			return resp, err
+		}
+		if r.Body != nil {
+			if r.GetBody == nil {
+				// The body was used up and can't be sent again.
+				return resp, err
+			}
+			body, bodyErr := r.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			r.Body = body
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		wait := Backoff(attempt)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			// throttleTransport holds every request until Trello is ready again, so this one waits for that too.
+			wait = 0
+		}
+		logger.Printf("Retrying %s %s in %s after %s\n", r.Method, r.URL.Path, wait, transientReason(resp, err))
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+// transient reports whether a request with the method is worth trying again.
+func transient(method string, resp *http.Response, err error) bool {
+	if method == http.MethodPost {
+		return unsent(err) || (err == nil && resp.StatusCode == http.StatusTooManyRequests)
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// unsent reports whether a request failed before it was sent, because the connection couldn't be made.
+func unsent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func transientReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// Backoff is how long to wait before a retry, doubling from retryBase for each attempt,
+// with jitter so several failed requests don't all retry at once.
+func Backoff(attempt int) time.Duration {
+	wait := retryBase << uint(attempt)
+	if wait <= 0 || wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	// Wait somewhere between half and all of it.
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
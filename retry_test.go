@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// failOnce fails the first request it's sent with resp or err, and answers the rest with 200.
+type failOnce struct {
+	status int
+	err    error
+	sent   int
+}
+
+func (f *failOnce) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.sent++
+	status := http.StatusOK
+	if f.sent == 1 {
+		if f.err != nil {
+			return nil, f.err
+		}
+		status = f.status
+	}
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+// TestRetryTransport checks which failures are retried, and that a POST Trello may have acted on is sent once.
+func TestRetryTransport(t *testing.T) {
+	oldRetries, oldBase := maxRetries, retryBase
+	t.Cleanup(func() { maxRetries, retryBase = oldRetries, oldBase })
+	maxRetries, retryBase = 3, time.Millisecond
+
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("i/o timeout")}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		method string
+		status int
+		err    error
+		sent   int
+	}{
+		{http.MethodGet, http.StatusBadGateway, nil, 2},
+		{http.MethodGet, 0, timeout, 2},
+		{http.MethodPut, http.StatusServiceUnavailable, nil, 2},
+		{http.MethodDelete, http.StatusTooManyRequests, nil, 2},
+		{http.MethodPost, http.StatusBadGateway, nil, 1},
+		{http.MethodPost, 0, timeout, 1},
+		{http.MethodPost, http.StatusTooManyRequests, nil, 2},
+		{http.MethodPost, 0, refused, 2},
+		{http.MethodPost, http.StatusBadRequest, nil, 1},
+	}
+	for _, tt := range tests {
+		next := &failOnce{status: tt.status, err: tt.err}
+		r, err := http.NewRequest(tt.method, trel.API_PREFIX+"cards", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		retryTransport{next: next}.RoundTrip(r)
+		if next.sent != tt.sent {
+			t.Errorf("%s failing with %d %v was sent %d times, want %d", tt.method, tt.status, tt.err, next.sent, tt.sent)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trello adds fields to its payloads over time. They are ignored when parsing,
+// but the fields the watcher doesn't know about are counted here so they can be noticed.
+var schemaReport = &SchemaReport{fields: map[string]*UnknownField{}}
+
+type UnknownField struct {
+	Payload   string    `json:"payload"`
+	Path      string    `json:"path"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	Example   string    `json:"example,omitempty"`
+}
+
+type SchemaReport struct {
+	mu     sync.Mutex
+	fields map[string]*UnknownField
+}
+
+// ParsePayload parses a webhook body into v, which must be a pointer.
+// A field whose type changed is recorded and left empty rather than failing the whole payload,
+// since the rest of it is usually still enough to act on.
+func ParsePayload(body []byte, v interface{}) error {
+	err := json.Unmarshal(body, v)
+	if te, ok := err.(*json.UnmarshalTypeError); ok {
+		schemaReport.record(reflect.TypeOf(v).Elem().Name(), te.Field+" (was "+te.Type.String()+", now "+te.Value+")", nil)
+		return nil
+	}
+	return err
+}
+
+// Check records the fields in body that v, the struct it was parsed into, doesn't have.
+func (sr *SchemaReport) Check(body []byte, v interface{}) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return
+	}
+	t := reflect.TypeOf(v)
+	unknown := map[string]interface{}{}
+	unknownFields(data, t, "", unknown)
+
+	for path, value := range unknown {
+		sr.record(t.Name(), path, value)
+	}
+}
+
+func (sr *SchemaReport) record(payload, path string, value interface{}) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	key := payload + " " + path
+	f, ok := sr.fields[key]
+	if !ok {
+		var example []byte
+		if value != nil {
+			example, _ = json.Marshal(value)
+			if len(example) > 100 {
+				example = append(example[:97], "..."...)
+			}
+		}
+		f = &UnknownField{Payload: payload, Path: path, FirstSeen: time.Now(), Example: string(example)}
+		sr.fields[key] = f
+		logger.Printf("New field in %s payloads: %s\n", payload, path)
+	}
+	f.Count++
+}
+
+// Fields returns every unknown field seen, sorted by payload and path.
+func (sr *SchemaReport) Fields() []UnknownField {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	var out []UnknownField
+	for _, f := range sr.fields {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Payload != out[j].Payload {
+			return out[i].Payload < out[j].Payload
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// unknownFields walks data alongside the struct type t, adding the path of every object key t has no field for.
+// Only objects t models are walked, so an unknown object is reported once rather than key by key.
+func unknownFields(data interface{}, t reflect.Type, prefix string, unknown map[string]interface{}) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		known := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			known[strings.ToLower(name)] = f.Type
+		}
+		for key, value := range d {
+			ft, ok := known[strings.ToLower(key)]
+			if !ok {
+				unknown[prefix+key] = value
+				continue
+			}
+			unknownFields(value, ft, prefix+key+".", unknown)
+		}
+	case []interface{}:
+		for _, value := range d {
+			unknownFields(value, t, prefix, unknown)
+		}
+	}
+}
+
+// schemaAPI serves the unknown fields seen in webhook payloads.
+func schemaAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(schemaReport.Fields()); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shadowable are the features that plan their changes, so they can run in shadow mode.
+var shadowable = []string{"activate-project", "store-project", "inbox-triage", "done-archive", "retention", "label-sync"}
+
+// shadowFeatures are the features that only log what they would do, instead of doing it.
+var shadowFeatures = map[string]bool{}
+
+// maxShadowRuns is how many shadow runs are kept for the report.
+const maxShadowRuns = 100
+
+var shadowRuns struct {
+	sync.Mutex
+	runs []ShadowRun
+}
+
+// A ShadowRun is a plan a shadowed feature made and didn't apply.
+type ShadowRun struct {
+	Time  time.Time `json:"time"`
+	Board string    `json:"board"`
+	Plan  Plan      `json:"plan"`
+}
+
+// SetShadowFeatures parses a comma separated list of features to shadow.
+func SetShadowFeatures(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		ok := false
+		for _, s := range shadowable {
+			if s == name {
+				ok = true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unable to shadow %q, it must be one of %q", name, shadowable)
+		}
+		shadowFeatures[name] = true
+	}
+	return nil
+}
+
+// Shadow reports whether a plan's feature is in shadow mode, or every feature is because of -dry-run.
+// If it is, the plan is logged and kept for the shadow report, and must not be applied.
+func Shadow(p Plan) bool {
+	if !dryRun && !shadowFeatures[p.Feature] {
+		return false
+	}
+	mode := "Shadow " + p.Feature
+	if dryRun {
+		mode = "Dry run " + p.Operation
+	}
+	for _, c := range p.Changes {
+		if c.To != "" {
+			logger.Printf("%s: would %s %q to %s\n", mode, c.Op, c.Card, c.To)
+		} else {
+			logger.Printf("%s: would %s %q\n", mode, c.Op, c.Card)
+		}
+	}
+	if !dryRun {
+		usage.Record("shadow:" + p.Feature)
+	}
+
+	shadowRuns.Lock()
+	defer shadowRuns.Unlock()
+	shadowRuns.runs = append(shadowRuns.runs, ShadowRun{Time: Now(), Board: board.ID, Plan: p})
+	if len(shadowRuns.runs) > maxShadowRuns {
+		shadowRuns.runs = shadowRuns.runs[len(shadowRuns.runs)-maxShadowRuns:]
+	}
+	return true
+}
+
+// ShadowChange is a change a shadowed feature wanted to make,
+// and whether the board ended up that way anyway.
+type ShadowChange struct {
+	Change
+	// Diverged is true when the card isn't where the change would have put it.
+	Diverged bool `json:"diverged"`
+}
+
+type ShadowReport struct {
+	Time      time.Time      `json:"time"`
+	Feature   string         `json:"feature"`
+	Operation string         `json:"operation"`
+	Changes   []ShadowChange `json:"changes"`
+}
+
+// BuildShadowReport compares each of the board's shadow runs' changes against the board as it is now.
+func BuildShadowReport() ([]ShadowReport, error) {
+	shadowRuns.Lock()
+	runs := append([]ShadowRun(nil), shadowRuns.runs...)
+	shadowRuns.Unlock()
+
+	var reports []ShadowReport
+	for _, run := range runs {
+		if run.Board != board.ID {
+			continue
+		}
+		r := ShadowReport{Time: run.Time, Feature: run.Plan.Feature, Operation: run.Plan.Operation}
+		for _, c := range run.Plan.Changes {
+			diverged, err := changeDiverged(c)
+			if err != nil {
+				return nil, err
+			}
+			r.Changes = append(r.Changes, ShadowChange{Change: c, Diverged: diverged})
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// changeDiverged reports whether a card change's result is missing from the board.
+// Changes that aren't to a card's list, like webhook changes, never diverge.
+func changeDiverged(c Change) (bool, error) {
+	if c.Op != "move" && c.Op != "create" {
+		return false, nil
+	}
+	l, err := FindBoardList(c.To)
+	if err != nil {
+		return true, nil
+	}
+	cards, err := AllCards(l)
+	if err != nil {
+		return false, err
+	}
+	for _, card := range cards {
+		if card.Name == c.Card {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// shadowAPI serves GET /api/shadow, the shadow report.
+func shadowAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	reports, err := BuildShadowReport()
+	if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		logger.Println(err)
+	}
+}
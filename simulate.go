@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ifo/trel"
+)
+
+// Simulation is a hypothetical event: either a card moving between lists,
+// or a checklist item on an Active card changing state.
+type Simulation struct {
+	Card string `json:"card"`
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	CheckItem string `json:"checkItem"`
+	State     string `json:"state"` // "complete" or "incomplete"
+}
+
+// Plan works out what the watcher would do if the event happened.
+func (s Simulation) Plan() (Plan, error) {
+	if s.CheckItem != "" {
+		var cic CheckItemChange
+		cic.Action.Type = "updateCheckItemStateOnCard"
+		cic.Action.Data.CheckItem.Name = s.CheckItem
+		cic.Action.Data.CheckItem.State = s.State
+		return cic.Plan()
+	}
+
+	from, err := FindBoardList(s.From)
+	if err != nil {
+		return Plan{}, err
+	}
+	to, err := FindBoardList(s.To)
+	if err != nil {
+		return Plan{}, err
+	}
+	card, err := FindListCard(from, s.Card)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	var lc ListChange
+	lc.Action.Type = "updateCard"
+	lc.Action.Data.Card.ID = card.ID
+	lc.Action.Data.Card.Name = card.Name
+	lc.Action.Data.ListBefore.ID = from.ID
+	lc.Action.Data.ListBefore.Name = from.Name
+	lc.Action.Data.ListAfter.ID = to.ID
+	lc.Action.Data.ListAfter.Name = to.Name
+	return lc.Plan()
+}
+
+// simulateAPI serves POST /api/simulate, which takes a Simulation
+// and returns the plan the watcher would apply, without applying it.
+func simulateAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	var s Simulation
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.CheckItem == "" && (s.Card == "" || s.From == "" || s.To == "") {
+		http.Error(w, "either card, from, and to, or checkItem and state are required", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := s.Plan()
+	if _, ok := err.(trel.NotFoundError); ok {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if _, ok := err.(AmbiguousError); ok {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.Println(err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FakeTrello is an in-memory Trello, which -record saves snapshots of the boards as.
+// The part that answers the watcher's requests from it is in fake.go, which -tags noreplay leaves out.
+// The replay command runs against one loaded from a snapshot, and tests build theirs
+// with the helpers in fake_test.go.
+type FakeTrello struct {
+	mu sync.Mutex
+
+	// MemberID is the token's member, who makes every change.
+	MemberID   string           `json:"memberId"`
+	Boards     []*FakeBoard     `json:"boards"`
+	Lists      []*FakeList      `json:"lists"`
+	Cards      []*FakeCard      `json:"cards"`
+	Checklists []*FakeChecklist `json:"checklists"`
+	Labels     []*FakeLabel     `json:"labels"`
+	Webhooks   []*FakeWebhook   `json:"webhooks"`
+	Actions    []*FakeAction    `json:"actions"`
+
+	// Calls are the requests that changed something, oldest first.
+	Calls []FakeCall `json:"-"`
+
+	lastID int
+}
+
+type FakeBoard struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Closed bool   `json:"closed,omitempty"`
+}
+
+type FakeList struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Closed  bool    `json:"closed"`
+	IDBoard string  `json:"idBoard"`
+	Pos     float64 `json:"pos"`
+}
+
+type FakeCard struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Closed       bool       `json:"closed"`
+	Desc         string     `json:"desc"`
+	IDBoard      string     `json:"idBoard"`
+	IDList       string     `json:"idList"`
+	IDChecklists []string   `json:"idChecklists"`
+	IDMembers    []string   `json:"idMembers"`
+	IDLabels     []string   `json:"idLabels"`
+	Due          *time.Time `json:"due"`
+	// Labels are filled in from IDLabels when a card is sent, like Trello does.
+	Labels           []*FakeLabel   `json:"labels,omitempty"`
+	Stickers         []*FakeSticker `json:"stickers,omitempty"`
+	DateLastActivity time.Time      `json:"dateLastActivity"`
+	URL              string         `json:"url"`
+	Pos              float64        `json:"pos"`
+}
+
+type FakeChecklist struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name"`
+	IDBoard    string           `json:"idBoard"`
+	IDCard     string           `json:"idCard"`
+	Pos        float64          `json:"pos"`
+	CheckItems []*FakeCheckItem `json:"checkItems"`
+}
+
+type FakeCheckItem struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	IDChecklist string     `json:"idChecklist"`
+	Due         *time.Time `json:"due"`
+	IDMember    string     `json:"idMember"`
+	Pos         float64    `json:"pos"`
+}
+
+type FakeLabel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Color   string `json:"color"`
+	IDBoard string `json:"idBoard"`
+}
+
+type FakeSticker struct {
+	ID    string `json:"id"`
+	Image string `json:"image"`
+}
+
+type FakeWebhook struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	IDModel     string `json:"idModel"`
+	CallbackURL string `json:"callbackURL"`
+	Active      bool   `json:"active"`
+}
+
+// FakeAction is a change recorded the way Trello records actions, for the card action and board action endpoints.
+type FakeAction struct {
+	ID              string                 `json:"id"`
+	Type            string                 `json:"type"`
+	Date            time.Time              `json:"date"`
+	IDMemberCreator string                 `json:"idMemberCreator"`
+	Data            map[string]interface{} `json:"data"`
+
+	// Field is the card field an updateCard changed, which filters like "updateCard:idList" match.
+	Field string `json:"-"`
+	board string
+	card  string
+}
+
+// FakeCall is a request that changed the fake, like "PUT cards/{id}" with its parameters.
+type FakeCall struct {
+	Method string
+	Path   string
+	Params url.Values
+}
+
+func (c FakeCall) String() string {
+	params := url.Values{}
+	for k, v := range c.Params {
+		if k != "key" && k != "token" {
+			params[k] = v
+		}
+	}
+	return fmt.Sprintf("%s %s %s", c.Method, c.Path, params.Encode())
+}
+
+// NewFakeTrello makes an empty fake.
+func NewFakeTrello() *FakeTrello {
+	f := &FakeTrello{}
+	f.MemberID = f.newID()
+	return f
+}
+
+// LoadFakeTrello reads a fake saved with Save, or a snapshot of real boards.
+func LoadFakeTrello(path string) (*FakeTrello, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &FakeTrello{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, err
+	}
+
+	// New IDs carry on from the fake's own, and are too small to ever be a real one.
+	for _, id := range f.ids() {
+		if n, err := strconv.ParseInt(id, 16, 64); err == nil && int(n) > f.lastID {
+			f.lastID = int(n)
+		}
+	}
+	for _, a := range f.Actions {
+		a.card, a.board = fakeDataID(a.Data, "card"), fakeDataID(a.Data, "board")
+	}
+	return f, nil
+}
+
+// Save writes the fake as JSON, which LoadFakeTrello reads.
+func (f *FakeTrello) Save(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// ids lists the ID of everything in the fake.
+func (f *FakeTrello) ids() []string {
+	ids := []string{f.MemberID}
+	for _, b := range f.Boards {
+		ids = append(ids, b.ID)
+	}
+	for _, l := range f.Lists {
+		ids = append(ids, l.ID)
+	}
+	for _, c := range f.Cards {
+		ids = append(ids, c.ID)
+	}
+	for _, cl := range f.Checklists {
+		ids = append(ids, cl.ID)
+		for _, ci := range cl.CheckItems {
+			ids = append(ids, ci.ID)
+		}
+	}
+	for _, l := range f.Labels {
+		ids = append(ids, l.ID)
+	}
+	for _, wh := range f.Webhooks {
+		ids = append(ids, wh.ID)
+	}
+	for _, a := range f.Actions {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+// fakeDataID is the ID of an action's card or board, from data read back from JSON.
+func fakeDataID(data map[string]interface{}, key string) string {
+	obj, _ := data[key].(map[string]interface{})
+	id, _ := obj["id"].(string)
+	return id
+}
+
+// newID makes an ID shaped like Trello's.
+func (f *FakeTrello) newID() string {
+	f.lastID++
+	return fmt.Sprintf("%024x", f.lastID)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// sortToDo is what the To Do list is kept sorted by after every event, one of toDoSorts, empty to leave it as it is.
+var sortToDo string
+
+// toDoSorts are what To Do can be sorted by.
+var toDoSorts = []string{"checklist", "due", "label", "name"}
+
+// priorityLabels are label names from most to least urgent, for sorting To Do by "label".
+var priorityLabels []string
+
+// ToDoLess reports whether one To Do card sorts before another for sortToDo.
+// Cards it can't tell apart keep the order they were in.
+func ToDoLess() (func(a, b CardInfo) bool, error) {
+	switch sortToDo {
+	case "due":
+		return func(a, b CardInfo) bool {
+			return a.Due != nil && (b.Due == nil || a.Due.Before(*b.Due))
+		}, nil
+	case "name":
+		return func(a, b CardInfo) bool {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}, nil
+	case "label":
+		var labels []Label
+		if err := apiDo(http.MethodGet, "boards/"+board.ID+"/labels", nil, &labels); err != nil {
+			return nil, err
+		}
+		priority := map[string]int{}
+		for _, l := range labels {
+			for i, name := range priorityLabels {
+				if strings.EqualFold(l.Name, name) {
+					priority[l.ID] = i + 1
+				}
+			}
+		}
+		rank := func(c CardInfo) int {
+			r := len(priorityLabels) + 1
+			for _, id := range c.IDLabels {
+				if p := priority[id]; p > 0 && p < r {
+					r = p
+				}
+			}
+			return r
+		}
+		return func(a, b CardInfo) bool { return rank(a) < rank(b) }, nil
+	case "checklist":
+		rank, err := checklistRanks()
+		if err != nil {
+			return nil, err
+		}
+		cardRank := func(c CardInfo) int {
+			if ciID, ok := state.TaskCheckItem(c.ID); ok {
+				if r, ok := rank[ciID]; ok {
+					return r
+				}
+			}
+			if r, ok := rank["name:"+c.Name]; ok {
+				return r
+			}
+			return len(rank)
+		}
+		return func(a, b CardInfo) bool { return cardRank(a) < cardRank(b) }, nil
+	}
+	return nil, fmt.Errorf("unable to sort by %q", sortToDo)
+}
+
+// checklistRanks numbers the checklist items of every Active project card in order, Active's top card first.
+// Each is numbered by ID, and by its task card's name, for cards that aren't linked to their item.
+func checklistRanks() (map[string]int, error) {
+	projects, err := board.Active.Cards()
+	if err != nil {
+		return nil, err
+	}
+	rank := map[string]int{}
+	n := 0
+	for _, project := range projects {
+		checklists, err := project.Checklists()
+		if err != nil {
+			return nil, err
+		}
+		for _, cl := range checklists {
+			for _, ci := range cl.CheckItems {
+				rank[ci.ID] = n
+				for _, name := range []string{ci.Name, TaskCardName(project.Name, ci.Name), ProjectName(project.Name) + ": " + ci.Name} {
+					if _, ok := rank["name:"+name]; !ok {
+						rank["name:"+name] = n
+					}
+				}
+				n++
+			}
+		}
+	}
+	return rank, nil
+}
+
+// PlanSortToDo works out which To Do cards need new positions for the list to be sorted by sortToDo.
+// The most cards that are already in order are left where they are, and the rest are put between them.
+func PlanSortToDo() (Plan, error) {
+	plan := Plan{Operation: fmt.Sprintf("sorting %s by %s", board.ToDo.Name, sortToDo), Feature: "todo-sort"}
+	cards, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return plan, err
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].Pos < cards[j].Pos })
+	less, err := ToDoLess()
+	if err != nil {
+		return plan, err
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return less(cards[i], cards[j]) })
+
+	keep := increasingPositions(cards)
+	prev := 0.0
+	for i := range cards {
+		if keep[i] {
+			prev = cards[i].Pos
+			continue
+		}
+		next := prev + 2*65536
+		for j := i + 1; j < len(cards); j++ {
+			if keep[j] {
+				next = cards[j].Pos
+				break
+			}
+		}
+		c := trel.Card{ID: cards[i].ID, Name: cards[i].Name}
+		pos := (prev + next) / 2
+		plan.Position(&c, board.ToDo, pos)
+		prev = pos
+	}
+	return plan, nil
+}
+
+// increasingPositions picks the longest run of cards, not necessarily next to each other, whose positions already increase.
+func increasingPositions(cards []CardInfo) []bool {
+	// tails[k] is the index of the card ending the best run of length k+1 found so far.
+	var tails []int
+	prev := make([]int, len(cards))
+	for i, c := range cards {
+		k := sort.Search(len(tails), func(k int) bool { return cards[tails[k]].Pos >= c.Pos })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	keep := make([]bool, len(cards))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+func (p *Plan) Position(c *trel.Card, on trel.List, pos float64) {
+	p.Changes = append(p.Changes, Change{
+		Op: "position", Card: c.Name, To: on.Name,
+		apply: func() error { return PositionCard(c, pos) },
+	})
+}
+
+// PositionCard moves a card to a position on its list.
+func PositionCard(c *trel.Card, pos float64) error {
+	params := url.Values{"pos": {strconv.FormatFloat(pos, 'f', -1, 64)}}
+	return apiDo(http.MethodPut, "cards/"+c.ID, params, nil)
+}
+
+// SortToDoAfterEvents sorts To Do by sortToDo after every Event that was handled, since any of them can change it.
+// A failed sort is logged, but doesn't fail the Event.
+func SortToDoAfterEvents(next EventHandler) EventHandler {
+	return func(e Event) error {
+		err := next(e)
+		if err != nil || sortToDo == "" {
+			return err
+		}
+		plan, serr := PlanSortToDo()
+		if serr == nil {
+			serr = RunPlan(plan)
+		}
+		if serr != nil {
+			logger.Printf("Unable to sort %s: %s\n", board.ToDo.Name, serr)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// staleAfter is how long a card can sit in To Do without moving before it is nudged about, 0 to not nudge.
+var staleAfter time.Duration
+
+// staleInterval is how often To Do is checked for stale cards.
+var staleInterval time.Duration
+
+// staleLabel is the label stale cards get, empty to only comment on them.
+var staleLabel string
+
+// StaleLabel finds the -stale-label on the board, making it if it is missing, and returns its ID.
+func StaleLabel() (string, error) {
+	var labels []Label
+	if err := apiDo(http.MethodGet, "boards/"+board.ID+"/labels", nil, &labels); err != nil {
+		return "", err
+	}
+	for _, l := range labels {
+		if l.Name == staleLabel {
+			return l.ID, nil
+		}
+	}
+	var l Label
+	params := url.Values{"name": {staleLabel}, "color": {"red"}, "idBoard": {board.ID}}
+	if err := apiDo(http.MethodPost, "labels", params, &l); err != nil {
+		return "", err
+	}
+	return l.ID, nil
+}
+
+// NudgeStaleCards comments on each To Do card that hasn't moved in staleAfter, and gives it the -stale-label.
+// A card is nudged once each time it sits in To Do too long, and the label comes off once it is done.
+// It returns the IDs of the cards in To Do, whose nudges are kept.
+func NudgeStaleCards() (map[string]bool, error) {
+	labelID := ""
+	if staleLabel != "" {
+		id, err := StaleLabel()
+		if err != nil {
+			return nil, err
+		}
+		labelID = id
+	}
+
+	cards, err := ListCardInfo(board.ToDo.ID)
+	if err != nil {
+		return nil, err
+	}
+	todo := map[string]bool{}
+	for _, c := range cards {
+		todo[c.ID] = true
+		since, err := InListSince(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		age := time.Since(since)
+		if age < staleAfter || state.Nudged(c.ID, since) {
+			continue
+		}
+
+		msg := fmt.Sprintf("This has been in %s for a while, is it still the next thing to do?", board.ToDo.Name)
+		if !since.IsZero() {
+			if age = age.Truncate(time.Minute); age >= 24*time.Hour {
+				age = age.Truncate(24 * time.Hour)
+			}
+			msg = fmt.Sprintf("This has been in %s for %s, is it still the next thing to do?", board.ToDo.Name, leadName(age))
+		}
+		if err := Comment(c.ID, msg); err != nil {
+			return nil, err
+		}
+		if labelID != "" && !hasLabel(c.IDLabels, labelID) {
+			if err := LabelCard(c.ID, labelID, staleLabel); err != nil {
+				return nil, err
+			}
+		}
+		state.Nudge(c.ID, since)
+		logger.Printf("Nudged about %q, it has been in %s too long\n", c.Name, board.ToDo.Name)
+		usage.Record("stale-nudge")
+	}
+
+	if labelID == "" {
+		return todo, nil
+	}
+	for _, l := range board.DoneLists() {
+		done, err := ListCardInfo(l.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range done {
+			if hasLabel(c.IDLabels, labelID) {
+				if err := UnlabelCard(c.ID, labelID, staleLabel); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return todo, nil
+}
+
+// hasLabel reports whether a label is among a card's label IDs.
+func hasLabel(ids []string, labelID string) bool {
+	for _, id := range ids {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+// RunStaleNudges nudges about stale To Do cards every staleInterval.
+func RunStaleNudges() {
+	for range Schedule(staleInterval) {
+		if Paused() {
+			continue
+		}
+		todo, ok := map[string]bool{}, true
+		ForEachBoard(func() error {
+			ids, err := NudgeStaleCards()
+			if err != nil {
+				ok = false
+				return fmt.Errorf("unable to nudge about stale cards: %s", err)
+			}
+			for id := range ids {
+				todo[id] = true
+			}
+			return nil
+		})
+		// A board that couldn't be checked would lose its nudges and get them again.
+		if ok {
+			state.PruneNudges(todo)
+		}
+	}
+}
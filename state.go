@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// stateFile is where the watcher keeps what it can't get back by matching names,
+// the webhooks it made and which task card belongs to which checklist item.
+var stateFile string
+
+var state = &State{Webhooks: map[string]OwnedWebhook{}, Tasks: map[string]string{}, LastActions: map[string]string{}, Lists: map[string]string{}, Reminders: map[string]time.Time{}, Nudges: map[string]time.Time{}, Writes: map[string][]time.Time{}}
+
+// OwnedWebhook is a webhook the watcher made.
+type OwnedWebhook struct {
+	Type    string    `json:"type"` // "list" or "card"
+	Model   string    `json:"model"`
+	Board   string    `json:"board"`
+	Created time.Time `json:"created"`
+}
+
+type State struct {
+	mu sync.Mutex
+	// Webhooks are the webhooks the watcher made, by webhook ID.
+	Webhooks map[string]OwnedWebhook `json:"webhooks"`
+	// Tasks are task card IDs, by the ID of the checklist item they are for.
+	Tasks map[string]string `json:"tasks"`
+	// LastActions are the IDs of the latest action seen on each board, by board ID,
+	// so the actions missed while the watcher was down can be caught up on.
+	LastActions map[string]string `json:"lastActions"`
+	// Lists are the IDs of the lists last found for each role, by board ID and role,
+	// so a list that was renamed on Trello still fills its role.
+	Lists map[string]string `json:"lists"`
+	// Reminders are the due dates reminded about, by card ID and how long before the due date,
+	// so a restart doesn't remind again, and a new due date does.
+	Reminders map[string]time.Time `json:"reminders"`
+	// Nudges are when each stale To Do card got there, by card ID, once it has been nudged about it,
+	// so it is nudged once each time it sits in To Do too long.
+	Nudges map[string]time.Time `json:"nudges"`
+	// Writes are when the watcher changed each card or checklist, by its ID and the type of action Trello records,
+	// until the action is read, so polling and catching up can skip the watcher's own actions.
+	Writes map[string][]time.Time `json:"writes"`
+}
+
+// LoadState reads the state from stateFile, if it exists.
+func LoadState() error {
+	b, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return json.Unmarshal(b, state)
+}
+
+// save writes the state to stateFile. The caller must hold s.mu.
+func (s *State) save() {
+	// A dry run didn't really make webhooks or handle actions, so a real run mustn't think it did.
+	if stateFile == "" || dryRun {
+		return
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = writeFileReplacing(stateFile, b)
+	}
+	if err != nil {
+		logger.Printf("Unable to save state to %s: %s\n", stateFile, err)
+	}
+}
+
+// OwnWebhook records a webhook the watcher made.
+func (s *State) OwnWebhook(wh trel.Webhook, typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Webhooks[wh.ID] = OwnedWebhook{Type: typ, Model: wh.IDModel, Board: board.ID, Created: time.Now()}
+	s.save()
+}
+
+// DisownWebhook forgets a webhook that was deleted.
+func (s *State) DisownWebhook(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Webhooks, id)
+	s.save()
+}
+
+// OwnsWebhook reports whether the watcher made a webhook.
+func (s *State) OwnsWebhook(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Webhooks[id]
+	return ok
+}
+
+// PruneWebhooks forgets owned webhooks that no longer exist on Trello.
+func (s *State) PruneWebhooks(existing trel.Webhooks) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := map[string]bool{}
+	for _, wh := range existing {
+		ids[wh.ID] = true
+	}
+	for id := range s.Webhooks {
+		if !ids[id] {
+			delete(s.Webhooks, id)
+		}
+	}
+	s.save()
+}
+
+// Link records that a card is the task card for a checklist item.
+func (s *State) Link(checkItemID, cardID string) {
+	if checkItemID == "" || cardID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Tasks[checkItemID] == cardID {
+		return
+	}
+	s.Tasks[checkItemID] = cardID
+	s.save()
+}
+
+// Unlink forgets a checklist item's task card, once the card is gone.
+func (s *State) Unlink(checkItemID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Tasks[checkItemID]; !ok {
+		return
+	}
+	delete(s.Tasks, checkItemID)
+	s.save()
+}
+
+// TaskCard is the ID of the task card for a checklist item, if it is known.
+func (s *State) TaskCard(checkItemID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.Tasks[checkItemID]
+	return id, ok
+}
+
+// TaskCheckItem is the ID of the checklist item a task card is for, if it is known.
+func (s *State) TaskCheckItem(cardID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ciID, id := range s.Tasks {
+		if id == cardID {
+			return ciID, true
+		}
+	}
+	return "", false
+}
+
+// SeeAction records an action on a board, if it is later than the last one seen.
+// Action IDs start with when they were made, so later actions sort after earlier ones.
+func (s *State) SeeAction(boardID, actionID string) {
+	if actionID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if actionID <= s.LastActions[boardID] {
+		return
+	}
+	s.LastActions[boardID] = actionID
+	s.save()
+}
+
+// LastAction is the ID of the latest action seen on a board, or "" if none has been.
+func (s *State) LastAction(boardID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.LastActions[boardID]
+}
+
+// RememberList records the list found for a role on a board.
+func (s *State) RememberList(boardID, role, listID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := boardID + "/" + role
+	if s.Lists[key] == listID {
+		return
+	}
+	s.Lists[key] = listID
+	s.save()
+}
+
+// RememberedList is the ID of the list last found for a role on a board, or "" if none has been.
+func (s *State) RememberedList(boardID, role string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Lists[boardID+"/"+role]
+}
+
+// Remind records a reminder sent lead before a card's due date.
+func (s *State) Remind(cardID string, lead time.Duration, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reminders[cardID+"/"+lead.String()] = due
+	s.save()
+}
+
+// Reminded reports whether a reminder was sent lead before a card's due date.
+func (s *State) Reminded(cardID string, lead time.Duration, due time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent, ok := s.Reminders[cardID+"/"+lead.String()]
+	return ok && sent.Equal(due)
+}
+
+// PruneReminders forgets reminders for due dates before a time, which can't be reminded about again.
+func (s *State) PruneReminders(before time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := false
+	for key, due := range s.Reminders {
+		if due.Before(before) {
+			delete(s.Reminders, key)
+			pruned = true
+		}
+	}
+	if pruned {
+		s.save()
+	}
+}
+
+// Nudge records that a card in To Do since a time was nudged about it.
+func (s *State) Nudge(cardID string, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Nudges[cardID] = since
+	s.save()
+}
+
+// Nudged reports whether a card in To Do since a time was already nudged about it.
+func (s *State) Nudged(cardID string, since time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nudged, ok := s.Nudges[cardID]
+	return ok && nudged.Equal(since)
+}
+
+// PruneNudges forgets the nudges for cards that aren't in To Do anymore.
+func (s *State) PruneNudges(todo map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := false
+	for id := range s.Nudges {
+		if !todo[id] {
+			delete(s.Nudges, id)
+			pruned = true
+		}
+	}
+	if pruned {
+		s.save()
+	}
+}
+
+// Wrote records a change the watcher made, which Trello records as an action of a type on a card or checklist.
+// Writes whose actions were never read are dropped after ownWriteAge.
+func (s *State) Wrote(id, actionType string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, times := range s.Writes {
+		var kept []time.Time
+		for _, t := range times {
+			if at.Sub(t) < ownWriteAge {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.Writes, key)
+		} else {
+			s.Writes[key] = kept
+		}
+	}
+	key := id + "/" + actionType
+	s.Writes[key] = append(s.Writes[key], at)
+	s.save()
+}
+
+// OwnAction reports whether an action made at a time, on a card or checklist with one of the IDs, is one of the watcher's writes.
+// Each write matches one action, so the same change made by someone else afterwards is still handled.
+func (s *State) OwnAction(actionType string, at time.Time, ids ...string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		key := id + "/" + actionType
+		for i, t := range s.Writes[key] {
+			if d := at.Sub(t); d < -ownWriteSlack || d > ownWriteSlack {
+				continue
+			}
+			if s.Writes[key] = append(s.Writes[key][:i], s.Writes[key][i+1:]...); len(s.Writes[key]) == 0 {
+				delete(s.Writes, key)
+			}
+			s.save()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// statsFile is where the daily counters are kept, so they survive restarts.
+var statsFile string
+
+// statsDays is how many days of daily counters are kept before they are rolled into their month.
+const statsDays = 90
+
+// statsSaveInterval limits how often the counters are written out, since API calls are counted too.
+const statsSaveInterval = time.Minute
+
+// The counters kept for each day.
+const (
+	statTasksCompleted = "tasks-completed"
+	statCardsCreated   = "cards-created"
+	statAPICalls       = "api-calls"
+	statErrors         = "errors"
+	statRateLimited    = "rate-limited"
+	statThrottled      = "throttled"
+)
+
+var stats = &Stats{Daily: map[string]Counters{}, Monthly: map[string]Counters{}}
+
+type Counters map[string]int
+
+// Stats holds daily counters, keyed by "2006-01-02",
+// and the monthly rollups of days older than statsDays, keyed by "2006-01".
+type Stats struct {
+	mu      sync.Mutex
+	saved   time.Time
+	Daily   map[string]Counters `json:"daily"`
+	Monthly map[string]Counters `json:"monthly"`
+}
+
+// LoadStats reads the counters from statsFile, if it exists.
+func LoadStats() error {
+	b, err := ioutil.ReadFile(statsFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return json.Unmarshal(b, stats)
+}
+
+// Add counts one of something for today.
+func (s *Stats) Add(counter string) {
+	if statsFile == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := Now()
+	day := now.Format("2006-01-02")
+	if s.Daily[day] == nil {
+		s.Daily[day] = Counters{}
+		s.rollup(now)
+	}
+	s.Daily[day][counter]++
+
+	if now.Sub(s.saved) >= statsSaveInterval {
+		s.save()
+	}
+}
+
+// rollup moves days older than statsDays into their monthly counters.
+// The caller must hold s.mu.
+func (s *Stats) rollup(now time.Time) {
+	oldest := now.AddDate(0, 0, -statsDays).Format("2006-01-02")
+	for day, cs := range s.Daily {
+		if day >= oldest {
+			continue
+		}
+		month := day[:len("2006-01")]
+		if s.Monthly[month] == nil {
+			s.Monthly[month] = Counters{}
+		}
+		for name, n := range cs {
+			s.Monthly[month][name] += n
+		}
+		delete(s.Daily, day)
+	}
+}
+
+// Save writes the counters to statsFile.
+func (s *Stats) Save() {
+	if statsFile == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.save()
+}
+
+// save is Save for callers that hold s.mu.
+func (s *Stats) save() {
+	s.saved = time.Now()
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = writeFileReplacing(statsFile, b)
+	}
+	if err != nil {
+		logger.Printf("Unable to save stats to %s: %s\n", statsFile, err)
+	}
+}
+
+type StatsPeriod struct {
+	Period   string   `json:"period"`
+	Counters Counters `json:"counters"`
+}
+
+type StatsHistory struct {
+	Daily   []StatsPeriod `json:"daily"`
+	Monthly []StatsPeriod `json:"monthly"`
+}
+
+// History returns the daily counters, and the monthly totals including the days not yet rolled up, oldest first.
+func (s *Stats) History() StatsHistory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monthly := map[string]Counters{}
+	add := func(month string, cs Counters) {
+		if monthly[month] == nil {
+			monthly[month] = Counters{}
+		}
+		for name, n := range cs {
+			monthly[month][name] += n
+		}
+	}
+	for month, cs := range s.Monthly {
+		add(month, cs)
+	}
+
+	var h StatsHistory
+	for day, cs := range s.Daily {
+		h.Daily = append(h.Daily, StatsPeriod{Period: day, Counters: cs})
+		add(day[:len("2006-01")], cs)
+	}
+	for month, cs := range monthly {
+		h.Monthly = append(h.Monthly, StatsPeriod{Period: month, Counters: cs})
+	}
+	sort.Slice(h.Daily, func(i, j int) bool { return h.Daily[i].Period < h.Daily[j].Period })
+	sort.Slice(h.Monthly, func(i, j int) bool { return h.Monthly[i].Period < h.Monthly[j].Period })
+	return h
+}
+
+// RecordStats counts every Event that fails.
+func RecordStats(next EventHandler) EventHandler {
+	return func(e Event) error {
+		err := next(e)
+		if err != nil {
+			stats.Add(statErrors)
+		}
+		return err
+	}
+}
+
+// countingTransport counts every request made through it.
+// Installing it with useTrelloTransport counts every Trello API call, from trel and apiDo alike.
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(r.URL.String(), trel.API_PREFIX) {
+		stats.Add(statAPICalls)
+	}
+	return t.next.RoundTrip(r)
+}
+
+// statsHistoryAPI serves GET /api/stats/history.
+func statsHistoryAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats.History()); err != nil {
+		logger.Println(err)
+	}
+}
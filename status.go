@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+var started = time.Now()
+
+// lastStartup is the startup report for each board, by board ID.
+var lastStartup = struct {
+	sync.Mutex
+	reports map[string]*StartupReport
+}{reports: map[string]*StartupReport{}}
+
+type StartupReport struct {
+	Time             time.Time         `json:"time"`
+	Board            string            `json:"board"`
+	Lists            map[string]string `json:"lists"` // List name to ID.
+	WebhooksCreated  int               `json:"webhooksCreated"`
+	WebhooksReused   int               `json:"webhooksReused"`
+	ProjectsSetup    int               `json:"projectsSetup"`
+	ProjectsFailed   int               `json:"projectsFailed"`
+	PendingApprovals int               `json:"pendingApprovals"`
+}
+
+type ShutdownReport struct {
+	Signal           string        `json:"signal"`
+	Uptime           time.Duration `json:"uptime"`
+	PendingApprovals int           `json:"pendingApprovals"`
+	ActiveWebhooks   int           `json:"activeWebhooks"`
+	InactiveWebhooks int           `json:"inactiveWebhooks"`
+	CleanedUp        int           `json:"cleanedUp"`
+}
+
+// cleanupOnExit is "deactivate" or "delete" to do that to the watcher's webhooks on shutdown, or empty to leave them.
+var cleanupOnExit string
+
+// IsWatcherWebhook reports whether the watcher made a webhook, or it calls back to one of hosts.
+func IsWatcherWebhook(wh trel.Webhook, hosts []string) bool {
+	if state.OwnsWebhook(wh.ID) {
+		return true
+	}
+	u, err := url.Parse(wh.CallbackURL)
+	if err != nil {
+		return false
+	}
+	for _, h := range hosts {
+		if h != "" && strings.EqualFold(u.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanupWebhooks deactivates or deletes the webhooks the watcher made, or with callbacks to one of hosts,
+// and returns the webhooks that are left and how many were cleaned up.
+func CleanupWebhooks(webhooks []trel.Webhook, hosts []string) ([]trel.Webhook, int) {
+	var left []trel.Webhook
+	cleaned := 0
+	for _, wh := range webhooks {
+		if !IsWatcherWebhook(wh, hosts) {
+			left = append(left, wh)
+			continue
+		}
+		var err error
+		switch cleanupOnExit {
+		case "delete":
+			if err = wh.Delete(); err == nil {
+				state.DisownWebhook(wh.ID)
+			}
+		case "deactivate":
+			if wh.Active {
+				err = wh.Deactivate()
+			}
+		}
+		if err != nil {
+			logger.Printf("Unable to %s webhook %s: %s\n", cleanupOnExit, wh.Description, err)
+		} else {
+			cleaned++
+		}
+		if err != nil || cleanupOnExit == "deactivate" {
+			left = append(left, wh)
+		}
+	}
+	return left, cleaned
+}
+
+// Startup creates the webhooks and sets up each active project,
+// then logs and keeps a summary of what it did.
+func Startup() {
+	reused := len(board.Webhooks)
+	report := StartupReport{
+		Board: board.Name,
+		Lists: map[string]string{},
+	}
+	for _, l := range board.Lists() {
+		report.Lists[l.Name] = l.ID
+	}
+
+	SetupInitialWebhooks()
+	cards, err := board.Active.Cards()
+	if err != nil {
+		logger.Fatalf("Unable to fetch active cards: %s\n", err)
+	}
+	for _, card := range cards {
+		if err := SetupActiveProjectCard(card); err != nil {
+			logger.Printf("Unable to set up active project %q: %s\n", card.Name, err)
+			report.ProjectsFailed++
+			continue
+		}
+		report.ProjectsSetup++
+	}
+
+	report.Time = time.Now()
+	report.WebhooksReused = reused
+	report.WebhooksCreated = len(board.Webhooks) - reused
+	report.PendingApprovals = len(pending.List())
+
+	logger.Printf("Watching board %q: lists %v, %d webhooks created, %d reused, %d active projects set up, %d failed, %d plans pending approval\n",
+		report.Board, report.Lists, report.WebhooksCreated, report.WebhooksReused, report.ProjectsSetup, report.ProjectsFailed, report.PendingApprovals)
+
+	lastStartup.Lock()
+	lastStartup.reports[board.ID] = &report
+	lastStartup.Unlock()
+}
+
+// WaitForShutdown logs a summary of what is left behind when the process is told to stop, then exits.
+func WaitForShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	s := <-sig
+
+	report := ShutdownReport{
+		Signal:           s.String(),
+		Uptime:           time.Since(started),
+		PendingApprovals: len(pending.List()),
+	}
+	// Boards share the webhooks that existed at startup, so count each one once.
+	seen := map[string]bool{}
+	boardMu.Lock()
+	var webhooks []trel.Webhook
+	for _, b := range boards {
+		for _, wh := range b.Webhooks {
+			if !seen[wh.ID] {
+				seen[wh.ID] = true
+				webhooks = append(webhooks, wh)
+			}
+		}
+	}
+	// The lock is kept, so no event makes a webhook while they're being cleaned up.
+	defer boardMu.Unlock()
+	if cleanupOnExit != "" {
+		webhooks, report.CleanedUp = CleanupWebhooks(webhooks, []string{host})
+	}
+	for _, wh := range webhooks {
+		if wh.Active {
+			report.ActiveWebhooks++
+		} else {
+			report.InactiveWebhooks++
+		}
+	}
+	logger.Printf("Shutting down on %s after %s: %d plans pending approval were dropped, %d webhooks cleaned up, %d left active and %d inactive\n",
+		report.Signal, report.Uptime, report.PendingApprovals, report.CleanedUp, report.ActiveWebhooks, report.InactiveWebhooks)
+	stats.Save()
+	StopTunnel()
+	os.Exit(0)
+}
+
+// statusAPI serves the uptime and the last startup report.
+func statusAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lastStartup.Lock()
+	report := lastStartup.reports[board.ID]
+	lastStartup.Unlock()
+
+	status := struct {
+		Uptime    string         `json:"uptime"`
+		Timezone  string         `json:"timezone"`
+		WeekStart string         `json:"weekStart"`
+		Startup   *StartupReport `json:"startup"` // nil until startup finishes.
+		Pause     PauseStatus    `json:"pause"`
+		// LostAccess is why the watcher can't act on the board, if it can't.
+		LostAccess string `json:"lostAccess,omitempty"`
+		// RateLimit is how many Trello requests were sent in the last 10 seconds, out of the limit.
+		RateLimit struct {
+			Recent int `json:"recent"`
+			Limit  int `json:"limit"`
+		} `json:"rateLimit"`
+	}{
+		Uptime:    time.Since(started).String(),
+		Timezone:  location.String(),
+		WeekStart: weekStart.String(),
+		Startup:   report,
+		Pause:     pauseStatus(),
+	}
+	status.LostAccess, _ = AccessLost(board.ID)
+	status.RateLimit.Recent = limiter.Recent()
+	status.RateLimit.Limit = limiter.Limit
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ifo/trel"
+)
+
+// stickerInterval is how often project cards are checked for command stickers, 0 to not check.
+// Trello makes no action for a sticker, so they can't come in by webhook.
+var stickerInterval time.Duration
+
+// Sticker is a sticker on a card, where Image is the name of one of Trello's stickers, like "thumbsup".
+type Sticker struct {
+	ID    string `json:"id"`
+	Image string `json:"image"`
+}
+
+// stickerCard is a card with its stickers.
+type stickerCard struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Stickers []Sticker `json:"stickers"`
+}
+
+// listStickerCards fetches the open cards on a list with their stickers.
+func listStickerCards(listID string) ([]stickerCard, error) {
+	var cards []stickerCard
+	params := url.Values{"fields": {"name"}, "stickers": {"true"}}
+	err := apiDo(http.MethodGet, "lists/"+listID+"/cards", params, &cards)
+	return cards, err
+}
+
+// RemoveSticker takes a sticker off a card.
+func RemoveSticker(cardID, stickerID string) error {
+	return apiDo(http.MethodDelete, "cards/"+cardID+"/stickers/"+stickerID, nil, nil)
+}
+
+// HandleStickers acts on the command stickers on project cards, then takes each one off so it's acted on once:
+// a "thumbsup" on a Projects card activates it, and a "clock" on an Active card snoozes it back to Projects.
+func HandleStickers() error {
+	commands := []struct {
+		list  string
+		image string
+		run   func(*trel.Card) error
+	}{
+		{board.Projects.ID, "thumbsup", ActivateProject},
+		{board.Active.ID, "clock", StoreProject},
+	}
+	for _, cmd := range commands {
+		cards, err := listStickerCards(cmd.list)
+		if err != nil {
+			return err
+		}
+		for _, c := range cards {
+			for _, st := range c.Stickers {
+				if st.Image != cmd.image {
+					continue
+				}
+				logger.Printf("Acting on the %s sticker on %q\n", st.Image, c.Name)
+				card, err := trelClient.Card(c.ID)
+				if err != nil {
+					return err
+				}
+				if err := cmd.run(&card); err != nil {
+					return fmt.Errorf("unable to act on the %s sticker on %q: %s", st.Image, c.Name, err)
+				}
+				if err := RemoveSticker(c.ID, st.ID); err != nil {
+					return err
+				}
+				usage.Record("sticker-command")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// RunStickers acts on command stickers every stickerInterval.
+func RunStickers() {
+	for range Schedule(stickerInterval) {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(func() error {
+			if err := HandleStickers(); err != nil {
+				return fmt.Errorf("unable to act on stickers: %s", err)
+			}
+			return nil
+		})
+	}
+}
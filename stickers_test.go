@@ -0,0 +1,46 @@
+//go:build !noreplay
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestHandleStickers checks that command stickers move their project cards, and are taken off so they're acted on once.
+func TestHandleStickers(t *testing.T) {
+	fake, boardID := watchFake(t)
+	launch := fake.AddCard(fake.ListID(boardID, "Projects"), "Launch")
+	fake.AddChecklist(launch.ID, "Tasks", "write")
+	launch.Stickers = []*FakeSticker{{ID: "s1", Image: "thumbsup"}}
+	docs := fake.AddCard(fake.ListID(boardID, "Active"), "Docs")
+	fake.AddChecklist(docs.ID, "Tasks", "review")
+	docs.Stickers = []*FakeSticker{{ID: "s2", Image: "clock"}}
+	later := fake.AddCard(fake.ListID(boardID, "Projects"), "Later")
+	later.Stickers = []*FakeSticker{{ID: "s3", Image: "clock"}}
+
+	for i := 0; i < 2; i++ {
+		if err := HandleStickers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{board.Active.ID, []string{"Launch"}},
+		{board.Projects.ID, []string{"Later", "Docs"}},
+		{board.ToDo.ID, []string{"write"}},
+	}
+	for _, tt := range tests {
+		if got := fake.cardsOn(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %q, want %q", fake.list(tt.list).Name, got, tt.want)
+		}
+	}
+	if len(launch.Stickers) != 0 || len(docs.Stickers) != 0 {
+		t.Errorf("the command stickers weren't taken off")
+	}
+	if len(later.Stickers) != 1 {
+		t.Errorf("a sticker that isn't a command on its list was taken off")
+	}
+}
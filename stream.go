@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamHeartbeat is how often an idle event stream sends a comment, so proxies don't close it.
+const streamHeartbeat = 30 * time.Second
+
+// subscribers are the open event streams, each with a buffered channel.
+var subscribers = struct {
+	sync.Mutex
+	chans map[chan RecentEvent]bool
+}{chans: map[chan RecentEvent]bool{}}
+
+// Subscribe opens a stream of handled events. Call Unsubscribe with it when done.
+func Subscribe() chan RecentEvent {
+	c := make(chan RecentEvent, 16)
+	subscribers.Lock()
+	subscribers.chans[c] = true
+	subscribers.Unlock()
+	return c
+}
+
+func Unsubscribe(c chan RecentEvent) {
+	subscribers.Lock()
+	delete(subscribers.chans, c)
+	subscribers.Unlock()
+}
+
+// Publish sends a handled event to every stream.
+// A stream that has fallen behind misses it, rather than holding up the watcher.
+func Publish(e RecentEvent) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	for c := range subscribers.chans {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// eventsAPI streams every handled event as JSON server-sent events, only the board's with ?board=.
+func eventsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	boardID := r.URL.Query().Get("board")
+	if _, ok := FindBoard(boardID); boardID != "" && !ok {
+		http.Error(w, BoardNotFoundError(boardID).Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := Subscribe()
+	defer Unsubscribe(c)
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e := <-c:
+			if boardID != "" && e.Board != boardID {
+				continue
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				logger.Println(err)
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// summaryTime is when each day's summary is posted on Active project cards, like "21:30", empty to not post one.
+var summaryTime string
+
+// summaryPrefix starts every daily summary comment, which is how an earlier one from the same day is found.
+const summaryPrefix = "Today: "
+
+// DaySummary is what happened on a project card's checklists since the start of the day.
+type DaySummary struct {
+	Completed int
+	Added     int
+	Remaining int
+}
+
+func (s DaySummary) String() string {
+	return fmt.Sprintf("%scompleted %d, added %d, remaining %d", summaryPrefix, s.Completed, s.Added, s.Remaining)
+}
+
+// cardAction is the part of a Trello action the summary needs.
+type cardAction struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Date time.Time `json:"date"`
+	Data struct {
+		Text      string `json:"text"`
+		CheckItem struct {
+			State string `json:"state"`
+		} `json:"checkItem"`
+	} `json:"data"`
+}
+
+// cardActionsSince fetches a card's actions of the given types since a time.
+func cardActionsSince(cardID, filter string, since time.Time) ([]cardAction, error) {
+	var actions []cardAction
+	params := url.Values{"filter": {filter}, "since": {since.Format(time.RFC3339)}, "limit": {"1000"}}
+	err := apiDo(http.MethodGet, "cards/"+cardID+"/actions", params, &actions)
+	return actions, err
+}
+
+// BuildDaySummary counts the checklist items completed and added on a card today, and those left to do.
+func BuildDaySummary(cardID string) (DaySummary, error) {
+	var s DaySummary
+	actions, err := cardActionsSince(cardID, "updateCheckItemStateOnCard,createCheckItem", StartOfDay(Now()))
+	if err != nil {
+		return s, err
+	}
+	for _, a := range actions {
+		switch {
+		case a.Type == "createCheckItem":
+			s.Added++
+		case a.Data.CheckItem.State == "complete":
+			s.Completed++
+		}
+	}
+
+	cls, err := CardChecklistInfo(cardID)
+	if err != nil {
+		return s, err
+	}
+	for _, cl := range cls {
+		for _, ci := range cl.CheckItems {
+			if ci.State == "incomplete" {
+				s.Remaining++
+			}
+		}
+	}
+	return s, nil
+}
+
+// PostDaySummary comments today's summary on a card, replacing an earlier summary from today if there is one.
+func PostDaySummary(cardID string) error {
+	s, err := BuildDaySummary(cardID)
+	if err != nil {
+		return err
+	}
+
+	comments, err := cardActionsSince(cardID, "commentCard", StartOfDay(Now()))
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		if strings.HasPrefix(c.Data.Text, summaryPrefix) {
+			return apiDo(http.MethodPut, "actions/"+c.ID+"/text", url.Values{"value": {s.String()}}, nil)
+		}
+	}
+	return Comment(cardID, s.String())
+}
+
+// RunDaySummaries posts the day's summary on every Active project card, on every board, at summaryTime.
+func RunDaySummaries(tick <-chan time.Time) {
+	for range tick {
+		if Paused() {
+			continue
+		}
+		ForEachBoard(PostDaySummaries)
+	}
+}
+
+// PostDaySummaries posts the day's summary on every Active project card.
+func PostDaySummaries() error {
+	cards, err := board.Active.Cards()
+	if err != nil {
+		return fmt.Errorf("unable to post daily summaries: %s", err)
+	}
+	for _, c := range cards {
+		if err := PostDaySummary(c.ID); err != nil {
+			logger.Printf("Unable to post the daily summary on %s: %s\n", c.Name, err)
+		}
+	}
+	usage.Record("day-summary")
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// taskTemplate makes the description of each task card the watcher makes, nil to leave them blank.
+var taskTemplate *template.Template
+
+// TaskInfo is what -task-template is filled in with.
+type TaskInfo struct {
+	// Project is the project card's name, and ProjectURL its link.
+	Project    string
+	ProjectURL string
+	// Checklist is the name of the checklist the item is on.
+	Checklist string
+	// CheckItem and CheckItemID are the checklist item's name and ID.
+	CheckItem   string
+	CheckItemID string
+}
+
+// SetTaskTemplate parses a Go text/template for task card descriptions, or clears it for "".
+func SetTaskTemplate(text string) error {
+	if text == "" {
+		taskTemplate = nil
+		return nil
+	}
+	t, err := template.New("task").Parse(text)
+	if err != nil {
+		return err
+	}
+	taskTemplate = t
+	return nil
+}
+
+// TaskDescription fills in -task-template for a project card's checklist item, or is "" without one.
+func TaskDescription(projectID, checkItemID string) (string, error) {
+	if taskTemplate == nil || projectID == "" {
+		return "", nil
+	}
+	var project struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if err := apiDo(http.MethodGet, "cards/"+projectID, url.Values{"fields": {"name,url"}}, &project); err != nil {
+		return "", err
+	}
+	cls, err := CardChecklistInfo(projectID)
+	if err != nil {
+		return "", err
+	}
+
+	info := TaskInfo{Project: ProjectName(project.Name), ProjectURL: project.URL, CheckItemID: checkItemID}
+	for _, cl := range cls {
+		for _, ci := range cl.CheckItems {
+			if ci.ID == checkItemID {
+				info.Checklist, info.CheckItem = cl.Name, ci.Name
+			}
+		}
+	}
+	var desc strings.Builder
+	if err := taskTemplate.Execute(&desc, info); err != nil {
+		return "", err
+	}
+	return desc.String(), nil
+}
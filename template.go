@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ifo/trel"
+)
+
+// projectTemplate names a card whose checklists are copied onto a project card without any when it is moved to Active.
+var projectTemplate string
+
+// FindTemplateCard finds the -project-template card on any open list on the board.
+func FindTemplateCard() (*trel.Card, error) {
+	tb, err := trelClient.Board(board.ID)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := tb.Lists()
+	if err != nil {
+		return nil, err
+	}
+	var open trel.Lists
+	for _, l := range lists {
+		if !l.Closed {
+			open = append(open, l)
+		}
+	}
+	cards, err := AllCards(open...)
+	if err != nil {
+		return nil, err
+	}
+	return cards.Find(projectTemplate)
+}
+
+// CopyChecklist copies a checklist and its items to the bottom of a card.
+func CopyChecklist(cardID string, cl trel.Checklist) error {
+	params := url.Values{"name": {cl.Name}, "idChecklistSource": {cl.ID}, "pos": {"bottom"}}
+	return apiDo(http.MethodPost, "cards/"+cardID+"/checklists", params, nil)
+}
+
+// PlanProjectTemplate works out whether a project card moved to Active needs the template's checklists,
+// reporting whether it does. If it does, the plan copies them and then sets the project up from them,
+// since its task cards can't be planned before the checklist items they are for exist.
+func PlanProjectTemplate(card trel.Card) (Plan, bool, error) {
+	plan := Plan{Operation: fmt.Sprintf("copying %q onto %q", projectTemplate, card.Name), Feature: "project-template"}
+	if projectTemplate == "" || card.Name == projectTemplate {
+		return plan, false, nil
+	}
+	checklists, err := card.Checklists()
+	if err != nil || len(checklists) > 0 {
+		return plan, false, err
+	}
+
+	template, err := FindTemplateCard()
+	if _, ok := err.(trel.NotFoundError); ok {
+		logger.Printf("There is no %q card to copy checklists from\n", projectTemplate)
+		return plan, false, nil
+	} else if err != nil {
+		return plan, false, err
+	}
+	templateChecklists, err := template.Checklists()
+	if err != nil || len(templateChecklists) == 0 {
+		return plan, false, err
+	}
+
+	plan.Changes = append(plan.Changes, Change{
+		Op: "copyChecklists", Card: card.Name, From: template.Name, To: card.Name,
+		apply: func() error {
+			for _, cl := range templateChecklists {
+				if err := CopyChecklist(card.ID, cl); err != nil {
+					return err
+				}
+			}
+			timeline.Add(card.ID, TimelineEntry{Source: "watcher", Type: "copyChecklists", Detail: "copied from " + template.Name})
+			setup, err := PlanSetupActiveProject(card)
+			if err != nil {
+				return err
+			}
+			return RunPlan(setup)
+		},
+	})
+	return plan, true, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timelineSize is how many entries are kept for each card.
+const timelineSize = 100
+
+var timeline = &Timeline{entries: map[string][]TimelineEntry{}}
+
+type TimelineEntry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"` // "watcher", "webhook", or "trello"
+	Type   string    `json:"type"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Timeline keeps the recent webhook events and watcher actions for each card.
+type Timeline struct {
+	mu      sync.Mutex
+	entries map[string][]TimelineEntry
+}
+
+// Add records an entry for a card, dropping the oldest entry when the card has too many.
+func (t *Timeline) Add(cardID string, e TimelineEntry) {
+	if cardID == "" {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := append(t.entries[cardID], e)
+	if len(entries) > timelineSize {
+		entries = entries[len(entries)-timelineSize:]
+	}
+	t.entries[cardID] = entries
+}
+
+// Entries returns a copy of a card's entries.
+func (t *Timeline) Entries(cardID string) []TimelineEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TimelineEntry(nil), t.entries[cardID]...)
+}
+
+// RecordTimeline adds every Event to the timeline of the card it is about.
+func RecordTimeline(next EventHandler) EventHandler {
+	return func(e Event) error {
+		timeline.Add(e.CardID, TimelineEntry{Source: "webhook", Type: e.ActionType})
+		return next(e)
+	}
+}
+
+// TrelloCardActions fetches the actions Trello has recorded for a card.
+func TrelloCardActions(cardID string) ([]TimelineEntry, error) {
+	var actions []struct {
+		Type          string    `json:"type"`
+		Date          time.Time `json:"date"`
+		MemberCreator struct {
+			FullName string `json:"fullName"`
+		} `json:"memberCreator"`
+	}
+	if err := apiDo(http.MethodGet, "cards/"+cardID+"/actions", url.Values{"filter": {"all"}}, &actions); err != nil {
+		return nil, err
+	}
+
+	var entries []TimelineEntry
+	for _, a := range actions {
+		entries = append(entries, TimelineEntry{Time: a.Date, Source: "trello", Type: a.Type, Detail: a.MemberCreator.FullName})
+	}
+	return entries, nil
+}
+
+// cardsAPI serves /api/cards/{id}/timeline.
+func cardsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/cards/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "timeline" {
+		http.NotFound(w, r)
+		return
+	}
+	cardID := parts[0]
+
+	entries := timeline.Entries(cardID)
+	trelloEntries, err := TrelloCardActions(cardID)
+	if err != nil {
+		// The watcher's own entries are still useful without Trello's.
+		logger.Printf("Unable to fetch Trello actions for card %s: %s\n", cardID, err)
+	}
+	entries = append(entries, trelloEntries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsCert and tlsKey are the certificate and key files the server uses to serve HTTPS itself, empty to serve HTTP.
+var tlsCert, tlsKey string
+
+// autocertDir is where certificates for -host got from Let's Encrypt are kept, empty to not get any.
+var autocertDir string
+
+// autocertEmail is the contact address given to Let's Encrypt, for notices about the certificates.
+var autocertEmail string
+
+// serveTLS reports whether the server serves HTTPS itself, instead of behind a proxy that does.
+func serveTLS() bool {
+	return (tlsCert != "" && tlsKey != "") || autocertDir != ""
+}
+
+// CertReloader loads a certificate and key, and loads them again once the certificate file changes,
+// so a renewed certificate, e.g. from certbot, is used without restarting the watcher.
+type CertReloader struct {
+	CertFile, KeyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// GetCertificate is for tls.Config, and keeps using the last certificate loaded if the files can't be read.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	info, err := os.Stat(cr.CertFile)
+	if err != nil {
+		if cr.cert != nil {
+			return cr.cert, nil
+		}
+		return nil, err
+	}
+	if cr.cert != nil && !info.ModTime().After(cr.modified) {
+		return cr.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		if cr.cert != nil {
+			logger.Printf("Unable to reload the TLS certificate, still using the old one: %s\n", err)
+			return cr.cert, nil
+		}
+		return nil, err
+	}
+	if cr.cert != nil {
+		logger.Println("Reloaded the TLS certificate")
+	}
+	cr.cert, cr.modified = &cert, info.ModTime()
+	return cr.cert, nil
+}
+
+// ListenAndServe serves the handler on the address, over HTTPS with -tls-cert and -tls-key or -autocert-dir, or HTTP otherwise.
+// Let's Encrypt checks the host with the TLS-ALPN challenge, on the same address, so it must be reachable on port 443.
+func ListenAndServe(addr string, handler http.Handler) error {
+	server := &http.Server{Handler: handler}
+	if autocertDir != "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(host),
+			Cache:      autocert.DirCache(autocertDir),
+			Email:      autocertEmail,
+		}
+		server.TLSConfig = m.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+	} else if tlsCert != "" && tlsKey != "" {
+		cr := &CertReloader{CertFile: tlsCert, KeyFile: tlsKey}
+		// Load the certificate now, so a bad one stops the watcher instead of failing every request.
+		if _, err := cr.GetCertificate(nil); err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{GetCertificate: cr.GetCertificate, MinVersion: tls.VersionTLS12}
+	}
+
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	if server.TLSConfig != nil {
+		return server.ServeTLS(l, "", "")
+	}
+	return server.Serve(l)
+}
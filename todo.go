@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TodoList is a project's checklists in a form that can be read from or written to a text file.
+type TodoList struct {
+	Name       string
+	URL        string
+	Checklists []TodoChecklist
+}
+
+type TodoChecklist struct {
+	Name  string
+	Items []TodoItem
+}
+
+type TodoItem struct {
+	Name     string
+	Complete bool
+	Due      *time.Time
+}
+
+// defaultChecklist holds items that aren't under a checklist heading.
+const defaultChecklist = "Tasks"
+
+// dueFormat is how due dates are written in exported files.
+const dueFormat = "2006-01-02"
+
+var (
+	markdownTask = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.+)$`)
+	// todo.txt priority, e.g. "(A) ".
+	todoTxtPriority = regexp.MustCompile(`^\([A-Z]\)\s+`)
+	// todo.txt creation and completion dates, e.g. "2020-01-31 ".
+	todoTxtDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\s+`)
+	// todo.txt due date tag, e.g. "due:2020-01-31".
+	todoTxtDue = regexp.MustCompile(`\s*\bdue:(\d{4}-\d{2}-\d{2})\b`)
+	// Markdown due date suffix, e.g. "(due 2020-01-31)".
+	markdownDue = regexp.MustCompile(`\s*\(due (\d{4}-\d{2}-\d{2})\)$`)
+)
+
+// parseDue removes a due date matching re from a name, returning the date if there was one.
+func parseDue(re *regexp.Regexp, name string) (string, *time.Time) {
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return name, nil
+	}
+	due, err := time.Parse(dueFormat, m[1])
+	if err != nil {
+		return name, nil
+	}
+	return strings.TrimSpace(re.ReplaceAllString(name, "")), &due
+}
+
+// add puts an item on the named checklist, creating the checklist if needed.
+func (tl *TodoList) add(checklist string, item TodoItem) {
+	for i := range tl.Checklists {
+		if tl.Checklists[i].Name == checklist {
+			tl.Checklists[i].Items = append(tl.Checklists[i].Items, item)
+			return
+		}
+	}
+	tl.Checklists = append(tl.Checklists, TodoChecklist{Name: checklist, Items: []TodoItem{item}})
+}
+
+// ParseMarkdown reads a Markdown task list.
+// A "# " heading is the project name, "## " headings are checklists,
+// and "- [ ] " or "- [x] " lines are checklist items.
+func ParseMarkdown(r io.Reader) (TodoList, error) {
+	var tl TodoList
+	checklist := defaultChecklist
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			checklist = strings.TrimSpace(line[3:])
+		case strings.HasPrefix(line, "# "):
+			tl.Name = strings.TrimSpace(line[2:])
+		default:
+			if m := markdownTask.FindStringSubmatch(line); m != nil {
+				name, due := parseDue(markdownDue, strings.TrimSpace(m[2]))
+				tl.add(checklist, TodoItem{Name: name, Complete: m[1] != " ", Due: due})
+			}
+		}
+	}
+	return tl, scanner.Err()
+}
+
+// ParseTodoTxt reads a todo.txt file, with priorities and dates removed from the names.
+// A task's first @context is its checklist, and the first +project names the project.
+func ParseTodoTxt(r io.Reader) (TodoList, error) {
+	var tl TodoList
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item TodoItem
+		if strings.HasPrefix(line, "x ") {
+			item.Complete = true
+			line = strings.TrimSpace(line[2:])
+		}
+		line = todoTxtPriority.ReplaceAllString(line, "")
+		// A completed task can have both a completion and a creation date.
+		line = todoTxtDate.ReplaceAllString(line, "")
+		line = todoTxtDate.ReplaceAllString(line, "")
+		line, item.Due = parseDue(todoTxtDue, strings.TrimSpace(line))
+
+		checklist := defaultChecklist
+		var words []string
+		for _, word := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(word, "+") && len(word) > 1:
+				if tl.Name == "" {
+					tl.Name = strings.Replace(word[1:], "_", " ", -1)
+				}
+			case strings.HasPrefix(word, "@") && len(word) > 1 && checklist == defaultChecklist:
+				checklist = strings.Replace(word[1:], "_", " ", -1)
+			default:
+				words = append(words, word)
+			}
+		}
+		item.Name = strings.Join(words, " ")
+		tl.add(checklist, item)
+	}
+	return tl, scanner.Err()
+}
+
+// ParseCSV reads projects from CSV rows of project, checklist, item, and optionally done ("x", "true", or "yes")
+// and a due date. An empty checklist is the default one, and a header row starting with "project" is skipped.
+func ParseCSV(r io.Reader) ([]TodoList, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var tls []TodoList
+	index := map[string]int{}
+	for n, row := range rows {
+		if n == 0 && len(row) > 0 && strings.EqualFold(strings.TrimSpace(row[0]), "project") {
+			continue
+		}
+		if len(row) < 3 {
+			return nil, fmt.Errorf("row %d: expected project, checklist, item", n+1)
+		}
+		project, checklist := strings.TrimSpace(row[0]), strings.TrimSpace(row[1])
+		item := TodoItem{Name: strings.TrimSpace(row[2])}
+		if project == "" || item.Name == "" {
+			return nil, fmt.Errorf("row %d: the project and item can't be empty", n+1)
+		}
+		if checklist == "" {
+			checklist = defaultChecklist
+		}
+		if len(row) > 3 {
+			switch strings.ToLower(strings.TrimSpace(row[3])) {
+			case "x", "true", "yes":
+				item.Complete = true
+			}
+		}
+		if len(row) > 4 && strings.TrimSpace(row[4]) != "" {
+			due, err := time.Parse(dueFormat, strings.TrimSpace(row[4]))
+			if err != nil {
+				return nil, fmt.Errorf("row %d: bad due date %q, use %s", n+1, row[4], dueFormat)
+			}
+			item.Due = &due
+		}
+
+		i, ok := index[project]
+		if !ok {
+			i = len(tls)
+			index[project] = i
+			tls = append(tls, TodoList{Name: project})
+		}
+		tls[i].add(checklist, item)
+	}
+	return tls, nil
+}
+
+// WriteMarkdown writes a TodoList in the format ParseMarkdown reads.
+func WriteMarkdown(w io.Writer, tl TodoList) error {
+	if _, err := fmt.Fprintf(w, "# %s\n", tl.Name); err != nil {
+		return err
+	}
+	if tl.URL != "" {
+		if _, err := fmt.Fprintf(w, "\n%s\n", tl.URL); err != nil {
+			return err
+		}
+	}
+	for _, cl := range tl.Checklists {
+		if _, err := fmt.Fprintf(w, "\n## %s\n\n", cl.Name); err != nil {
+			return err
+		}
+		for _, item := range cl.Items {
+			check := " "
+			if item.Complete {
+				check = "x"
+			}
+			line := fmt.Sprintf("- [%s] %s", check, item.Name)
+			if item.Due != nil {
+				line += fmt.Sprintf(" (due %s)", item.Due.Format(dueFormat))
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTodoTxt writes a TodoList as todo.txt, tagging each task with the project and checklist.
+func WriteTodoTxt(w io.Writer, tl TodoList) error {
+	for _, cl := range tl.Checklists {
+		for _, item := range cl.Items {
+			line := item.Name
+			if item.Complete {
+				line = "x " + line
+			}
+			line += " +" + todoTxtTag(tl.Name) + " @" + todoTxtTag(cl.Name)
+			if item.Due != nil {
+				line += " due:" + item.Due.Format(dueFormat)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// todoTxtTag makes a name usable as a todo.txt project or context, which can't contain spaces.
+func todoTxtTag(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TunnelProvider is a command that opens a tunnel, with {addr} standing for the local address,
+// and how to find the public URL in what it prints.
+type TunnelProvider struct {
+	Command string
+	URL     *regexp.Regexp
+}
+
+// tunnelProviders are the providers -tunnel can be given by name.
+var tunnelProviders = map[string]TunnelProvider{
+	"cloudflared": {"cloudflared tunnel --no-autoupdate --url http://{addr}", regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)},
+	"ngrok":       {"ngrok http {addr} --log stdout --log-format logfmt", regexp.MustCompile(`url=(https://\S+)`)},
+}
+
+// anyURL finds the public URL a tunnel command not in tunnelProviders prints, the first HTTPS URL.
+var anyURL = regexp.MustCompile(`https://[a-zA-Z0-9.-]+\.[a-zA-Z]+`)
+
+// tunnelWait is how long a tunnel command has to print its public URL.
+const tunnelWait = 30 * time.Second
+
+// tunnel is the running tunnel command, nil if there isn't one.
+var tunnel *exec.Cmd
+
+// StartTunnel runs a tunnel provider, by name or as a command with {addr} standing for the local address,
+// and returns the host of the first public HTTPS URL it prints. The tunnel runs until StopTunnel.
+func StartTunnel(provider, addr string) (string, error) {
+	p, ok := tunnelProviders[provider]
+	if !ok {
+		p = TunnelProvider{Command: provider, URL: anyURL}
+	}
+	args := strings.Fields(strings.Replace(p.Command, "{addr}", addr, -1))
+	if len(args) == 0 {
+		return "", fmt.Errorf("empty tunnel command")
+	}
+
+	tunnel = exec.Command(args[0], args[1:]...)
+	// Providers differ in which of stdout and stderr they print the URL to.
+	r, w := io.Pipe()
+	tunnel.Stdout, tunnel.Stderr = w, w
+	if err := tunnel.Start(); err != nil {
+		tunnel = nil
+		return "", err
+	}
+
+	found := make(chan string, 1)
+	go func() {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			logger.Printf("tunnel: %s\n", s.Text())
+			if m := p.URL.FindStringSubmatch(s.Text()); m != nil {
+				select {
+				case found <- m[len(m)-1]:
+				default:
+				}
+			}
+		}
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- tunnel.Wait()
+		w.Close()
+	}()
+
+	select {
+	case u := <-found:
+		parsed, err := url.Parse(u)
+		if err != nil {
+			StopTunnel()
+			return "", err
+		}
+		logger.Printf("Tunnel %s is open to %s\n", u, addr)
+		return parsed.Host, nil
+	case err := <-exited:
+		return "", fmt.Errorf("tunnel command exited before printing a URL: %v", err)
+	case <-time.After(tunnelWait):
+		StopTunnel()
+		return "", fmt.Errorf("tunnel command printed no URL within %s", tunnelWait)
+	}
+}
+
+// StopTunnel stops the tunnel command, if there is one.
+func StopTunnel() {
+	if tunnel != nil && tunnel.Process != nil {
+		tunnel.Process.Kill()
+	}
+}
+
+// TunnelAddr is the local address a tunnel forwards to, for the server's -listen address or -port.
+func TunnelAddr() (string, error) {
+	if strings.HasPrefix(listenAddr, "unix:") {
+		return "", fmt.Errorf("-tunnel can't forward to a Unix domain socket, use -port")
+	}
+	addr := listenAddr
+	if addr == "" {
+		addr = ":" + port
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return addr, nil
+}
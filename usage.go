@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// usageFile is where feature usage is kept. It never leaves this machine.
+var usageFile string
+
+// features are the automations usage is tracked for,
+// so the report can show the ones that never fired.
+var features = []string{
+	"activate-project",
+	"store-project",
+	"spec-links",
+	"near-miss-report",
+	"guardrail-hold",
+	"closed-list-pause",
+	"list-reresolve",
+	"list-rename",
+	"access-lost",
+	"project-complete",
+	"active-limit",
+	"due-sync",
+	"due-reminder",
+	"checkitem-due-reminder",
+	"label-sync",
+	"project-template",
+	"todo-sort",
+	"hygiene-report",
+	"checklist-edit",
+	"import",
+	"migrate",
+	"export-project",
+	"export-completed",
+	"done-archive",
+	"retention",
+	"inbox-triage",
+	"aging-labels",
+	"stale-nudge",
+	"budget-exceeded",
+	"sticker-command",
+	"day-summary",
+	"weekly-digest",
+	"duplicate-skip",
+	"reconcile",
+	"rename-sync",
+	"card-removed",
+	"checklist-added",
+	"checklist-removed",
+}
+
+var usage = &Usage{Features: map[string]*UsageEntry{}}
+
+type UsageEntry struct {
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// Usage is a local ledger of how often each feature fires.
+type Usage struct {
+	mu       sync.Mutex
+	Features map[string]*UsageEntry `json:"features"`
+}
+
+// LoadUsage reads the usage ledger from usageFile, if it exists.
+func LoadUsage() error {
+	b, err := ioutil.ReadFile(usageFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	return json.Unmarshal(b, usage)
+}
+
+// Record counts one use of a feature and saves the ledger.
+func (u *Usage) Record(feature string) {
+	if usageFile == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	e, ok := u.Features[feature]
+	if !ok {
+		e = &UsageEntry{First: now}
+		u.Features[feature] = e
+	}
+	e.Count++
+	e.Last = now
+
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err == nil {
+		err = writeFileReplacing(usageFile, b)
+	}
+	if err != nil {
+		logger.Printf("Unable to save usage to %s: %s\n", usageFile, err)
+	}
+}
+
+// RecordUsage counts every Event by its action type.
+func RecordUsage(next EventHandler) EventHandler {
+	return func(e Event) error {
+		usage.Record("event:" + e.ActionType)
+		return next(e)
+	}
+}
+
+// UsageReportCommand prints how often each feature has fired, and which never have.
+//
+//	trello-watcher usage-report
+func UsageReportCommand(args []string) error {
+	if err := LoadUsage(); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range usage.Features {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return usage.Features[names[i]].Count > usage.Features[names[j]].Count })
+
+	for _, name := range names {
+		e := usage.Features[name]
+		fmt.Printf("%-32s %6d  last %s\n", name, e.Count, e.Last.Format(time.RFC3339))
+	}
+
+	var never []string
+	for _, name := range features {
+		if _, ok := usage.Features[name]; !ok {
+			never = append(never, name)
+		}
+	}
+	if len(never) > 0 {
+		fmt.Println("\nNever fired:")
+		for _, name := range never {
+			fmt.Println("  " + name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// WebhookInfo is a webhook as the webhooks API shows it.
+type WebhookInfo struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Model       string `json:"model"`
+	CallbackURL string `json:"callbackURL"`
+	Active      bool   `json:"active"`
+	// Owned is whether the watcher made the webhook.
+	Owned bool `json:"owned"`
+}
+
+// webhooksAPI manages the webhooks the board knows about:
+//
+//	GET /webhooks                    lists them
+//	GET /webhooks/{id}               shows one
+//	POST /webhooks/{id}/activate     activates one
+//	POST /webhooks/{id}/deactivate   deactivates one
+//	DELETE /webhooks/{id}            deletes one
+func webhooksAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks"), "/"), "/")
+	if parts[0] == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		infos := []WebhookInfo{}
+		for _, wh := range board.Webhooks {
+			infos = append(infos, webhookInfo(wh.ID))
+		}
+		writeWebhookJSON(w, infos)
+		return
+	}
+
+	id, action := parts[0], strings.Join(parts[1:], "/")
+	i := -1
+	for j := range board.Webhooks {
+		if board.Webhooks[j].ID == id {
+			i = j
+		}
+	}
+	if i < 0 || (action != "" && action != "activate" && action != "deactivate") {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	wh := &board.Webhooks[i]
+
+	var err error
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+	case action == "" && r.Method == http.MethodDelete:
+		if err = wh.Delete(); err == nil {
+			state.DisownWebhook(id)
+			board.Webhooks = append(board.Webhooks[:i], board.Webhooks[i+1:]...)
+			shareWebhook(id, nil)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case action == "activate" && r.Method == http.MethodPost:
+		err = wh.Activate()
+		shareWebhook(id, wh)
+	case action == "deactivate" && r.Method == http.MethodPost:
+		err = wh.Deactivate()
+		shareWebhook(id, wh)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		logger.Printf("Unable to change webhook %s: %s\n", id, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeWebhookJSON(w, webhookInfo(id))
+}
+
+// shareWebhook copies a change to one of the board's webhooks to every other board's copy, or removes it if wh is nil.
+// The caller must hold boardMu, as webhooksAPI does through boardHandler.
+func shareWebhook(id string, wh *trel.Webhook) {
+	for _, b := range boards {
+		if b.ID == board.ID {
+			continue
+		}
+		for i := range b.Webhooks {
+			if b.Webhooks[i].ID != id {
+				continue
+			}
+			if wh == nil {
+				b.Webhooks = append(b.Webhooks[:i], b.Webhooks[i+1:]...)
+			} else {
+				b.Webhooks[i] = *wh
+			}
+			break
+		}
+	}
+}
+
+// webhookInfo describes one of the board's webhooks, by ID.
+func webhookInfo(id string) WebhookInfo {
+	for _, wh := range board.Webhooks {
+		if wh.ID == id {
+			return WebhookInfo{
+				ID:          wh.ID,
+				Description: wh.Description,
+				Model:       wh.IDModel,
+				CallbackURL: wh.CallbackURL,
+				Active:      wh.Active,
+				Owned:       state.OwnsWebhook(wh.ID),
+			}
+		}
+	}
+	return WebhookInfo{ID: id}
+}
+
+func writeWebhookJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Println(err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ifo/trel"
+)
+
+// activeLimit is the most projects Active can have, 0 for no limit.
+var activeLimit int
+
+// PlanActiveLimit works out whether a card moved to Active is over the -active-limit,
+// and if it is, plans moving it back to Projects with a comment saying why.
+// It reports whether the card was over the limit.
+func PlanActiveLimit(card trel.Card) (Plan, bool, error) {
+	plan := Plan{Operation: fmt.Sprintf("limiting Active for %q", card.Name), Feature: "active-limit"}
+	if activeLimit <= 0 {
+		return plan, false, nil
+	}
+	active, err := board.Active.Cards()
+	if err != nil {
+		return plan, false, err
+	}
+	if len(active) <= activeLimit {
+		return plan, false, nil
+	}
+	logger.Printf("Active has %d projects, over the limit of %d, moving %q back\n", len(active), activeLimit, card.Name)
+	plan.Move(&card, board.Active, board.Projects)
+	plan.Comment(&card, fmt.Sprintf("Moved back to %s: %s is limited to %d at a time. Finish or store one of its projects first.",
+		board.Projects.Name, board.Active.Name, activeLimit))
+	return plan, true, nil
+}
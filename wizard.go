@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ifo/trel"
+)
+
+// SetupWizard walks through the key and token, picking a board, and making any lists it is missing,
+// then writes the settings to a config file, so nothing has to be copied out of Trello URLs by hand.
+func SetupWizard(in io.Reader, out io.Writer, path string) error {
+	r := bufio.NewReader(in)
+	ask := func(question, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", question)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+	yes := func(question string) (bool, error) {
+		answer, err := ask(question+" (y/n)", "y")
+		return strings.HasPrefix(strings.ToLower(answer), "y"), err
+	}
+
+	fmt.Fprintln(out, "Get an API key from https://trello.com/app-key")
+	key, err := ask("API key", os.Getenv("TRELLO_KEY"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Get a token from https://trello.com/1/authorize?expiration=never&scope=read,write&response_type=token&name=trello-watcher&key=%s\n", url.QueryEscape(key))
+	token, err := ask("Token", os.Getenv("TRELLO_TOKEN"))
+	if err != nil {
+		return err
+	}
+	trelClient = trel.New("", key, token)
+
+	var boardList []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	err = apiDo(http.MethodGet, "members/me/boards", url.Values{"filter": {"open"}, "fields": {"name"}}, &boardList)
+	if err != nil {
+		return fmt.Errorf("unable to list boards, check the key and token: %s", err)
+	}
+	if len(boardList) == 0 {
+		return fmt.Errorf("the token's member has no open boards, make one on Trello first")
+	}
+	for i, b := range boardList {
+		fmt.Fprintf(out, "%3d. %s\n", i+1, b.Name)
+	}
+	var boardID string
+	for boardID == "" {
+		answer, err := ask("Board number", "")
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(boardList) {
+			fmt.Fprintf(out, "Pick a number from 1 to %d\n", len(boardList))
+			continue
+		}
+		boardID = boardList[n-1].ID
+	}
+
+	tb, err := trelClient.Board(boardID)
+	if err != nil {
+		return err
+	}
+	lists, err := tb.Lists()
+	if err != nil {
+		return err
+	}
+	for _, role := range listRoles {
+		if l, err := findOpenList(lists, listName(role)); err == nil && !l.Closed {
+			continue
+		}
+		create, err := yes(fmt.Sprintf("The board has no %q list, make it", listName(role)))
+		if err != nil {
+			return err
+		}
+		if !create {
+			fmt.Fprintf(out, "The watcher won't start until the board has a %q list\n", listName(role))
+			continue
+		}
+		if err := CreateRoleList(tb.ID, role); err != nil {
+			return err
+		}
+	}
+
+	settings := map[string]string{"board": tb.ID, "key": key, "token": token}
+	if settings["host"], err = ask("Host name Trello can reach the watcher at, empty to poll instead", os.Getenv("HOST")); err != nil {
+		return err
+	}
+	if settings["host"] == "" {
+		delete(settings, "host")
+		settings["poll"] = "1m"
+	}
+	if settings["port"], err = ask("Port", "8080"); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		overwrite, err := yes(fmt.Sprintf("%s already exists, overwrite it", path))
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return fmt.Errorf("%s was left as it was", path)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := WriteConfig(f, settings, []string{"board", "key", "token", "host", "poll", "port"}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %s, start the watcher with -config %s\n", path, path)
+	return nil
+}